@@ -0,0 +1,176 @@
+// Package compare contains metrics for comparing secondary structures
+// of the same sequence, typically a prediction against a reference.
+package compare /* import "keltainen.duckdns.org/rnafolding/compare" */
+
+import "math"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+type Scores struct {
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+	TrueNegatives  int
+	Sensitivity    float64
+	PPV            float64
+	F1             float64
+	MCC            float64
+}
+
+type Comparison struct {
+	PairDistance     int
+	MountainDistance int
+	// TreeEditDistance is -1 if either folding contains pseudoknots
+	TreeEditDistance int
+	Exact            Scores
+	Slipped          Scores
+}
+
+func Compare(pred, ref folding.FoldingPairs) Comparison {
+	ted, err := TreeEditDistance(pred, ref)
+	if err != nil {
+		ted = -1
+	}
+	return Comparison{
+		PairDistance:     PairDistance(pred, ref),
+		MountainDistance: MountainDistance(pred, ref),
+		TreeEditDistance: ted,
+		Exact:            Score(pred, ref, 0),
+		Slipped:          Score(pred, ref, 1),
+	}
+}
+
+func PairDistance(a, b folding.FoldingPairs) int {
+	d := 0
+	for i := range a {
+		if a[i] > i && b[i] != a[i] {
+			d++
+		}
+		if b[i] > i && a[i] != b[i] {
+			d++
+		}
+	}
+	return d
+}
+
+func hasPair(f folding.FoldingPairs, i, j int) bool {
+	return i >= 0 && i < len(f) && f[i] == j
+}
+
+// candidates returns the first bases of the pairs of f that match the pair
+// (i, j), with one of its bases shifted by at most slippage positions.
+func candidates(f folding.FoldingPairs, i, j, slippage int) []int {
+	var out []int
+	add := func(i, j int) {
+		if i < j && hasPair(f, i, j) {
+			out = append(out, i)
+		}
+	}
+	add(i, j)
+	for s := 1; s <= slippage; s++ {
+		add(i-s, j)
+		add(i+s, j)
+		add(i, j-s)
+		add(i, j+s)
+	}
+	return out
+}
+
+// matchPairs returns the size of a largest one-to-one matching between the
+// pairs of pred and ref, found with augmenting paths.
+func matchPairs(pred, ref folding.FoldingPairs, slippage int) int {
+	// Predicted pair matched to each reference pair, by first bases
+	matchedTo := map[int]int{}
+	var augment func(i int, seen map[int]bool) bool
+	augment = func(i int, seen map[int]bool) bool {
+		for _, r := range candidates(ref, i, pred[i], slippage) {
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+			if p, ok := matchedTo[r]; !ok || augment(p, seen) {
+				matchedTo[r] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i, j := range pred {
+		if j > i {
+			augment(i, map[int]bool{})
+		}
+	}
+	return len(matchedTo)
+}
+
+func numPairs(f folding.FoldingPairs) int {
+	n := 0
+	for i, j := range f {
+		if j > i {
+			n++
+		}
+	}
+	return n
+}
+
+// Score compares predicted pairs against reference pairs. A predicted pair
+// is counted as correct if the reference contains the same pair, or with
+// nonzero slippage, a pair with one of its bases shifted by at most
+// slippage positions. Each reference pair confirms at most one predicted
+// pair, so that true positives and false negatives add up to the number
+// of reference pairs.
+func Score(pred, ref folding.FoldingPairs, slippage int) Scores {
+	var s Scores
+	s.TruePositives = matchPairs(pred, ref, slippage)
+	s.FalsePositives = numPairs(pred) - s.TruePositives
+	s.FalseNegatives = numPairs(ref) - s.TruePositives
+	n := len(ref)
+	s.TrueNegatives = n*(n-1)/2 - s.TruePositives - s.FalsePositives - s.FalseNegatives
+
+	tp := float64(s.TruePositives)
+	fp := float64(s.FalsePositives)
+	fn := float64(s.FalseNegatives)
+	tn := float64(s.TrueNegatives)
+	s.Sensitivity = ratio(tp, tp+fn)
+	s.PPV = ratio(tp, tp+fp)
+	s.F1 = ratio(2*s.Sensitivity*s.PPV, s.Sensitivity+s.PPV)
+	s.MCC = ratio(tp*tn-fp*fn, math.Sqrt((tp+fp)*(tp+fn)*(tn+fp)*(tn+fn)))
+	return s
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func mountain(f folding.FoldingPairs) []int {
+	m := make([]int, len(f))
+	h := 0
+	for i, j := range f {
+		if j > i {
+			h++
+		} else if j >= 0 {
+			h--
+		}
+		m[i] = h
+	}
+	return m
+}
+
+// MountainDistance returns the L1 distance between mountain
+// representations of two foldings.
+func MountainDistance(a, b folding.FoldingPairs) int {
+	ma := mountain(a)
+	mb := mountain(b)
+	d := 0
+	for i := range ma {
+		if ma[i] > mb[i] {
+			d += ma[i] - mb[i]
+		} else {
+			d += mb[i] - ma[i]
+		}
+	}
+	return d
+}
@@ -0,0 +1,94 @@
+package compare /* import "keltainen.duckdns.org/rnafolding/compare" */
+
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func TestDistances(t *testing.T) {
+	tests := []struct {
+		a        folding.FoldingPairs
+		b        folding.FoldingPairs
+		pair     int
+		mountain int
+		tree     int
+	}{
+		// ((...))
+		// ((...))
+		{
+			folding.FoldingPairs{6, 5, -1, -1, -1, 1, 0},
+			folding.FoldingPairs{6, 5, -1, -1, -1, 1, 0},
+			0, 0, 0,
+		},
+		// ((...))
+		// .(...).
+		{
+			folding.FoldingPairs{6, 5, -1, -1, -1, 1, 0},
+			folding.FoldingPairs{-1, 5, -1, -1, -1, 1, -1},
+			1, 6, 3,
+		},
+		// (.....)
+		// .(...).
+		{
+			folding.FoldingPairs{6, -1, -1, -1, -1, -1, 0},
+			folding.FoldingPairs{-1, 5, -1, -1, -1, 1, -1},
+			2, 2, 2,
+		},
+		// .......
+		// ((...))
+		{
+			folding.FoldingPairs{-1, -1, -1, -1, -1, -1, -1},
+			folding.FoldingPairs{6, 5, -1, -1, -1, 1, 0},
+			2, 10, 6,
+		},
+	}
+	for _, tt := range tests {
+		if actual := PairDistance(tt.a, tt.b); actual != tt.pair {
+			t.Errorf("PairDistance(%v, %v): expected %d, actual %d", tt.a, tt.b, tt.pair, actual)
+		}
+		if actual := MountainDistance(tt.a, tt.b); actual != tt.mountain {
+			t.Errorf("MountainDistance(%v, %v): expected %d, actual %d", tt.a, tt.b, tt.mountain, actual)
+		}
+		if actual, err := TreeEditDistance(tt.a, tt.b); err != nil || actual != tt.tree {
+			t.Errorf("TreeEditDistance(%v, %v): expected %d, actual %d (%v)", tt.a, tt.b, tt.tree, actual, err)
+		}
+	}
+}
+
+func TestTreeEditDistancePseudoknot(t *testing.T) {
+	// ([)]
+	pk := folding.FoldingPairs{2, 3, 0, 1}
+	if _, err := TreeEditDistance(pk, folding.FoldingPairs{-1, -1, -1, -1}); err == nil {
+		t.Errorf("TreeEditDistance(%v, ...): expected error, got nil", pk)
+	}
+}
+
+func TestScore(t *testing.T) {
+	ref := folding.FoldingPairs{9, 8, 7, -1, -1, -1, -1, 2, 1, 0}
+	tests := []struct {
+		pred     folding.FoldingPairs
+		slippage int
+		tp       int
+		fp       int
+		fn       int
+	}{
+		{ref, 0, 3, 0, 0},
+		{folding.FoldingPairs{8, 7, -1, -1, -1, -1, -1, 1, 0, -1}, 0, 0, 2, 3},
+		// Each reference pair matches only one shifted predicted pair
+		{folding.FoldingPairs{8, 7, -1, -1, -1, -1, -1, 1, 0, -1}, 1, 2, 0, 1},
+		{folding.FoldingPairs{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1}, 1, 0, 0, 3},
+	}
+	for _, tt := range tests {
+		s := Score(tt.pred, ref, tt.slippage)
+		if s.TruePositives != tt.tp || s.FalsePositives != tt.fp || s.FalseNegatives != tt.fn {
+			t.Errorf("Score(%v, %v, %d): expected TP=%d FP=%d FN=%d, actual %+v",
+				tt.pred, ref, tt.slippage, tt.tp, tt.fp, tt.fn, s)
+		}
+		if s.TruePositives+s.FalsePositives+s.FalseNegatives+s.TrueNegatives != 45 {
+			t.Errorf("Score(%v, %v, %d): counts don't add up to 45 possible pairs: %+v",
+				tt.pred, ref, tt.slippage, s)
+		}
+	}
+	if s := Score(ref, ref, 0); s.Sensitivity != 1 || s.PPV != 1 || s.F1 != 1 || s.MCC != 1 {
+		t.Errorf("Score(%v, %v, 0): expected perfect scores, got %+v", ref, ref, s)
+	}
+}
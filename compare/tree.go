@@ -0,0 +1,126 @@
+package compare /* import "keltainen.duckdns.org/rnafolding/compare" */
+
+import "fmt"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+const (
+	labelRoot = iota
+	labelPair
+	labelFree
+)
+
+// Ordered tree in postorder, where each node also knows its leftmost
+// leaf descendant.
+type tree struct {
+	labels   []int
+	leftmost []int
+}
+
+func toTree(f folding.FoldingPairs) (*tree, error) {
+	t := &tree{}
+	if err := t.add(f, 0, len(f)-1); err != nil {
+		return nil, err
+	}
+	t.labels = append(t.labels, labelRoot)
+	t.leftmost = append(t.leftmost, 0)
+	return t, nil
+}
+
+func (t *tree) add(f folding.FoldingPairs, i, j int) error {
+	for k := i; k <= j; k++ {
+		start := len(t.labels)
+		if f[k] < 0 {
+			t.labels = append(t.labels, labelFree)
+			t.leftmost = append(t.leftmost, start)
+			continue
+		}
+		if f[k] <= k || f[k] > j {
+			return fmt.Errorf("pair (%d,%d) crosses another pair", k, f[k])
+		}
+		if err := t.add(f, k+1, f[k]-1); err != nil {
+			return err
+		}
+		t.labels = append(t.labels, labelPair)
+		t.leftmost = append(t.leftmost, start)
+		k = f[k]
+	}
+	return nil
+}
+
+func (t *tree) keyroots() []int {
+	last := map[int]int{}
+	for n, l := range t.leftmost {
+		last[l] = n
+	}
+	var ret []int
+	for n, l := range t.leftmost {
+		if last[l] == n {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// TreeEditDistance returns the unit cost edit distance between the tree
+// representations of two foldings, where each pair and each unpaired base
+// is a node. Foldings with pseudoknots have no tree representation.
+func TreeEditDistance(a, b folding.FoldingPairs) (int, error) {
+	ta, err := toTree(a)
+	if err != nil {
+		return 0, err
+	}
+	tb, err := toTree(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Zhang & Shasha, Simple fast algorithms for the editing distance
+	// between trees and related problems. SIAM J. Comput., 1989
+	td := make([][]int, len(ta.labels))
+	for i := range td {
+		td[i] = make([]int, len(tb.labels))
+	}
+	for _, i := range ta.keyroots() {
+		for _, j := range tb.keyroots() {
+			li := ta.leftmost[i]
+			lj := tb.leftmost[j]
+			fd := make([][]int, i-li+2)
+			for x := range fd {
+				fd[x] = make([]int, j-lj+2)
+				fd[x][0] = x
+			}
+			for y := range fd[0] {
+				fd[0][y] = y
+			}
+			for x := 1; x < len(fd); x++ {
+				for y := 1; y < len(fd[x]); y++ {
+					na := li + x - 1
+					nb := lj + y - 1
+					if ta.leftmost[na] == li && tb.leftmost[nb] == lj {
+						relabel := 0
+						if ta.labels[na] != tb.labels[nb] {
+							relabel = 1
+						}
+						fd[x][y] = min3(fd[x-1][y]+1, fd[x][y-1]+1, fd[x-1][y-1]+relabel)
+						td[na][nb] = fd[x][y]
+					} else {
+						fd[x][y] = min3(fd[x-1][y]+1, fd[x][y-1]+1,
+							fd[ta.leftmost[na]-li][tb.leftmost[nb]-lj]+td[na][nb])
+					}
+				}
+			}
+		}
+	}
+	return td[len(ta.labels)-1][len(tb.labels)-1], nil
+}
@@ -14,6 +14,7 @@ import "keltainen.duckdns.org/rnafolding/base"
 import "keltainen.duckdns.org/rnafolding/fasta"
 import "keltainen.duckdns.org/rnafolding/folding"
 import "keltainen.duckdns.org/rnafolding/nussinov"
+import "keltainen.duckdns.org/rnafolding/plot"
 import "keltainen.duckdns.org/rnafolding/safecomplete"
 
 var (
@@ -22,6 +23,8 @@ var (
 	minhairpin = flag.Int("minhairpin", 3, "Minimum number of free bases in hairpin loop")
 	single     = flag.Bool("single", false, "Solve only a single optimal folding, without safety")
 	jsonout    = flag.Bool("json", false, "JSON output")
+	heatmap    = flag.String("heatmap", "", "Draw heatmap of pair frequencies in optimal foldings in given format: svg or png")
+	heatmapdir = flag.String("heatmapdir", ".", "Directory for heatmap files")
 )
 
 func main() {
@@ -32,6 +35,10 @@ func main() {
 		return
 	}
 
+	if *heatmap != "" && *heatmap != "svg" && *heatmap != "png" {
+		log.Fatalf("Unknown heatmap format \"%s\", must be svg or png", *heatmap)
+	}
+
 	seqs := readFasta(*infile)
 	//log.Printf("Read %d sequences from %s", len(seqs), *infile)
 	if *name != "" {
@@ -51,6 +58,10 @@ func main() {
 		go analyze(seqs, vals)
 	}
 
+	if *heatmap != "" {
+		vals = writeHeatmaps(vals)
+	}
+
 	if *jsonout {
 		for r := range vals {
 			d, err := json.Marshal(r)
@@ -79,6 +90,7 @@ type retitem struct {
 	Pairs      [][]*big.Int
 	Free       []*big.Int
 	Sample     folding.FoldingPairs
+	seq        *base.Sequence
 }
 
 func analyze(seqs map[string]*base.Sequence, ret chan retitem) {
@@ -96,15 +108,21 @@ func analyze(seqs map[string]*base.Sequence, ret chan retitem) {
 
 		sComplex := time.Now()
 		sc.CountSolutions()
-		sc.CountPairings()
-		/*complexSafety :=*/ sc.SafetyFromBacktrack()
+		if err := sc.CountPairings(); err != nil {
+			log.Printf("Counting pairings of %s failed: %v", seq.Name, err)
+			continue
+		}
+		if _, err := sc.SafetyFromBacktrack(); err != nil {
+			log.Printf("Computing safety of %s failed: %v", seq.Name, err)
+			continue
+		}
 		tComplex := time.Since(sComplex)
 		//log.Printf("Safety done in %.0f seconds, %d solutions", tComplex.Seconds(), sc.Sol[0][len(sc.Sol[0])-1])
 
 		ret <- retitem{
 			seq.Name, len(seq.Bases), sc.Sol[0][len(seq.Bases)-1], sc.V[0][len(seq.Bases)-1],
 			tFill.Seconds(), tComplex.Seconds(), 0,
-			sc.PairSafety, sc.SingleSafety, nil,
+			sc.PairSafety, sc.SingleSafety, nil, seq,
 		}
 	}
 	close(ret)
@@ -126,11 +144,43 @@ func singleAnalyze(seqs map[string]*base.Sequence, ret chan retitem) {
 
 		ret <- retitem{seq.Name, len(seq.Bases), big.NewInt(0), num,
 			tFill.Seconds(), 0, tBt.Seconds(),
-			nil, nil, fold}
+			nil, nil, fold, seq}
 	}
 	close(ret)
 }
 
+// writeHeatmaps draws the pair counts of each result passing through.
+func writeHeatmaps(in chan retitem) chan retitem {
+	out := make(chan retitem, 1)
+	go func() {
+		for r := range in {
+			if r.Pairs != nil {
+				pairs, free := plot.CountFractions(r.Pairs, r.Free, r.NumFolds)
+				p := plot.Heatmap(r.seq, pairs, free, r.seq.ReferenceFolding)
+				fname := path.Join(*heatmapdir, r.Name+"-heatmap."+*heatmap)
+				if err := writePicture(p, fname); err != nil {
+					log.Printf("Failed to write heatmap %s: %v", fname, err)
+				}
+			}
+			out <- r
+		}
+		close(out)
+	}()
+	return out
+}
+
+func writePicture(p *plot.Picture, fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *heatmap == "png" {
+		return p.WritePNG(f)
+	}
+	return p.WriteSVG(f)
+}
+
 func readFasta(fname string) map[string]*base.Sequence {
 	stat, err := os.Stat(fname)
 	if err != nil {
@@ -149,7 +199,9 @@ func readFasta(fname string) map[string]*base.Sequence {
 				log.Fatalf("Unable to open file \"%s\": %v", subfname, err)
 			}
 			seq, err := fasta.ReadSequence(f)
-			if err != nil {
+			if _, ok := err.(*fasta.FoldingError); ok {
+				log.Printf("Ignoring reference folding in \"%s\": %v", subfname, err)
+			} else if err != nil {
 				log.Fatalf("Error reading FASTA format file \"%s\": %v", fn, err)
 			}
 			ret[seq.Name] = seq
@@ -161,7 +213,11 @@ func readFasta(fname string) map[string]*base.Sequence {
 			log.Fatalf("Unable to open file \"%s\": %v", fname, err)
 		}
 		seq, err := fasta.ReadMultiSequence(f)
-		if err != nil {
+		if errs, ok := err.(fasta.FoldingErrors); ok {
+			for _, e := range errs {
+				log.Printf("Ignoring reference folding in \"%s\": %v", fname, e)
+			}
+		} else if err != nil {
 			log.Fatalf("Error reading FASTA format file \"%s\": %v", fname, err)
 		}
 		return seq
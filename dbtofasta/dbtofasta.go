@@ -25,7 +25,15 @@ func main() {
 		log.Fatalf("Unable to open tRNA database \"%s\": %v", *db, err)
 	}
 	seqs, err := trnadb.ReadSequences(f)
-	if err != nil {
+	if errs, ok := err.(trnadb.FoldingErrors); ok {
+		for _, e := range errs {
+			if e.Partial {
+				log.Printf("Writing %s with partial reference folding: %v", e.Name, e.Err)
+			} else {
+				log.Printf("Writing %s without reference folding: %v", e.Name, e.Err)
+			}
+		}
+	} else if err != nil {
 		log.Fatalf("Error reading tRNA database file \"%s\": %v", *db, err)
 	}
 
@@ -0,0 +1,75 @@
+package main
+
+import "log"
+import "os"
+import "path"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/pipeline"
+import "keltainen.duckdns.org/rnafolding/plot"
+
+func writePicture(p *plot.Picture, name, format string) {
+	fname := path.Join(*outdir, name+"."+format)
+	f, err := os.Create(fname)
+	if err != nil {
+		log.Printf("Could not open %s for writing: %v", fname, err)
+		return
+	}
+	defer f.Close()
+	if format == "png" {
+		err = p.WritePNG(f)
+	} else {
+		err = p.WriteSVG(f)
+	}
+	if err != nil {
+		log.Printf("Failed to write to %s: %v", fname, err)
+	}
+}
+
+func writeDrawings(o *pipeline.OutputEntry) {
+	seq := base.SequenceFromString(o.Sequence)
+	opts := plot.StructureOptions{Safety: o.Safety.SafeBase}
+	if *drawcolor == "frequency" {
+		opts = plot.StructureOptions{
+			PairCount: o.Safety.PairCount,
+			FreeCount: o.Safety.FreeCount,
+			Total:     o.Counts.SafeCompleteFoldings,
+		}
+	}
+	foldings := []struct {
+		name string
+		f    folding.FoldingPairs
+	}{
+		{"example", o.AllFoldings[0].Pairing},
+		{"consensus", o.ConsensusFolding.Pairing},
+		{"reference", o.ReferenceFolding.Pairing},
+	}
+	// Reference foldings may contain pseudoknots, which are left out of
+	// the layout and drawn as dashed lines
+	for _, f := range foldings {
+		if len(f.f) != len(seq.Bases) {
+			continue
+		}
+		writePicture(plot.Structure(seq, f.f, opts), o.Name+"-"+f.name, *draw)
+	}
+
+	var layers []plot.Layer
+	if len(o.ReferenceFolding.Pairing) == len(seq.Bases) {
+		layers = append(layers, plot.Layer{Name: "Reference", Folding: o.ReferenceFolding.Pairing})
+	}
+	layers = append(layers,
+		plot.Layer{Name: "Example optimal", Folding: o.AllFoldings[0].Pairing, Below: len(layers) > 0},
+		plot.Layer{Name: "Safe pairs", Folding: o.SafePairs(), Below: len(layers) > 0})
+	for i := range layers {
+		layers[i].Color = plot.LayerColors[i]
+	}
+	writePicture(plot.ArcDiagram(seq, layers), o.Name+"-arcs", *draw)
+	writePicture(plot.CirclePlot(seq, layers), o.Name+"-circle", *draw)
+}
+
+func writeHeatmap(o *pipeline.OutputEntry) {
+	seq := base.SequenceFromString(o.Sequence)
+	pairs, free := plot.CountFractions(o.Safety.PairCount, o.Safety.FreeCount, o.Counts.SafeCompleteFoldings)
+	writePicture(plot.Heatmap(seq, pairs, free, o.ReferenceFolding.Pairing), o.Name+"-heatmap", *heatmap)
+}
@@ -0,0 +1,295 @@
+package main /* import "keltainen.duckdns.org/rnafolding/evalsafety" */
+
+import "encoding/json"
+import "fmt"
+import "io"
+import "log"
+import "math"
+import "math/big"
+import "math/rand"
+import "path"
+
+import "keltainen.duckdns.org/rnafolding/base"
+
+// Safety of a base against the fraction of optimal foldings in which it is
+// paired or free as in the reference, encoded as [safe, fraction].
+type safeCorrect struct {
+	safe bool
+	frac float64
+}
+
+func (s safeCorrect) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{s.safe, s.frac})
+}
+
+// Fraction of optimal foldings in which a pair or free base appears, and
+// whether it is in the reference, encoded as [fraction, correct, unknown
+// base].
+type fracToCorrect struct {
+	frac    float64
+	correct bool
+	unknown bool
+}
+
+func (f fracToCorrect) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{f.frac, f.correct, f.unknown})
+}
+
+// Agreement of the optimal foldings of rnafolding output with the
+// reference, as written to dump.json. Bases marked N in the sequence are
+// left out of the counts with NonN in their name.
+type bioResult struct {
+	Name string
+	// Fraction of foldings in which each base is paired or free as in
+	// the reference
+	PBaseCorrect     []float64
+	PFreeCorrect     []float64
+	PNonNFreeCorrect []float64
+	PPairCorrect     []float64
+	// Sums of the fraction of foldings agreeing and disagreeing with the
+	// reference, for safe and unsafe bases
+	SafeCorrectCount  [2][2]float64
+	SafeCorrectness   float64
+	UnsafeCorrectness float64
+	FreeSafeCorrect   []safeCorrect
+	PairSafeCorrect   []safeCorrect
+	// Each pair and free base in some folding
+	FracToCorrect []fracToCorrect
+
+	numFolds  *big.Int
+	safeBases float64
+}
+
+// bioCounts compares the optimal foldings of rnafolding output against the
+// reference, like bio-vs-safety.py did. Returns nil and logs the reason if
+// the output lacks the counts.
+func bioCounts(in *inputFile, ref *base.Sequence) *bioResult {
+	s := in.SafeComplete
+	if !countsValid(s, ref) {
+		return nil
+	}
+	if len(in.Sequence) != s.Bases || len(in.Safety.SafeBase) != s.Bases {
+		log.Printf("Error: %s has %d bases, sequence of %d bases and safety of %d bases",
+			ref.Name, s.Bases, len(in.Sequence), len(in.Safety.SafeBase))
+		return nil
+	}
+	reffold := ref.ReferenceFolding
+	frac := func(n *big.Int) float64 {
+		return divOrZero(n, s.NumFolds)
+	}
+	r := &bioResult{
+		Name:         in.Name,
+		PBaseCorrect: make([]float64, s.Bases),
+		numFolds:     s.NumFolds,
+		safeBases:    float64(in.Counts.SafeBases) / float64(s.Bases),
+	}
+	for i, j := range reffold {
+		unknown := in.Sequence[i] == 'N'
+		safe := in.Safety.SafeBase[i]
+		if j < 0 {
+			r.PBaseCorrect[i] = frac(s.Free[i])
+			r.PFreeCorrect = append(r.PFreeCorrect, r.PBaseCorrect[i])
+			if !unknown {
+				r.PNonNFreeCorrect = append(r.PNonNFreeCorrect, r.PBaseCorrect[i])
+				r.FreeSafeCorrect = append(r.FreeSafeCorrect, safeCorrect{safe, r.PBaseCorrect[i]})
+			}
+		} else if i < j {
+			r.PBaseCorrect[i] = frac(s.Pairs[i][j])
+			r.PPairCorrect = append(r.PPairCorrect, r.PBaseCorrect[i])
+			r.PairSafeCorrect = append(r.PairSafeCorrect, safeCorrect{safe, r.PBaseCorrect[i]})
+		} else {
+			r.PBaseCorrect[i] = frac(s.Pairs[j][i])
+		}
+
+		if unknown {
+			continue
+		}
+		row := 1
+		if safe {
+			row = 0
+		}
+		r.SafeCorrectCount[row][0] += r.PBaseCorrect[i]
+		r.SafeCorrectCount[row][1] += 1 - r.PBaseCorrect[i]
+	}
+	r.SafeCorrectness = floatPartOfSum(r.SafeCorrectCount[0][0], r.SafeCorrectCount[0][1])
+	r.UnsafeCorrectness = floatPartOfSum(r.SafeCorrectCount[1][0], r.SafeCorrectCount[1][1])
+
+	for i := 0; i < s.Bases; i++ {
+		if f := frac(s.Free[i]); f > 0 {
+			r.FracToCorrect = append(r.FracToCorrect, fracToCorrect{f, reffold[i] < 0, in.Sequence[i] == 'N'})
+		}
+		for j := i + 1; j < s.Bases; j++ {
+			if f := frac(s.Pairs[i][j]); f > 0 {
+				r.FracToCorrect = append(r.FracToCorrect, fracToCorrect{f, reffold[i] == j, false})
+			}
+		}
+	}
+	return r
+}
+
+func floatPartOfSum(a, b float64) float64 {
+	if a > 0 || b > 0 {
+		return a / (a + b)
+	}
+	return 0
+}
+
+// meanStd returns the mean and population standard deviation of vals, or
+// NaN for no values.
+func meanStd(vals []float64) (float64, float64) {
+	if len(vals) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+	}
+	mean := sum / float64(len(vals))
+	sq := 0.0
+	for _, v := range vals {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(vals)))
+}
+
+// writeBioStats writes stats.dat and dump.json, like bio-vs-safety.py did,
+// and fraccorrect.dat, like summarize-bio-safety.py did, with their
+// summaries to w, into outdir.
+func writeBioStats(w io.Writer, outdir string, results []*bioResult) {
+	f, err := createOutput(path.Join(outdir, "stats.dat"))
+	if err != nil {
+		log.Print(err)
+	} else {
+		out := io.MultiWriter(w, f)
+		io.WriteString(out, "# Name NumFoldings SafeBases BaseCorr SafeCorr UnsafeCorr\n")
+		for _, r := range results {
+			avg, _ := meanStd(r.PBaseCorrect)
+			fmt.Fprintf(out, "%6s %11d %9.6f %8.6f %8.6f %10.6f\n",
+				r.Name, r.numFolds, r.safeBases, avg, r.SafeCorrectness, r.UnsafeCorrectness)
+		}
+		f.Close()
+	}
+
+	if f, err := createOutput(path.Join(outdir, "dump.json")); err != nil {
+		log.Print(err)
+	} else {
+		e := json.NewEncoder(f)
+		e.SetIndent("", "  ")
+		if err := e.Encode(results); err != nil {
+			log.Printf("Failed to write dump.json: %v", err)
+		}
+		f.Close()
+	}
+
+	var ftc []fracToCorrect
+	var fsc, psc []safeCorrect
+	items := 0
+	for _, r := range results {
+		ftc = append(ftc, r.FracToCorrect...)
+		fsc = append(fsc, r.FreeSafeCorrect...)
+		psc = append(psc, r.PairSafeCorrect...)
+		items += len(r.PFreeCorrect) + len(r.PPairCorrect)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Fraction of predictions that match biological folding:")
+	for _, c := range []struct {
+		what  string
+		items []safeCorrect
+		safe  bool
+	}{
+		{"Free base, when predicted safe:    ", fsc, true},
+		{"Free base, when predicted non-safe:", fsc, false},
+		{"Pair, when predicted safe:         ", psc, true},
+		{"Pair, when predicted non-safe:     ", psc, false},
+	} {
+		var vals []float64
+		for _, s := range c.items {
+			if s.safe == c.safe {
+				vals = append(vals, s.frac)
+			}
+		}
+		avg, std := meanStd(vals)
+		fmt.Fprintf(w, "%s avg=%.4f stddev=%.4f\n", c.what, avg, std)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Fraction of correct predictions having probability between")
+	for p := 0; p <= 100; p += 5 {
+		pmin, pmax := float64(p)/100, float64(p+5)/100
+		a, as, nn, nns := correctBetween(ftc, pmin, pmax)
+		fmt.Fprintf(w, "%.2f %.2f %.4f %.4f %.4f %.4f\n", pmin, pmax, a, as, nn, nns)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Fraction of correct predictions having probability over")
+	for p := 0; p <= 100; p += 5 {
+		pmin := float64(p) / 100
+		a, as, nn, nns := correctBetween(ftc, pmin, 1.1)
+		fmt.Fprintf(w, "%.2f %.4f %.4f %.4f %.4f\n", pmin, a, as, nn, nns)
+	}
+
+	f, err = createOutput(path.Join(outdir, "fraccorrect.dat"))
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer f.Close()
+	// The shuffled columns are a baseline of fractions assigned at random,
+	// seeded to make the output repeatable
+	rnd := rand.New(rand.NewSource(1))
+	io.WriteString(f, "# P   CorrAt   StdDev NNCorrAt NNStdDev  CorrSum NNCorrSum Shuffled NNShuffled\n")
+	for p := 0; p <= 100; p++ {
+		pmin, pmax := float64(p)/100, float64(p+1)/100
+		a, as, nn, nns := correctBetween(ftc, pmin, pmax)
+		sum, nnSum := correctUpTo(ftc, pmin, items)
+		shuffled, nnShuffled := correctUpTo(shuffle(rnd, ftc), pmin, items)
+		fmt.Fprintf(f, "%-3d %8.6f %8.6f %8.6f %8.6f %8.6f %9.6f %8.6f %10.6f\n",
+			p, a, as, nn, nns, sum, nnSum, shuffled, nnShuffled)
+	}
+}
+
+// correctBetween returns the mean and standard deviation of correctness of
+// the predictions with fraction in [pmin, pmax), of all and of those not
+// on unknown bases.
+func correctBetween(ftc []fracToCorrect, pmin, pmax float64) (float64, float64, float64, float64) {
+	var all, nn []float64
+	for _, x := range ftc {
+		if x.frac < pmin || x.frac >= pmax {
+			continue
+		}
+		c := 0.0
+		if x.correct {
+			c = 1
+		}
+		all = append(all, c)
+		if !x.unknown {
+			nn = append(nn, c)
+		}
+	}
+	a, as := meanStd(all)
+	n, ns := meanStd(nn)
+	return a, as, n, ns
+}
+
+// correctUpTo returns the part of the items decided in the reference that
+// are predicted with fraction at most pmax, of all and of those not on
+// unknown bases.
+func correctUpTo(ftc []fracToCorrect, pmax float64, items int) (float64, float64) {
+	all, nn := 0, 0
+	for _, x := range ftc {
+		if x.frac <= pmax && x.correct {
+			all++
+			if !x.unknown {
+				nn++
+			}
+		}
+	}
+	return float64(all) / float64(items), float64(nn) / float64(items)
+}
+
+// shuffle returns ftc with the fractions shuffled among the predictions.
+func shuffle(rnd *rand.Rand, ftc []fracToCorrect) []fracToCorrect {
+	out := append([]fracToCorrect(nil), ftc...)
+	rnd.Shuffle(len(out), func(i, j int) { out[i].frac, out[j].frac = out[j].frac, out[i].frac })
+	return out
+}
@@ -0,0 +1,447 @@
+package main /* import "keltainen.duckdns.org/rnafolding/evalsafety" */
+
+import "encoding/json"
+import "flag"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "log"
+import "math/big"
+import "os"
+import "path"
+import "strings"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/subopt"
+
+var (
+	indir     = flag.String("in", "", "Directory containing JSON output files of compare-safety-runner.py or rnafolding")
+	refdir    = flag.String("ref", "", "Directory containing JSON reference folding files, as written by fastadump. Not needed for rnafolding output")
+	suboptdir = flag.String("subopt", "", "Directory containing RNAsubopt output files, used for input files without RNAsubopt counts")
+	outdir    = flag.String("out", "", "Directory for output files")
+)
+
+// Output of comparesafety -json and trivialsafety, with resource usage
+// added by compare-safety-runner.py
+type safetyCounts struct {
+	Name      string
+	Bases     int
+	NumFolds  *big.Int
+	NumPairs  int
+	Pairs     [][]*big.Int
+	Free      []*big.Int
+	Sample    folding.FoldingPairs
+	Resources map[string]float64
+}
+
+type inputFile struct {
+	// Written by compare-safety-runner.py
+	RNAsubopt       *safetyCounts
+	RNAsuboptSingle *safetyCounts
+	SafeComplete    *safetyCounts
+	SingleMaxPairs  *safetyCounts
+
+	// Written by rnafolding
+	Name             string
+	Sequence         string
+	ReferenceFolding struct {
+		Pairing folding.FoldingPairs
+	}
+	Counts struct {
+		SequenceBases        int
+		OptimalPairs         int
+		SafeCompleteFoldings *big.Int
+		SafeBases            int
+	}
+	AllFoldings []struct {
+		Pairing folding.FoldingPairs
+	}
+	Safety struct {
+		SafeBase  []bool
+		PairCount [][]*big.Int
+		FreeCount []*big.Int
+	}
+}
+
+type fileResult struct {
+	name           string
+	mfe            *hits
+	mfeSingle      *hits
+	maxPairs       *hits
+	maxPairsSingle *hits
+	in             *inputFile
+}
+
+// float returns v as a float, or nil if it is missing.
+func float(v *big.Int) *float64 {
+	if v == nil {
+		return nil
+	}
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return &f
+}
+
+// average returns the average of the values get returns for the results,
+// leaving out missing ones.
+func average(results []fileResult, name string, get func(fileResult) *float64) float64 {
+	sum, n := 0.0, 0
+	for _, r := range results {
+		if v := get(r); v != nil {
+			sum += *v
+			n++
+		}
+	}
+	if n == 0 {
+		log.Printf("No values to average for %s", name)
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func main() {
+	flag.Parse()
+
+	if *indir == "" || *outdir == "" {
+		fmt.Print("Please set the input and output directories with --in and --out flags")
+		return
+	}
+	evaluate(os.Stdout, *indir, *refdir, *suboptdir, *outdir)
+}
+
+// listNames maps the base names of the files in dir to their file names.
+func listNames(dir string) map[string]string {
+	ff, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("Unable to list directory %v: %v", dir, err)
+	}
+	names := make(map[string]string)
+	for _, f := range ff {
+		names[baseName(f.Name())] = f.Name()
+	}
+	return names
+}
+
+// evaluate compares the files in indir against their reference foldings,
+// read from refdir unless the files contain them, writes the tables to
+// outdir and summarises them to w. RNAsubopt counts missing from the input
+// files are counted from the RNAsubopt output in suboptdir, if it is set.
+func evaluate(w io.Writer, indir, refdir, suboptdir, outdir string) {
+	ff, err := ioutil.ReadDir(indir)
+	if err != nil {
+		log.Fatalf("Unable to list directory %v: %v", indir, err)
+	}
+	var refnames, suboptnames map[string]string
+	if refdir != "" {
+		refnames = listNames(refdir)
+	}
+	if suboptdir != "" {
+		suboptnames = listNames(suboptdir)
+	}
+	rnatype := path.Base(path.Clean(indir))
+
+	var results []fileResult
+	var bio []*bioResult
+	totals := map[string]*hits{
+		"MFE":            newHits(),
+		"MFESingle":      newHits(),
+		"MaxPairs":       newHits(),
+		"MaxPairsSingle": newHits(),
+	}
+	for _, f := range ff {
+		in := &inputFile{}
+		if err := readJSON(path.Join(indir, f.Name()), in); err != nil {
+			log.Print(err)
+			continue
+		}
+		if sname, ok := suboptnames[baseName(f.Name())]; ok && in.RNAsubopt == nil {
+			if in.RNAsubopt, err = readSubopt(path.Join(suboptdir, sname)); err != nil {
+				log.Print(err)
+			}
+		}
+		ref := &base.Sequence{}
+		fromRNA := in.SafeComplete == nil && in.Counts.SafeCompleteFoldings != nil
+		if fromRNA {
+			// rnafolding output contains its own reference folding
+			fromRNAFolding(in)
+			ref.Name = in.Name
+			ref.ReferenceFolding = in.ReferenceFolding.Pairing
+		} else {
+			refname, ok := refnames[baseName(f.Name())]
+			if !ok {
+				log.Printf("Error: no reference folding file found for %s", f.Name())
+				continue
+			}
+			if err := readJSON(path.Join(refdir, refname), ref); err != nil {
+				log.Print(err)
+				continue
+			}
+		}
+		if ref.ReferenceFolding == nil {
+			log.Printf("Error: %s lacks a reference folding", f.Name())
+			continue
+		}
+
+		r := fileResult{
+			name:           ref.Name,
+			mfe:            hitCounts(in.RNAsubopt, ref),
+			mfeSingle:      singleHitCounts(in.RNAsuboptSingle, ref),
+			maxPairs:       hitCounts(in.SafeComplete, ref),
+			maxPairsSingle: pairArrayHitCounts(in.SingleMaxPairs, ref),
+			in:             in,
+		}
+		totals["MFE"].add(r.mfe)
+		totals["MFESingle"].add(r.mfeSingle)
+		totals["MaxPairs"].add(r.maxPairs)
+		totals["MaxPairsSingle"].add(r.maxPairsSingle)
+		results = append(results, r)
+		if fromRNA {
+			if b := bioCounts(in, ref); b != nil {
+				bio = append(bio, b)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "Total: safety as predictor of decision correctness")
+	fmt.Fprintln(w, "                     Precision   Recall SafeDeci NumFoldings TruePositive TrueNegative FalsePositive FalseNegative")
+	fmt.Fprintln(w, "Minimum free energy: "+totals["MFE"].String())
+	fmt.Fprintln(w, "Single MFE:          "+totals["MFESingle"].String())
+	fmt.Fprintln(w, "Maximum pairs:       "+totals["MaxPairs"].String())
+	fmt.Fprintln(w, "Max pairs single:    "+totals["MaxPairsSingle"].String())
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Resources taken (average)")
+	fmt.Fprintln(w, "                      CPU-User  CPU-Sys  Mem(kB)")
+	for _, res := range []struct {
+		what           string
+		user, sys, mem string
+		get            func(fileResult) *safetyCounts
+	}{
+		{"ViennaRNA RNAsubopt: ", "RNAsuboptUser", "RNAsuboptSys", "RNAsuboptRSS", func(r fileResult) *safetyCounts { return r.in.RNAsubopt }},
+		{"Trivial safety:      ", "TrivialSafetyUser", "TrivialSafetySys", "TrivialSafetyRSS", func(r fileResult) *safetyCounts { return r.in.RNAsubopt }},
+		{"Safe & Complete:     ", "User", "Sys", "RSS", func(r fileResult) *safetyCounts { return r.in.SafeComplete }},
+		{"Single Maximum Pairs:", "User", "Sys", "RSS", func(r fileResult) *safetyCounts { return r.in.SingleMaxPairs }},
+	} {
+		avg := func(name string) float64 {
+			return average(results, name, func(r fileResult) *float64 { return resource(res.get(r), name) })
+		}
+		fmt.Fprintf(w, "%s %8.2f %8.2f %8.0f\n", res.what, avg(res.user), avg(res.sys), avg(res.mem))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Average counts:   Bases MaxPairs RNAsuboptFoldings SafeCompleteFoldings")
+	fmt.Fprintf(w, "                %7.1f %8.1f %17.1f %20.1f\n",
+		average(results, "Bases", func(r fileResult) *float64 {
+			if r.in.SafeComplete == nil {
+				return nil
+			}
+			v := float64(r.in.SafeComplete.Bases)
+			return &v
+		}),
+		average(results, "MaxPairs", func(r fileResult) *float64 {
+			if r.in.SafeComplete == nil {
+				return nil
+			}
+			v := float64(r.in.SafeComplete.NumPairs)
+			return &v
+		}),
+		average(results, "RNAsuboptFoldings", func(r fileResult) *float64 { return float(numFolds(r.in.RNAsubopt)) }),
+		average(results, "SafeCompleteFoldings", func(r fileResult) *float64 { return float(numFolds(r.in.SafeComplete)) }))
+
+	writePrecisionRecall(results, path.Join(outdir, rnatype+"-precision-recall-mfe.dat"), func(r fileResult) *hits { return r.mfe })
+	writePrecisionRecall(results, path.Join(outdir, rnatype+"-precision-recall-mfe-single.dat"), func(r fileResult) *hits { return r.mfeSingle })
+	writePrecisionRecall(results, path.Join(outdir, rnatype+"-precision-recall-maxpairs.dat"), func(r fileResult) *hits { return r.maxPairs })
+	writePrecisionRecall(results, path.Join(outdir, rnatype+"-precision-recall-maxpairs-single.dat"), func(r fileResult) *hits { return r.maxPairsSingle })
+	writeResources(results, path.Join(outdir, rnatype+"-resources.dat"))
+	writeCounts(results, path.Join(outdir, rnatype+"-counts.dat"))
+	if len(bio) > 0 {
+		fmt.Fprintln(w)
+		writeBioStats(w, outdir, bio)
+	}
+}
+
+func baseName(fname string) string {
+	return strings.SplitN(fname, ".", 2)[0]
+}
+
+func readJSON(fname string, v interface{}) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("Unable to open file \"%s\": %v", fname, err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("Error reading JSON file \"%s\": %v", fname, err)
+	}
+	return nil
+}
+
+func fromRNAFolding(in *inputFile) {
+	in.SafeComplete = &safetyCounts{
+		Name:     in.Name,
+		Bases:    in.Counts.SequenceBases,
+		NumFolds: in.Counts.SafeCompleteFoldings,
+		NumPairs: in.Counts.OptimalPairs,
+		Pairs:    in.Safety.PairCount,
+		Free:     in.Safety.FreeCount,
+	}
+	if len(in.AllFoldings) > 0 {
+		in.SingleMaxPairs = &safetyCounts{
+			Name:     in.Name,
+			Bases:    in.Counts.SequenceBases,
+			NumFolds: big.NewInt(1),
+			NumPairs: in.Counts.OptimalPairs,
+			Sample:   in.AllFoldings[0].Pairing,
+		}
+	}
+}
+
+// readSubopt counts how often each base is paired or free in the foldings
+// of the first record of an RNAsubopt output file, reading one structure
+// at a time.
+func readSubopt(fname string) (*safetyCounts, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file \"%s\": %v", fname, err)
+	}
+	defer f.Close()
+	r := subopt.NewReader(f)
+	rec, err := r.NextRecord()
+	if err == io.EOF {
+		return nil, fmt.Errorf("No RNAsubopt output in \"%s\"", fname)
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading RNAsubopt output \"%s\": %v", fname, err)
+	}
+	n := len(rec.Seq.Bases)
+	s := &safetyCounts{
+		Name:     rec.Seq.Name,
+		Bases:    n,
+		NumFolds: new(big.Int),
+		Pairs:    make([][]*big.Int, n),
+		Free:     make([]*big.Int, n),
+	}
+	for i := range s.Pairs {
+		s.Pairs[i] = make([]*big.Int, n)
+		for j := range s.Pairs[i] {
+			s.Pairs[i][j] = new(big.Int)
+		}
+		s.Free[i] = new(big.Int)
+	}
+	one := big.NewInt(1)
+	for {
+		st, err := r.NextStructure()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error reading RNAsubopt output \"%s\": %v", fname, err)
+		}
+		if st.Folding == nil {
+			continue
+		}
+		s.NumFolds.Add(s.NumFolds, one)
+		pairs := 0
+		for i, j := range st.Folding {
+			if j < 0 {
+				s.Free[i].Add(s.Free[i], one)
+			} else if i < j {
+				s.Pairs[i][j].Add(s.Pairs[i][j], one)
+				pairs++
+			}
+		}
+		if pairs > s.NumPairs {
+			s.NumPairs = pairs
+		}
+	}
+	return s, nil
+}
+
+func createOutput(fname string) (*os.File, error) {
+	f, err := os.Create(fname)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open %s for writing: %v", fname, err)
+	}
+	return f, nil
+}
+
+func writePrecisionRecall(results []fileResult, fname string, get func(fileResult) *hits) {
+	f, err := createOutput(fname)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, "# Name       Precision   Recall SafeDeci NumFoldings TruePositive TrueNegative FalsePositive FalseNegative\n")
+	for _, r := range results {
+		fmt.Fprintf(f, "%-12s %s\n", r.name, get(r))
+	}
+}
+
+func resource(s *safetyCounts, name string) *float64 {
+	if s == nil || s.Resources == nil {
+		return nil
+	}
+	v, ok := s.Resources[name]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func numFolds(s *safetyCounts) *big.Int {
+	if s == nil {
+		return nil
+	}
+	return s.NumFolds
+}
+
+func writeResources(results []fileResult, fname string) {
+	f, err := createOutput(fname)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, "# Name       RNAsuboptUser RNAsuboptSys RNAsuboptMem RNAsuboptNum TrivialUser TrivialSys TrivialMem  SCUser   SCSys   SCMem    SCNum SingleUser SingleSys SingleMem\n")
+	for _, r := range results {
+		vf := r.in.RNAsubopt
+		sc := r.in.SafeComplete
+		smp := r.in.SingleMaxPairs
+		cols := []string{
+			fmt.Sprintf("%-12s", r.name),
+			floatCol(13, 2, resource(vf, "RNAsuboptUser")),
+			floatCol(12, 2, resource(vf, "RNAsuboptSys")),
+			floatCol(12, 0, resource(vf, "RNAsuboptRSS")),
+			intCol(12, numFolds(vf)),
+			floatCol(11, 2, resource(vf, "TrivialSafetyUser")),
+			floatCol(10, 2, resource(vf, "TrivialSafetySys")),
+			floatCol(10, 0, resource(vf, "TrivialSafetyRSS")),
+			floatCol(8, 2, resource(sc, "User")),
+			floatCol(8, 2, resource(sc, "Sys")),
+			floatCol(8, 0, resource(sc, "RSS")),
+			intCol(8, numFolds(sc)),
+			floatCol(10, 2, resource(smp, "User")),
+			floatCol(9, 2, resource(smp, "Sys")),
+			floatCol(9, 0, resource(smp, "RSS")),
+		}
+		io.WriteString(f, strings.Join(cols, " ")+"\n")
+	}
+}
+
+func writeCounts(results []fileResult, fname string) {
+	f, err := createOutput(fname)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, "# Name       Bases MaxPairs RNAsuboptFoldings SafeCompleteFoldings\n")
+	for _, r := range results {
+		sc := r.in.SafeComplete
+		cols := []string{fmt.Sprintf("%-12s", r.name), na(5), na(8)}
+		if sc != nil {
+			cols = []string{fmt.Sprintf("%-12s", r.name), fmt.Sprintf("%5d", sc.Bases), fmt.Sprintf("%8d", sc.NumPairs)}
+		}
+		cols = append(cols, intCol(17, numFolds(r.in.RNAsubopt)), intCol(20, numFolds(sc)))
+		io.WriteString(f, strings.Join(cols, " ")+"\n")
+	}
+}
@@ -0,0 +1,124 @@
+package main /* import "keltainen.duckdns.org/rnafolding/evalsafety" */
+
+import "bytes"
+import "io/ioutil"
+import "path"
+import "reflect"
+import "strings"
+import "testing"
+
+// runEvaluate runs evaluate on the input directories in testdata and
+// returns its summary and output directory.
+func runEvaluate(t *testing.T, in, ref, sub string) (string, string) {
+	testdata := func(dir string) string {
+		if dir == "" {
+			return ""
+		}
+		return path.Join("testdata", dir)
+	}
+	out := t.TempDir()
+	var w bytes.Buffer
+	evaluate(&w, testdata(in), testdata(ref), testdata(sub), out)
+	return w.String(), out
+}
+
+// datRows returns the fields of the rows of a .dat file, leaving out the
+// header.
+func datRows(t *testing.T, dir, fname string) [][]string {
+	d, err := ioutil.ReadFile(path.Join(dir, fname))
+	if err != nil {
+		t.Fatalf("Reading %s: %v", fname, err)
+	}
+	var rows [][]string
+	for _, l := range strings.Split(strings.TrimSpace(string(d)), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			rows = append(rows, strings.Fields(l))
+		}
+	}
+	return rows
+}
+
+func checkRows(t *testing.T, dir, fname string, expected [][]string) {
+	if rows := datRows(t, dir, fname); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("%s: expected rows %v, got %v", fname, expected, rows)
+	}
+}
+
+func naFields(n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		out = append(out, "NA")
+	}
+	return out
+}
+
+func TestRNAFoldingOutput(t *testing.T) {
+	_, dir := runEvaluate(t, "rnafolding", "", "")
+	// Pair (0, 4) is safe and correct, pair (1, 3) and free base 2 are
+	// correct in one of two foldings, pair (2, 3) and free base 1 are
+	// wrong in one of them
+	checkRows(t, dir, "rnafolding-precision-recall-maxpairs.dat", [][]string{
+		{"tiny", "1.0000", "0.5000", "0.3333", "2", "2", "2", "0", "2"},
+	})
+	// The example folding has pair (0, 4) right, and free base 1 and pair
+	// (2, 3) wrong, out of 3 decisions in the reference
+	checkRows(t, dir, "rnafolding-precision-recall-maxpairs-single.dat", [][]string{
+		{"tiny", "0.3333", "0.3333", "1.0000", "1", "1", "0", "2", "2"},
+	})
+	checkRows(t, dir, "rnafolding-precision-recall-mfe.dat", [][]string{append([]string{"tiny"}, naFields(8)...)})
+	checkRows(t, dir, "rnafolding-counts.dat", [][]string{{"tiny", "5", "2", "NA", "2"}})
+
+	// Bases 0 and 4 are safe and always correct, bases 1 and 3 are correct
+	// in half of the foldings, base 2 is unknown
+	checkRows(t, dir, "stats.dat", [][]string{{"tiny", "2", "0.400000", "0.700000", "1.000000", "0.500000"}})
+	if _, err := ioutil.ReadFile(path.Join(dir, "dump.json")); err != nil {
+		t.Errorf("Reading dump.json: %v", err)
+	}
+	// Predictions in some folding: pair (0, 4) in all of them and correct,
+	// free bases 1 and 2 and pairs (1, 3) and (2, 3) in half of them, with
+	// free base 2 and pair (1, 3) correct. Base 2 is unknown. There are
+	// three decisions in the reference
+	rows := datRows(t, dir, "fraccorrect.dat")
+	if len(rows) != 101 {
+		t.Fatalf("fraccorrect.dat: expected 101 rows, got %d", len(rows))
+	}
+	if expected := []string{"50", "0.500000", "0.500000", "0.333333", "0.471405", "0.666667", "0.333333"}; !reflect.DeepEqual(rows[50][:7], expected) {
+		t.Errorf("fraccorrect.dat: expected row 50 to start with %v, got %v", expected, rows[50])
+	}
+	if expected := []string{"100", "1.000000", "0.000000", "1.000000", "0.000000", "1.000000", "0.666667", "1.000000", "0.666667"}; !reflect.DeepEqual(rows[100], expected) {
+		t.Errorf("fraccorrect.dat: expected row 100 %v, got %v", expected, rows[100])
+	}
+}
+
+func TestRunnerOutput(t *testing.T) {
+	summary, dir := runEvaluate(t, "runner", "ref", "")
+	// broken lacks pair counts and the safe and complete counts of tiny
+	// lack the number of foldings, so they are left out
+	checkRows(t, dir, "runner-precision-recall-mfe.dat", [][]string{
+		append([]string{"broken"}, naFields(8)...),
+		{"tiny", "1.0000", "0.5000", "0.3333", "2", "2", "2", "0", "2"},
+	})
+	checkRows(t, dir, "runner-precision-recall-maxpairs.dat", [][]string{
+		append([]string{"broken"}, naFields(8)...),
+		append([]string{"tiny"}, naFields(8)...),
+	})
+	for _, line := range []string{
+		"Minimum free energy:    1.0000   0.5000   0.3333           2            2            2             0             2",
+		"ViennaRNA RNAsubopt:      1.50     0.50     2000",
+		"Safe & Complete:          0.25     0.25     1000",
+		"                    5.0      2.0               1.5                  0.0",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("Summary lacks line %q:\n%s", line, summary)
+		}
+	}
+}
+
+func TestSuboptOutput(t *testing.T) {
+	_, dir := runEvaluate(t, "rnafolding", "", "subopt")
+	// RNAsubopt lists the same two foldings as rnafolding
+	checkRows(t, dir, "rnafolding-precision-recall-mfe.dat", [][]string{
+		{"tiny", "1.0000", "0.5000", "0.3333", "2", "2", "2", "0", "2"},
+	})
+	checkRows(t, dir, "rnafolding-counts.dat", [][]string{{"tiny", "5", "2", "2", "2"}})
+}
@@ -0,0 +1,237 @@
+package main /* import "keltainen.duckdns.org/rnafolding/evalsafety" */
+
+import "fmt"
+import "log"
+import "math/big"
+import "strings"
+
+import "keltainen.duckdns.org/rnafolding/base"
+
+// Decision counts of safe vs. reference. Safe decisions (bases left free or
+// pairs made in every folding) are positives, others are negatives.
+type hits struct {
+	tp        *big.Int
+	tn        *big.Int
+	fp        *big.Int
+	fn        *big.Int
+	safe      *big.Int
+	decisions *big.Int
+	folds     *big.Int
+}
+
+func newHits() *hits {
+	return &hits{new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int)}
+}
+
+func (h *hits) add(o *hits) {
+	if o == nil {
+		return
+	}
+	h.tp.Add(h.tp, o.tp)
+	h.tn.Add(h.tn, o.tn)
+	h.fp.Add(h.fp, o.fp)
+	h.fn.Add(h.fn, o.fn)
+	h.safe.Add(h.safe, o.safe)
+	h.decisions.Add(h.decisions, o.decisions)
+	h.folds.Add(h.folds, o.folds)
+}
+
+func (h *hits) String() string {
+	if h == nil {
+		return strings.Join([]string{na(9), na(8), na(8), na(11), na(12), na(12), na(13), na(13)}, " ")
+	}
+	return fmt.Sprintf("%9.4f %8.4f %8.4f %11d %12d %12d %13d %13d",
+		partOfSum(h.tp, h.fp), partOfSum(h.tp, h.fn), divOrZero(h.safe, h.decisions),
+		h.folds, h.tp, h.tn, h.fp, h.fn)
+}
+
+func divOrZero(a, b *big.Int) float64 {
+	if b.Sign() == 0 {
+		if a.Sign() != 0 {
+			log.Printf("Error: tried to divide %v / %v", a, b)
+		}
+		return 0
+	}
+	f, _ := new(big.Rat).SetFrac(a, b).Float64()
+	return f
+}
+
+func partOfSum(a, b *big.Int) float64 {
+	if a.Sign() == 0 {
+		return 0
+	}
+	return divOrZero(a, new(big.Int).Add(a, b))
+}
+
+func na(width int) string {
+	return fmt.Sprintf("%*s", width, "NA")
+}
+
+func intCol(width int, v *big.Int) string {
+	if v == nil {
+		return na(width)
+	}
+	return fmt.Sprintf("%*d", width, v)
+}
+
+func floatCol(width, prec int, v *float64) string {
+	if v == nil {
+		return na(width)
+	}
+	return fmt.Sprintf("%*.*f", width, prec, *v)
+}
+
+func lengthsMatch(s *safetyCounts, ref *base.Sequence, l int, what string) bool {
+	if s.Bases != len(ref.ReferenceFolding) || s.Bases != l {
+		log.Printf("Error: %s has %d bases, reference folding of %d bases and %s of %d bases",
+			ref.Name, s.Bases, len(ref.ReferenceFolding), what, l)
+		return false
+	}
+	return true
+}
+
+// countsValid tells whether s has the number of foldings and a count for
+// each pair and free base of the reference, logging the reason if not.
+// Skipped and aborted runs lack the counts.
+func countsValid(s *safetyCounts, ref *base.Sequence) bool {
+	if !lengthsMatch(s, ref, len(s.Free), "free array") {
+		return false
+	}
+	if s.NumFolds == nil {
+		log.Printf("Error: %s lacks the number of foldings", ref.Name)
+		return false
+	}
+	if len(s.Pairs) != s.Bases {
+		log.Printf("Error: %s has %d bases and pair array of %d bases", ref.Name, s.Bases, len(s.Pairs))
+		return false
+	}
+	for i := 0; i < s.Bases; i++ {
+		if len(s.Pairs[i]) != s.Bases {
+			log.Printf("Error: %s has %d bases and pair array row %d of %d bases", ref.Name, s.Bases, i, len(s.Pairs[i]))
+			return false
+		}
+		if s.Free[i] == nil {
+			log.Printf("Error: %s lacks the free count of base %d", ref.Name, i)
+			return false
+		}
+		for j := i + 1; j < s.Bases; j++ {
+			if s.Pairs[i][j] == nil {
+				log.Printf("Error: %s lacks the count of pair (%d, %d)", ref.Name, i, j)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func referenceDecisions(ref *base.Sequence) *big.Int {
+	n := int64(0)
+	for i, j := range ref.ReferenceFolding {
+		if j < 0 || i < j {
+			n++
+		}
+	}
+	return big.NewInt(n)
+}
+
+// Safety of all foldings: each pair and free base counts as many
+// decisions as there are foldings containing it.
+func hitCounts(s *safetyCounts, ref *base.Sequence) *hits {
+	if s == nil || !countsValid(s, ref) {
+		return nil
+	}
+	h := newHits()
+	h.folds.Set(s.NumFolds)
+	classify := func(n *big.Int, correct bool) {
+		h.decisions.Add(h.decisions, n)
+		if n.Cmp(s.NumFolds) == 0 {
+			h.safe.Add(h.safe, n)
+			if correct {
+				h.tp.Add(h.tp, n)
+			} else {
+				h.fp.Add(h.fp, n)
+			}
+		} else if correct {
+			h.fn.Add(h.fn, n)
+		} else {
+			h.tn.Add(h.tn, n)
+		}
+	}
+	for i := 0; i < s.Bases; i++ {
+		for j := i + 1; j < s.Bases; j++ {
+			classify(s.Pairs[i][j], ref.ReferenceFolding[i] == j)
+		}
+		classify(s.Free[i], ref.ReferenceFolding[i] < 0)
+	}
+	return h
+}
+
+// Single folding given as safety counts: all its decisions are considered
+// safe.
+func singleHitCounts(s *safetyCounts, ref *base.Sequence) *hits {
+	if s == nil || !countsValid(s, ref) {
+		return nil
+	}
+	correct := new(big.Int)
+	bad := new(big.Int)
+	predicted := new(big.Int)
+	classify := func(n *big.Int, isCorrect bool) {
+		predicted.Add(predicted, n)
+		if isCorrect {
+			correct.Add(correct, n)
+		} else {
+			bad.Add(bad, n)
+		}
+	}
+	for i := 0; i < s.Bases; i++ {
+		for j := i + 1; j < s.Bases; j++ {
+			classify(s.Pairs[i][j], ref.ReferenceFolding[i] == j)
+		}
+		classify(s.Free[i], ref.ReferenceFolding[i] < 0)
+	}
+	return &hits{
+		tp:        correct,
+		tn:        new(big.Int),
+		fp:        bad,
+		fn:        new(big.Int).Sub(referenceDecisions(ref), correct),
+		safe:      predicted,
+		decisions: new(big.Int).Set(predicted),
+		folds:     new(big.Int).Set(s.NumFolds),
+	}
+}
+
+// Single sample folding: all its decisions are considered safe.
+func pairArrayHitCounts(s *safetyCounts, ref *base.Sequence) *hits {
+	if s == nil || !lengthsMatch(s, ref, len(s.Sample), "sample folding") {
+		return nil
+	}
+	correct := int64(0)
+	bad := int64(0)
+	predicted := int64(0)
+	for i, j := range s.Sample {
+		if j < 0 {
+			predicted++
+			if ref.ReferenceFolding[i] < 0 {
+				correct++
+			} else {
+				bad++
+			}
+		} else if i < j {
+			predicted++
+			if ref.ReferenceFolding[i] == j {
+				correct++
+			} else {
+				bad++
+			}
+		}
+	}
+	return &hits{
+		tp:        big.NewInt(correct),
+		tn:        new(big.Int),
+		fp:        big.NewInt(bad),
+		fn:        new(big.Int).Sub(referenceDecisions(ref), big.NewInt(correct)),
+		safe:      big.NewInt(predicted),
+		decisions: big.NewInt(predicted),
+		folds:     big.NewInt(1),
+	}
+}
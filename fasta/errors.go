@@ -0,0 +1,53 @@
+package fasta /* import "keltainen.duckdns.org/rnafolding/fasta" */
+
+import "fmt"
+import "strings"
+
+// BracketError tells that a dot-bracket folding has a bracket without a
+// matching pair.
+type BracketError struct {
+	Pos  int
+	Char rune
+}
+
+func (e *BracketError) Error() string {
+	return fmt.Sprintf("unmatched '%c' at position %d", e.Char, e.Pos)
+}
+
+// LengthError tells that a sequence and its folding are of different
+// lengths.
+type LengthError struct {
+	Bases   int
+	Folding int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("sequence of %d bases has folding of %d bases", e.Bases, e.Folding)
+}
+
+// FoldingError tells that the reference folding of a sequence could not be
+// read. The sequence itself is still returned, without reference folding.
+type FoldingError struct {
+	Name string
+	Err  error
+}
+
+func (e *FoldingError) Error() string {
+	return fmt.Sprintf("reference folding of %s: %v", e.Name, e.Err)
+}
+
+func (e *FoldingError) Unwrap() error {
+	return e.Err
+}
+
+// FoldingErrors lists the sequences of a multiple sequence file whose
+// reference foldings could not be read.
+type FoldingErrors []*FoldingError
+
+func (e FoldingErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
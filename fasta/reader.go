@@ -1,15 +1,18 @@
 package fasta /* import "keltainen.duckdns.org/rnafolding/fasta" */
 
 import "bufio"
-import "fmt"
 import "io"
-import "log"
+import "os"
+import "sort"
 import "strings"
 import "unicode"
 
 import "keltainen.duckdns.org/rnafolding/base"
 import "keltainen.duckdns.org/rnafolding/folding"
 
+// ReadSequence reads one sequence and its reference folding, if there is
+// one. If only the folding is invalid, returns the sequence without it and
+// a FoldingError.
 func ReadSequence(r io.Reader) (*base.Sequence, error) {
 	br := bufio.NewReader(r)
 	seq, err := readSingleSequence(br)
@@ -19,23 +22,53 @@ func ReadSequence(r io.Reader) (*base.Sequence, error) {
 	return seq, err
 }
 
+// ReadMultiSequence reads all sequences in r. Sequences with invalid
+// reference foldings are returned without them, and listed in a
+// FoldingErrors error after all sequences have been read.
 func ReadMultiSequence(r io.Reader) (map[string]*base.Sequence, error) {
 	br := bufio.NewReader(r)
 	ret := make(map[string]*base.Sequence)
+	var foldingErrs FoldingErrors
 	for {
 		seq, err := readSingleSequence(br)
 		if seq != nil {
 			ret[seq.Name] = seq
 		}
-		if err == io.EOF {
+		if fe, ok := err.(*FoldingError); ok {
+			foldingErrs = append(foldingErrs, fe)
+		} else if err == io.EOF {
 			break
 		} else if err != nil {
 			return ret, err
 		}
 	}
+	if len(foldingErrs) > 0 {
+		return ret, foldingErrs
+	}
 	return ret, nil
 }
 
+// ReadMultiSequenceFile reads all sequences in the named file, sorted by
+// name, which is the order of chromosomes in sorted BED and bedGraph
+// files. Invalid reference foldings are handled as in ReadMultiSequence.
+func ReadMultiSequenceFile(fname string) ([]*base.Sequence, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	seqs, err := ReadMultiSequence(f)
+	if _, ok := err.(FoldingErrors); err != nil && !ok {
+		return nil, err
+	}
+	var out []*base.Sequence
+	for _, seq := range seqs {
+		out = append(out, seq)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, err
+}
+
 func readSingleSequence(br *bufio.Reader) (*base.Sequence, error) {
 	read, err := br.ReadString('\n')
 	read = strings.TrimSpace(read)
@@ -113,11 +146,16 @@ func readSingleSequence(br *bufio.Reader) (*base.Sequence, error) {
 				return seq, err
 			}
 		}
-		seq.ReferenceFolding = DbToFold(dotbracket)
+		seq.ReferenceFolding, err = DbToFold(dotbracket)
+		if err != nil {
+			return seq, &FoldingError{Name: seq.Name, Err: err}
+		}
 	}
 
 	if len(seq.ReferenceFolding) > 0 && len(seq.Bases) != len(seq.ReferenceFolding) {
-		log.Printf("Sequence and its folding are different lengths. Bases: %v, folding: %v", seq.Bases, seq.ReferenceFolding)
+		err = &LengthError{Bases: len(seq.Bases), Folding: len(seq.ReferenceFolding)}
+		seq.ReferenceFolding = nil
+		return seq, &FoldingError{Name: seq.Name, Err: err}
 	}
 	return seq, nil
 }
@@ -151,26 +189,29 @@ func toEndChar(c rune) rune {
 	return ' '
 }
 
-func getWithType(stack []Ref, c rune) (int, []Ref, error) {
+func getWithType(stack []Ref, c rune) (int, []Ref, bool) {
 	for i := len(stack) - 1; i >= 0; i-- {
 		if stack[i].typ == c {
 			if i == len(stack)-1 {
-				return stack[i].pos, stack[:len(stack)-1], nil
+				return stack[i].pos, stack[:len(stack)-1], true
 			} else if i == 0 {
-				return stack[i].pos, stack[1:], nil
+				return stack[i].pos, stack[1:], true
 			} else {
 				// Grab the .pos before the stack is modified
 				r := stack[i].pos
-				return r, append(stack[:i], stack[i+1:]...), nil
+				return r, append(stack[:i], stack[i+1:]...), true
 			}
 		}
 	}
-	return 0, stack, fmt.Errorf("Didn't find matching pair for '%c' (%v) in %v", c, c, stack)
+	return 0, stack, false
 }
 
-func DbToFold(s string) folding.FoldingPairs {
+// DbToFold converts a dot-bracket folding, which may contain pseudoknots
+// marked with different kinds of brackets, to pair array. Returns a
+// BracketError if a bracket has no matching pair.
+func DbToFold(s string) (folding.FoldingPairs, error) {
 	if s == "" {
-		return nil
+		return nil, nil
 	}
 	var stack []Ref
 	fold := make(folding.FoldingPairs, len(s))
@@ -181,17 +222,17 @@ func DbToFold(s string) folding.FoldingPairs {
 			stack = append(stack, Ref{i, ec})
 		} else {
 			var j int
-			var err error
-			j, stack, err = getWithType(stack, c)
-			if err != nil {
-				log.Printf("Error at char %d: %v", i, err)
+			var ok bool
+			j, stack, ok = getWithType(stack, c)
+			if !ok {
+				return nil, &BracketError{Pos: i, Char: c}
 			}
 			fold[i] = j
 			fold[j] = i
 		}
 	}
 	if len(stack) > 0 {
-		log.Printf("Stack not empty at end of parsing folding. Stack: %v", stack)
+		return nil, &BracketError{Pos: stack[0].pos, Char: rune(s[stack[0].pos])}
 	}
-	return fold
+	return fold, nil
 }
@@ -4,6 +4,8 @@ import "testing"
 import "strings"
 import "bufio"
 import "reflect"
+import "io/ioutil"
+import "path"
 
 import "keltainen.duckdns.org/rnafolding/base"
 import "keltainen.duckdns.org/rnafolding/folding"
@@ -182,3 +184,69 @@ func TestReadMultiSequence(t *testing.T) {
 		}
 	}
 }
+
+func TestReadSequenceFoldingErrors(t *testing.T) {
+	var tests = []struct {
+		input string
+		err   error
+	}{
+		{">Cmt\nACGUACGU\n.((..)))\n", &BracketError{Pos: 7, Char: ')'}},
+		{">Cmt\nACGUACGU\n(((..)).\n", &BracketError{Pos: 0, Char: '('}},
+		{">Cmt\nACGUACGU\n.(([..)).\n", &BracketError{Pos: 3, Char: '['}},
+		{">Cmt\nACGUACGU\n.((..))\n", &LengthError{Bases: 8, Folding: 7}},
+	}
+	for _, tt := range tests {
+		seq, err := ReadSequence(strings.NewReader(tt.input))
+		fe, ok := err.(*FoldingError)
+		if !ok {
+			t.Errorf("ReadSequence(%q): expected FoldingError, received %v", tt.input, err)
+			continue
+		}
+		if fe.Name != "Cmt" || !reflect.DeepEqual(fe.Err, tt.err) {
+			t.Errorf("ReadSequence(%q): expected error %v for Cmt, received %v for %s", tt.input, tt.err, fe.Err, fe.Name)
+		}
+		if seq == nil || len(seq.Bases) != 8 || seq.ReferenceFolding != nil {
+			t.Errorf("ReadSequence(%q): expected sequence without folding, received %#v", tt.input, seq)
+		}
+	}
+}
+
+func TestReadMultiSequenceFoldingErrors(t *testing.T) {
+	input := ">Cmt1\nACGUACGU\n.((..)).\n\n" +
+		">Cmt2\nACGUACGU\n((...))\n\n" +
+		">Cmt3\nACGUACGU\n.((...)(\n"
+	seqs, err := ReadMultiSequence(strings.NewReader(input))
+	errs, ok := err.(FoldingErrors)
+	if !ok || len(errs) != 2 || errs[0].Name != "Cmt2" || errs[1].Name != "Cmt3" {
+		t.Fatalf("ReadMultiSequence: expected FoldingErrors for Cmt2 and Cmt3, received %v", err)
+	}
+	if len(seqs) != 3 {
+		t.Fatalf("ReadMultiSequence: expected 3 sequences, received %d", len(seqs))
+	}
+	if seqs["Cmt1"].ReferenceFolding == nil || seqs["Cmt2"].ReferenceFolding != nil || seqs["Cmt3"].ReferenceFolding != nil {
+		t.Errorf("ReadMultiSequence: expected reference folding only for Cmt1")
+	}
+}
+
+func TestReadMultiSequenceFile(t *testing.T) {
+	fname := path.Join(t.TempDir(), "seqs.fasta")
+	input := ">b\nACGU\n\n>c\nACGUACGU\n((...))\n\n>a\nGGAAACC\n"
+	if err := ioutil.WriteFile(fname, []byte(input), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	seqs, err := ReadMultiSequenceFile(fname)
+	if errs, ok := err.(FoldingErrors); !ok || len(errs) != 1 || errs[0].Name != "c" {
+		t.Errorf("ReadMultiSequenceFile: expected FoldingErrors for c, received %v", err)
+	}
+	var names []string
+	for _, seq := range seqs {
+		names = append(names, seq.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("ReadMultiSequenceFile: expected sequences a, b and c, received %v", names)
+	}
+
+	if _, err := ReadMultiSequenceFile(path.Join(t.TempDir(), "missing.fasta")); err == nil {
+		t.Errorf("ReadMultiSequenceFile of missing file: expected error")
+	}
+}
@@ -51,7 +51,9 @@ func readFasta(fname string) *base.Sequence {
 		log.Fatalf("Unable to open file \"%s\": %v", fname, err)
 	}
 	seq, err := fasta.ReadSequence(f)
-	if err != nil {
+	if _, ok := err.(*fasta.FoldingError); ok {
+		log.Printf("Ignoring reference folding in \"%s\": %v", fname, err)
+	} else if err != nil {
 		log.Fatalf("Error reading FASTA format file \"%s\": %v", fname, err)
 	}
 	return seq
@@ -1,22 +1,21 @@
 package main /* import "keltainen.duckdns.org/rnafolding" */
 
+import "context"
 import "encoding/json"
 import "flag"
 import "fmt"
 import "io/ioutil"
 import "log"
-import "math/big"
 import "os"
 import "path"
-import "reflect"
-import "time"
+import "strings"
 
 import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/compare"
 import "keltainen.duckdns.org/rnafolding/fasta"
-import "keltainen.duckdns.org/rnafolding/folding"
 import "keltainen.duckdns.org/rnafolding/trnadb"
-import "keltainen.duckdns.org/rnafolding/safecomplete"
-import "keltainen.duckdns.org/rnafolding/format"
+import "keltainen.duckdns.org/rnafolding/pipeline"
+import "keltainen.duckdns.org/rnafolding/predictor"
 
 var (
 	infile     = flag.String("in", "", "Name of input file in FASTA format")
@@ -24,80 +23,31 @@ var (
 	dbfile     = flag.String("db", "", "Location of tRNA database file")
 	trna       = flag.String("trna", "", "Name of tRNA sequence within database file")
 	all        = flag.Bool("all", false, "Analyze all sequences in tRNA database")
+	algo       = flag.String("algo", "nussinov,wuchty,safecomplete", "Comma-separated list of algorithms to run and check against each other: "+strings.Join(predictor.Names(), ", "))
 	minhairpin = flag.Int("minhairpin", 3, "Minimum number of free bases in hairpin loop")
+	maxspan    = flag.Int("maxspan", 0, "Maximum distance j-i of paired bases i and j, like RNAfold --maxBPspan. Zero does not limit")
+	nolp       = flag.Bool("nolp", false, "Allow only pairs that stack on another pair, like RNAfold --noLP")
 	outdir     = flag.String("outdir", "", "Write result files to given directory")
+	treeformat = flag.String("treeformat", "text", "Format of folding tree in output: text or dot")
+	draw       = flag.String("draw", "", "Draw example, consensus and reference foldings to output directory in given format: svg or png")
+	drawcolor  = flag.String("drawcolor", "safety", "Color bases in drawings by safety or by frequency of pairing in optimal foldings")
+	heatmap    = flag.String("heatmap", "", "Draw heatmap of pair frequencies in optimal foldings to output directory in given format: svg or png")
+	asciiwidth = flag.Int("asciiwidth", 0, "Wrap ASCII drawings of foldings to given width. Zero does not wrap")
+	maxlisted  = flag.Int64("maxlisted", 1000, "Maximum number of optimal foldings to list in output. Zero lists all")
+	maxfolds   = flag.Int64("maxfoldings", 0, "Skip sequences with more optimal foldings than this. Zero does not limit")
+	delta      = flag.Int("delta", 0, "List also foldings with at most given number of pairs less than optimal, found with the Wuchty algorithm")
+	timeout    = flag.Duration("timeout", 0, "Abort analysis of a sequence after given time, for example 10m. Zero does not limit")
 )
 
-type Rules struct {
-	MinHairpin int
-}
-
-type Timing struct {
-	ZukerSeconds              float64
-	WuchtySeconds             float64
-	SafeCompleteSeconds       float64
-	PairArraysSeconds         float64
-	SafeCompleteTotalSeconds  float64
-	TrivialSafetySeconds      float64
-	SafeCompleteSafetySeconds float64
-}
-
-type Counts struct {
-	SequenceBases          int
-	OptimalPairs           int
-	ZukerFoldings          int
-	WuchtyFoldings         int
-	SafeCompleteFoldings   int
-	AfterCollapseTree      int
-	AfterLiftCommon        int
-	SafeCompletePairArrays int
-	SafeBases              int
-}
-
-type Sanity struct {
-	Zuker        string
-	Wuchty       string
-	SafeComplete string
-	Safety       string
-}
-
-type Folding struct {
-	Pairing    folding.FoldingPairs
-	PairCount  int
-	DotBracket string
-	AsciiArt   string
-}
-
-type Safety struct {
-	SafeBase  []bool
-	PairCount [][]*big.Int
-	FreeCount []*big.Int
-}
-
-type OutputEntry struct {
-	Name                    string
-	Comment                 string
-	Sequence                string
-	SequenceWithSafety      string
-	Rules                   Rules
-	Timing                  Timing
-	Counts                  Counts
-	Sanity                  Sanity
-	ReferenceFolding        Folding
-	ZukerFoldings           []Folding
-	AllFoldings             []Folding
-	SafeCompleteFoldingTree string
-	Safety                  Safety
-	ReferencePosition       []int
-}
-
 func readFasta(fname string) *base.Sequence {
 	f, err := os.Open(fname)
 	if err != nil {
 		log.Fatalf("Unable to open file \"%s\": %v", *infile, err)
 	}
 	seq, err := fasta.ReadSequence(f)
-	if err != nil {
+	if _, ok := err.(*fasta.FoldingError); ok {
+		log.Printf("Ignoring reference folding in \"%s\": %v", fname, err)
+	} else if err != nil {
 		log.Fatalf("Error reading FASTA format file \"%s\": %v", *infile, err)
 	}
 	return seq
@@ -109,7 +59,11 @@ func readMultiFasta(fname string) map[string]*base.Sequence {
 		log.Fatalf("Unable to open file \"%s\": %v", *infile, err)
 	}
 	seq, err := fasta.ReadMultiSequence(f)
-	if err != nil {
+	if errs, ok := err.(fasta.FoldingErrors); ok {
+		for _, e := range errs {
+			log.Printf("Ignoring reference folding in \"%s\": %v", fname, e)
+		}
+	} else if err != nil {
 		log.Fatalf("Error reading FASTA format file \"%s\": %v", *infile, err)
 	}
 	return seq
@@ -141,7 +95,15 @@ func readTRNA() map[string]*base.Sequence {
 		log.Fatalf("Unable to open tRNA database \"%s\": %v", *dbfile, err)
 	}
 	seqs, err := trnadb.ReadSequences(f)
-	if err != nil {
+	if errs, ok := err.(trnadb.FoldingErrors); ok {
+		for _, e := range errs {
+			if e.Partial {
+				log.Printf("Leaving out pairs of reference folding in \"%s\": %v", *dbfile, e)
+			} else {
+				log.Printf("Ignoring reference folding in \"%s\": %v", *dbfile, e)
+			}
+		}
+	} else if err != nil {
 		log.Fatalf("Error reading tRNA database file \"%s\": %v", *dbfile, err)
 	}
 	return seqs
@@ -150,6 +112,28 @@ func readTRNA() map[string]*base.Sequence {
 func main() {
 	flag.Parse()
 
+	if err := options().Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *draw != "" && *draw != "svg" && *draw != "png" {
+		log.Fatalf("Unknown drawing format \"%s\", must be svg or png", *draw)
+	}
+	if *drawcolor != "safety" && *drawcolor != "frequency" {
+		log.Fatalf("Unknown drawing color scheme \"%s\", must be safety or frequency", *drawcolor)
+	}
+	if *draw != "" && *outdir == "" {
+		log.Fatal("Drawing foldings requires -outdir")
+	}
+	if *heatmap != "" && *heatmap != "svg" && *heatmap != "png" {
+		log.Fatalf("Unknown heatmap format \"%s\", must be svg or png", *heatmap)
+	}
+	if *heatmap != "" && *outdir == "" {
+		log.Fatal("Drawing heatmaps requires -outdir")
+	}
+	if *timeout < 0 {
+		log.Fatalf("Timeout must not be negative, got %v", *timeout)
+	}
+
 	var seq *base.Sequence
 	var seqs map[string]*base.Sequence
 	if *infile == "" && *dbfile == "" && *strand == "" {
@@ -176,7 +160,7 @@ func main() {
 		log.Fatal("Specify either a tRNA sequence with -trna flag or all sequences with -all flag")
 	}
 
-	out := make(chan OutputEntry, 1)
+	out := make(chan *pipeline.OutputEntry, 1)
 	if seqs != nil && *all {
 		go foldingStats(seqs, out)
 	} else {
@@ -203,6 +187,15 @@ func main() {
 			if err != nil {
 				log.Print("Failed to write to %s: %v", fname, err)
 			}
+			if o.Status != pipeline.StatusDone {
+				continue
+			}
+			if *draw != "" {
+				writeDrawings(o)
+			}
+			if *heatmap != "" {
+				writeHeatmap(o)
+			}
 		}
 	} else {
 		for o := range out {
@@ -212,129 +205,69 @@ func main() {
 	}
 }
 
-func foldingsToOutputFormat(seq *base.Sequence, ff folding.FoldingSet, safety []bool) []Folding {
-	if len(ff) == 1 && ff[0] == nil {
-		// Escape hatch for reference foldings, when one does not exist
-		return []Folding{{}}
-	}
-	out := make([]Folding, len(ff))
-	for i, f := range ff {
-		out[i] = Folding{
-			Pairing:    f,
-			PairCount:  countPairs(f),
-			DotBracket: format.DotBracket(f),
-			AsciiArt:   format.FoldingWithSafety(seq, f, safety),
-		}
-	}
-	return out
+// options returns the pipeline options selected by command line flags.
+func options() pipeline.Options {
+	opts := pipeline.DefaultOptions()
+	opts.Rules.MinHairpin = *minhairpin
+	opts.Rules.MaxSpan = *maxspan
+	opts.Rules.NoLonelyPairs = *nolp
+	opts.Algorithms = strings.Split(*algo, ",")
+	opts.TreeFormat = *treeformat
+	opts.AsciiWidth = *asciiwidth
+	opts.MaxListed = *maxlisted
+	opts.MaxFoldings = *maxfolds
+	opts.Delta = *delta
+	return opts
 }
 
-func foldSequence(seq *base.Sequence) OutputEntry {
-	nuStart := time.Now()
-	nu, flen, zukerOptimals := runNussinovZuker(seq)
-	nuTime := time.Since(nuStart)
-
-	wuStart := time.Now()
-	wu, wuFoldings := runWuchty(seq)
-	wuTime := time.Since(wuStart)
-
-	scStart := time.Now()
-	sc, scFoldings := runSafeComplete(seq)
-	scCountOriginal := scFoldings.CountSolutions()
-	scFoldings.CollapseTree()
-	scCountCollapsed := scFoldings.CountSolutions()
-	scFoldings.LiftCommon()
-	scCountLifted := scFoldings.CountSolutions()
-	scTime := time.Since(scStart)
-
-	paStart := time.Now()
-	scPairArrays := scFoldings.GeneratePairArrays(seq)
-	paTime := time.Since(paStart)
-	scTotalTime := time.Since(scStart)
-
-	trsaStart := time.Now()
-	safety := safecomplete.TrivialSafety(scPairArrays)
-	trsaTime := time.Since(trsaStart)
-	newsaStart := time.Now()
-	sc.CountSolutions()
-	sc.CountPairings()
-	newSafety := sc.SafetyFromBacktrack()
-	newsaTime := time.Since(newsaStart)
-
-	var safetySanity string
-	if !reflect.DeepEqual(safety, newSafety) {
-		safetySanity = "Sanity check failed! TrivialSafety and SafetyFromBacktrack return different values!"
-	}
-	numSafe := 0
-	for _, s := range safety {
-		if s {
-			numSafe++
-		}
-	}
-
-	return OutputEntry{
-		Name:               seq.Name,
-		Comment:            seq.Comment,
-		Sequence:           seq.BasesString(),
-		SequenceWithSafety: seq.BasesSafetyString(safety),
-		Rules: Rules{
-			MinHairpin: *minhairpin,
-		},
-		Timing: Timing{
-			ZukerSeconds:              nuTime.Seconds(),
-			WuchtySeconds:             wuTime.Seconds(),
-			SafeCompleteSeconds:       scTime.Seconds(),
-			PairArraysSeconds:         paTime.Seconds(),
-			SafeCompleteTotalSeconds:  scTotalTime.Seconds(),
-			TrivialSafetySeconds:      trsaTime.Seconds(),
-			SafeCompleteSafetySeconds: newsaTime.Seconds(),
-		},
-		Counts: Counts{
-			SequenceBases:          len(seq.Bases),
-			OptimalPairs:           flen,
-			ZukerFoldings:          len(zukerOptimals),
-			WuchtyFoldings:         len(wuFoldings),
-			SafeCompleteFoldings:   scCountOriginal,
-			AfterCollapseTree:      scCountCollapsed,
-			AfterLiftCommon:        scCountLifted,
-			SafeCompletePairArrays: len(scPairArrays),
-			SafeBases:              numSafe,
-		},
-		Sanity: Sanity{
-			Zuker:        sanityNussinovZuker(zukerOptimals, flen),
-			Wuchty:       sanityWuchty(nu, wu, flen, zukerOptimals, wuFoldings),
-			SafeComplete: sanitySafeComplete(sc, scFoldings, flen, scPairArrays, wuFoldings),
-			Safety:       safetySanity,
-		},
-		ReferenceFolding:        foldingsToOutputFormat(seq, folding.FoldingSet{seq.ReferenceFolding}, safety)[0],
-		ZukerFoldings:           foldingsToOutputFormat(seq, zukerOptimals, safety),
-		AllFoldings:             foldingsToOutputFormat(seq, scPairArrays, safety),
-		SafeCompleteFoldingTree: scFoldings.String(),
-		Safety: Safety{
-			SafeBase:  safety,
-			PairCount: sc.PairSafety,
-			FreeCount: sc.SingleSafety,
-		},
-		ReferencePosition: seq.ReferencePosition,
+// foldContext returns the context for analyzing one sequence, limited by
+// the -timeout flag.
+func foldContext() (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(context.Background(), *timeout)
 	}
+	return context.WithCancel(context.Background())
 }
 
-func singleFolding(seq *base.Sequence) OutputEntry {
-	o := foldSequence(seq)
+func singleFolding(seq *base.Sequence) *pipeline.OutputEntry {
+	ctx, cancel := foldContext()
+	defer cancel()
+	o, err := pipeline.Fold(ctx, seq, options())
+	if o == nil {
+		log.Fatalf("Unable to fold %s: %v", seq.Name, err)
+	} else if err != nil {
+		log.Printf("Analysis of %s %s, %s", seq.Name, o.Status, o.Reason)
+		return o
+	}
 
 	fmt.Printf("Sequence \"%s\"\n", o.Comment)
 	fmt.Printf("Contains %d bases\n\n", o.Counts.SequenceBases)
-	fmt.Printf("Folding rules:\n  * hairpin loop must contain at least %d free bases\n\n", o.Rules.MinHairpin)
-
-	fmt.Printf("Optimal folding, %d pairs: %v\n", o.Counts.OptimalPairs, o.ZukerFoldings[0].Pairing)
-	fmt.Printf("Zuker method found %d optimal solutions\n", o.Counts.ZukerFoldings)
-	if o.Sanity.Zuker != "" {
-		log.Print(o.Sanity.Zuker)
+	fmt.Printf("Folding rules:\n  * hairpin loop must contain at least %d free bases\n", o.Rules.MinHairpin)
+	if o.Rules.MaxSpan > 0 {
+		fmt.Printf("  * paired bases must be at most %d bases apart\n", o.Rules.MaxSpan)
+	}
+	if o.Rules.NoLonelyPairs {
+		fmt.Printf("  * every pair must stack on another pair\n")
 	}
+	fmt.Println()
 
-	fmt.Printf("Wuchty predictor produced %d foldings\n", o.Counts.WuchtyFoldings)
-	if o.Sanity.Wuchty != "" {
-		log.Print(o.Sanity.Wuchty)
+	optimal := o.AllFoldings[0]
+	if len(o.ZukerFoldings) > 0 {
+		optimal = o.ZukerFoldings[0]
+	}
+	fmt.Printf("Optimal folding, %d pairs: %v\n", o.Counts.OptimalPairs, optimal.Pairing)
+	for _, r := range o.Predictors {
+		switch r.Name {
+		case "nussinov":
+			fmt.Printf("Zuker method found %d optimal solutions\n", r.Foldings)
+		case "wuchty":
+			fmt.Printf("Wuchty predictor produced %d foldings\n", r.Foldings)
+		default:
+			fmt.Printf("Predictor %s produced %d foldings\n", r.Name, r.Foldings)
+		}
+		if r.Sanity != "" {
+			log.Print(r.Sanity)
+		}
 	}
 
 	fmt.Printf("Found %d solutions in total\n", o.Counts.SafeCompleteFoldings)
@@ -352,28 +285,74 @@ func singleFolding(seq *base.Sequence) OutputEntry {
 	}
 	if o.ReferenceFolding.Pairing != nil {
 		fmt.Printf("Reference folding: (%d pairs)\n", o.ReferenceFolding.PairCount)
-		fmt.Print(format.FoldingWithSafety(seq, o.ReferenceFolding.Pairing, o.Safety.SafeBase))
+		fmt.Print(o.ReferenceFolding.AsciiArt)
 	}
 	fmt.Println("Example folding with maximal pairing:")
-	fmt.Print(format.FoldingWithSafety(seq, o.AllFoldings[0].Pairing, o.Safety.SafeBase))
+	fmt.Print(o.AllFoldings[0].AsciiArt)
+	if o.Delta > 0 {
+		fmt.Printf("Found %d foldings with at least %d pairs", o.Counts.SuboptimalFoldings, o.Counts.OptimalPairs-o.Delta)
+		if int64(len(o.SuboptimalFoldings)) < o.Counts.SuboptimalFoldings {
+			fmt.Printf(", listing %d with the most pairs", len(o.SuboptimalFoldings))
+		}
+		fmt.Println(":")
+		for _, f := range o.SuboptimalFoldings {
+			fmt.Printf("%s %3d\n", f.DotBracket, f.PairCount)
+		}
+	}
 	fmt.Printf("Safe bases %d/%d (%f %%)\n",
 		o.Counts.SafeBases, o.Counts.SequenceBases, float64(o.Counts.SafeBases*100)/float64(o.Counts.SequenceBases))
+	fmt.Printf("Expected base pair distance between two optimal foldings: %f\n", o.Counts.ExpectedPairDistance)
+	if o.ReferenceFolding.Pairing != nil {
+		fmt.Printf("Expected base pair distance to reference folding: %f\n", o.Counts.ExpectedReferenceDistance)
+	}
+	fmt.Printf("Number of optimal foldings by base pair distance from consensus: %v\n", o.Counts.ConsensusDistance)
+	if c := o.ReferenceComparison; c != nil {
+		fmt.Println("Comparison to reference folding:")
+		fmt.Println("              Sens    PPV     F1    MCC  BPDist MountDist TreeDist")
+		printComparison("Example", c.Example)
+		printComparison("Consensus", c.Consensus)
+		for i, z := range c.Zuker {
+			printComparison(fmt.Sprintf("Zuker %d", i+1), z)
+		}
+	}
+	if r := o.ReferenceOptimality; r != nil {
+		if r.Membership != nil {
+			fmt.Println(r.Membership)
+		}
+		if r.Error != "" {
+			log.Printf("Could not check optimality of reference folding of %s: %s", o.Name, r.Error)
+		}
+	}
 
 	return o
 }
 
-func foldingStats(seqs map[string]*base.Sequence, out chan OutputEntry) {
-	fmt.Println("# Name NumBases FoldingPairs NumZuker  NumAll NumSafeBases TimeNussinov TimeWuchty TimeSafeComplete TimePairArrays TimeTrivSafety TimeSCSafety")
+func printComparison(name string, c compare.Comparison) {
+	fmt.Printf("%-12s %6.3f %6.3f %6.3f %6.3f %7d %9d %8d\n", name,
+		c.Exact.Sensitivity, c.Exact.PPV, c.Exact.F1, c.Exact.MCC,
+		c.PairDistance, c.MountainDistance, c.TreeEditDistance)
+}
+
+func foldingStats(seqs map[string]*base.Sequence, out chan *pipeline.OutputEntry) {
+	opts := options()
+	fmt.Println("# Name NumBases FoldingPairs NumZuker  NumAll NumSafeBases TimeNussinov TimeWuchty TimeSafeComplete TimePairArrays TimeTrivSafety TimeSCSafety  Status")
 
 	for name := range seqs {
 		seq := seqs[name]
-		o := foldSequence(seq)
-
-		if o.Sanity.Zuker != "" {
-			log.Print(o.Sanity.Zuker)
+		ctx, cancel := foldContext()
+		o, err := pipeline.Fold(ctx, seq, opts)
+		cancel()
+		if o == nil {
+			log.Printf("Unable to fold %s: %v", name, err)
+			continue
+		} else if err != nil {
+			log.Printf("Analysis of %s %s, %s", name, o.Status, o.Reason)
 		}
-		if o.Sanity.Wuchty != "" {
-			log.Print(o.Sanity.Wuchty)
+
+		for _, r := range o.Predictors {
+			if r.Sanity != "" {
+				log.Print(r.Sanity)
+			}
 		}
 		if o.Sanity.SafeComplete != "" {
 			log.Print(o.Sanity.SafeComplete)
@@ -383,21 +362,14 @@ func foldingStats(seqs map[string]*base.Sequence, out chan OutputEntry) {
 		}
 
 		out <- o
-		fmt.Printf("%s %8d %12d %8d %7d %12d %12.6f %10.6f %16.6f %14.6f %14.6f %12.6f\n",
+		fmt.Printf("%s %8d %12d %8d %7d %12d %12.6f %10.6f %16.6f %14.6f %14.6f %12.6f %7s\n",
 			o.Name, o.Counts.SequenceBases, o.Counts.OptimalPairs,
 			o.Counts.ZukerFoldings, o.Counts.WuchtyFoldings, o.Counts.SafeBases,
 			o.Timing.ZukerSeconds, o.Timing.WuchtySeconds, o.Timing.SafeCompleteSeconds, o.Timing.PairArraysSeconds,
-			o.Timing.TrivialSafetySeconds, o.Timing.SafeCompleteSafetySeconds)
-	}
-	close(out)
-}
-
-func countPairs(f []int) int {
-	c := 0
-	for _, n := range f {
-		if n >= 0 {
-			c++
+			o.Timing.TrivialSafetySeconds, o.Timing.SafeCompleteSafetySeconds, o.Status)
+		if o.Reason != "" {
+			fmt.Printf("# %s: %s\n", o.Name, o.Reason)
 		}
 	}
-	return c / 2
+	close(out)
 }
@@ -0,0 +1,24 @@
+package folding /* import "keltainen.duckdns.org/rnafolding/folding" */
+
+import "fmt"
+
+// LengthError tells that foldings of different lengths were compared, so
+// they cannot be foldings of the same sequence.
+type LengthError struct {
+	A int
+	B int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("foldings of different lengths: %d and %d", e.A, e.B)
+}
+
+// checkLengths returns a LengthError if all foldings are not of length n.
+func checkLengths(n int, ff FoldingSet) error {
+	for _, f := range ff {
+		if len(f) != n {
+			return &LengthError{A: n, B: len(f)}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,5 @@
 package folding /* import "keltainen.duckdns.org/rnafolding/folding" */
 
-import "log"
 import "sort"
 
 type FoldingPairs []int
@@ -25,11 +24,11 @@ func (f FoldingOrdering) Swap(i, j int) {
 	f.FoldingSet[i], f.FoldingSet[j] = f.FoldingSet[j], f.FoldingSet[i]
 }
 
+// Less orders foldings lexicographically, shorter foldings first.
 func (f FoldingOrdering) Less(i, j int) bool {
 	a := f.FoldingSet[i]
 	b := f.FoldingSet[j]
 	if len(a) != len(b) {
-		log.Printf("arrLess: array lenths different! len(f[%d])=%d, len(f[%d])=%d", i, len(a), j, len(b))
 		return len(a) < len(b)
 	}
 	for n := 0; n < len(a); n++ {
@@ -43,7 +42,18 @@ func (f FoldingOrdering) Less(i, j int) bool {
 	return false
 }
 
-func IsSubsetOf(sub FoldingSet, all FoldingSet) bool {
+// IsSubsetOf tells whether all foldings in sub are also in all. Returns a
+// LengthError if the foldings are not all of the same length.
+func IsSubsetOf(sub FoldingSet, all FoldingSet) (bool, error) {
+	if len(sub) == 0 {
+		return true, nil
+	}
+	if err := checkLengths(len(sub[0]), sub); err != nil {
+		return false, err
+	}
+	if err := checkLengths(len(sub[0]), all); err != nil {
+		return false, err
+	}
 	ssub := make(FoldingSet, len(sub))
 	copy(ssub, sub)
 	sort.Sort(FoldingOrdering{ssub})
@@ -53,20 +63,27 @@ func IsSubsetOf(sub FoldingSet, all FoldingSet) bool {
 	iall := 0
 	isub := 0
 	for iall < len(sall) && isub < len(ssub) {
-		if FoldingArraysEqual(sall[iall], ssub[isub]) {
+		if foldingsEqual(sall[iall], ssub[isub]) {
 			isub++
 		}
 		iall++
 	}
-	if isub < len(ssub) {
-		return false
-	}
-	return true
+	return isub == len(ssub), nil
 }
 
-func FoldingSetsEqual(a, b FoldingSet) bool {
+// FoldingSetsEqual tells whether a and b contain the same foldings. Returns
+// a LengthError if the foldings are not all of the same length.
+func FoldingSetsEqual(a, b FoldingSet) (bool, error) {
+	if len(a) > 0 {
+		if err := checkLengths(len(a[0]), a); err != nil {
+			return false, err
+		}
+		if err := checkLengths(len(a[0]), b); err != nil {
+			return false, err
+		}
+	}
 	if len(a) != len(b) {
-		return false
+		return false, nil
 	}
 	sa := make(FoldingSet, len(a))
 	copy(sa, a)
@@ -75,19 +92,23 @@ func FoldingSetsEqual(a, b FoldingSet) bool {
 	copy(sb, b)
 	sort.Sort(FoldingOrdering{sb})
 	for i := 0; i < len(sa); i++ {
-		if !FoldingArraysEqual(sa[i], sb[i]) {
-			log.Printf("foldingSetsEqual: difference found!\na=%v\nb=%v", sa[i], sb[i])
-			return false
+		if !foldingsEqual(sa[i], sb[i]) {
+			return false, nil
 		}
 	}
-	return true
+	return true, nil
 }
 
-func FoldingArraysEqual(a, b FoldingPairs) bool {
+// FoldingArraysEqual tells whether a and b pair the same bases. Returns a
+// LengthError if they are of different lengths.
+func FoldingArraysEqual(a, b FoldingPairs) (bool, error) {
 	if len(a) != len(b) {
-		log.Printf("arraysEqual: array lengths different! len(a)=%d, len(b)=%d", len(a), len(b))
-		return false
+		return false, &LengthError{A: len(a), B: len(b)}
 	}
+	return foldingsEqual(a, b), nil
+}
+
+func foldingsEqual(a, b FoldingPairs) bool {
 	for i := 0; i < len(a); i++ {
 		if a[i] != b[i] && (a[i] >= 0 || b[i] >= 0) {
 			return false
@@ -96,11 +117,65 @@ func FoldingArraysEqual(a, b FoldingPairs) bool {
 	return true
 }
 
-func FoldingInArray(f FoldingPairs, ff FoldingSet) bool {
+// FoldingInArray tells whether f is one of the foldings in ff. Returns a
+// LengthError if the foldings are not all of the same length.
+func FoldingInArray(f FoldingPairs, ff FoldingSet) (bool, error) {
+	if err := checkLengths(len(f), ff); err != nil {
+		return false, err
+	}
 	for _, o := range ff {
-		if FoldingArraysEqual(f, o) {
-			return true
+		if foldingsEqual(f, o) {
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
+}
+
+// SplitCrossing separates pairs of f that cross a pair closed earlier
+// from the rest. Returns a folding without crossing pairs, and a folding
+// with only the removed pairs.
+func SplitCrossing(f FoldingPairs) (nested FoldingPairs, crossing FoldingPairs) {
+	nested = NewFoldingPairs(len(f))
+	crossing = NewFoldingPairs(len(f))
+	var stack []int
+	skip := make([]bool, len(f))
+	for j, i := range f {
+		if i < 0 || i == j || i >= len(f) || f[i] != j {
+			continue
+		}
+		if i > j {
+			stack = append(stack, j)
+			continue
+		}
+		if skip[i] {
+			crossing[i] = j
+			crossing[j] = i
+			continue
+		}
+		// Pairs opened after i and still open cross (i, j)
+		pos := len(stack) - 1
+		for stack[pos] != i {
+			skip[stack[pos]] = true
+			pos--
+		}
+		stack = stack[:pos]
+		nested[i] = j
+		nested[j] = i
+	}
+	return nested, crossing
+}
+
+// Lonely tells whether base i is paired in f without a stacking pair on
+// either side, that is, neither (i+1, j-1) nor (i-1, j+1) is in f.
+func Lonely(f FoldingPairs, i int) bool {
+	j := f[i]
+	if j < 0 || j == i || j >= len(f) {
+		return false
+	}
+	if j < i {
+		i, j = j, i
+	}
+	inner := i+1 < j-1 && f[i+1] == j-1
+	outer := i > 0 && j+1 < len(f) && f[i-1] == j+1
+	return !inner && !outer
 }
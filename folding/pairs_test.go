@@ -0,0 +1,87 @@
+package folding /* import "keltainen.duckdns.org/rnafolding/folding" */
+
+import "reflect"
+import "testing"
+
+func parseDotBracket(db string) FoldingPairs {
+	f := NewFoldingPairs(len(db))
+	stacks := map[rune][]int{}
+	closing := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	for i, c := range db {
+		if o, ok := closing[c]; ok {
+			s := stacks[o]
+			j := s[len(s)-1]
+			stacks[o] = s[:len(s)-1]
+			f[i], f[j] = j, i
+		} else if c != '.' {
+			stacks[c] = append(stacks[c], i)
+		}
+	}
+	return f
+}
+
+func TestSplitCrossing(t *testing.T) {
+	tests := []struct {
+		in       string
+		nested   string
+		crossing string
+	}{
+		{"((..))..", "((..))..", "........"},
+		{"((..[[..))..]]", "((......))....", "....((......))"},
+		{"..[[..((..]]..))", "..((......))....", "......((......))"},
+		{"([)]", "(.).", ".(.)"},
+	}
+	for _, tt := range tests {
+		nested, crossing := SplitCrossing(parseDotBracket(tt.in))
+		if en, ec := parseDotBracket(tt.nested), parseDotBracket(tt.crossing); !reflect.DeepEqual(nested, en) || !reflect.DeepEqual(crossing, ec) {
+			t.Errorf("SplitCrossing(%s): expected %v, %v, got %v, %v", tt.in, en, ec, nested, crossing)
+		}
+	}
+}
+
+func TestLonely(t *testing.T) {
+	tests := []struct {
+		in     string
+		lonely string
+	}{
+		{"((..))", "......"},
+		{"(....)", "x....x"},
+		{".((.).)", ".xx.x.x"},
+		{"(((..).))", "..x..x..."},
+		{"((((.)(.))))", "...x.xx.x..."},
+	}
+	for _, tt := range tests {
+		f := parseDotBracket(tt.in)
+		for i := range f {
+			if lonely := Lonely(f, i); lonely != (tt.lonely[i] == 'x') {
+				t.Errorf("Lonely(%s, %d) = %v", tt.in, i, lonely)
+			}
+		}
+	}
+}
+
+func TestLengthErrors(t *testing.T) {
+	a := FoldingPairs{1, 0, -1}
+	b := FoldingPairs{1, 0}
+	want := &LengthError{A: 3, B: 2}
+	if equal, err := FoldingArraysEqual(a, b); equal || !reflect.DeepEqual(err, want) {
+		t.Errorf("FoldingArraysEqual(%v, %v) = %v, %v, want false, %v", a, b, equal, err, want)
+	}
+	if found, err := FoldingInArray(a, FoldingSet{a, b}); found || !reflect.DeepEqual(err, want) {
+		t.Errorf("FoldingInArray(%v, {%v, %v}) = %v, %v, want false, %v", a, a, b, found, err, want)
+	}
+	if subset, err := IsSubsetOf(FoldingSet{a}, FoldingSet{a, b}); subset || !reflect.DeepEqual(err, want) {
+		t.Errorf("IsSubsetOf({%v}, {%v, %v}) = %v, %v, want false, %v", a, a, b, subset, err, want)
+	}
+	if equal, err := FoldingSetsEqual(FoldingSet{a}, FoldingSet{b}); equal || !reflect.DeepEqual(err, want) {
+		t.Errorf("FoldingSetsEqual({%v}, {%v}) = %v, %v, want false, %v", a, b, equal, err, want)
+	}
+
+	c := FoldingPairs{-1, -1, -1}
+	if equal, err := FoldingSetsEqual(FoldingSet{a, c}, FoldingSet{c, a}); !equal || err != nil {
+		t.Errorf("FoldingSetsEqual({%v, %v}, {%v, %v}) = %v, %v, want true, nil", a, c, c, a, equal, err)
+	}
+	if subset, err := IsSubsetOf(FoldingSet{c}, FoldingSet{a}); subset || err != nil {
+		t.Errorf("IsSubsetOf({%v}, {%v}) = %v, %v, want false, nil", c, a, subset, err)
+	}
+}
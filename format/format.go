@@ -1,6 +1,7 @@
 package format /* import "keltainen.duckdns.org/rnafolding/format" */
 
 import "fmt"
+import "sort"
 import "strings"
 
 import "keltainen.duckdns.org/rnafolding/base"
@@ -14,10 +15,6 @@ func Matrix(m [][]int) string {
 	return "  " + strings.Join(strs, "\n  ")
 }
 
-type canvas struct {
-	c map[int]map[int]rune
-}
-
 func DotBracket(pairs folding.FoldingPairs) string {
 	out := make([]rune, len(pairs))
 	for i, p := range pairs {
@@ -43,11 +40,93 @@ func Folding(seq *base.Sequence, pairs folding.FoldingPairs) string {
 }
 
 func FoldingWithSafety(seq *base.Sequence, pairs folding.FoldingPairs, safety []bool) string {
-	c := &canvas{c: map[int]map[int]rune{}}
-	c.Set(0, -1, ">")
-	c.Set(0, 1, "<")
-	recursiveFolding(seq, pairs, safety, 1, 0, 0, len(seq.Bases)-1, 0, c)
-	return c.Draw()
+	return FoldingWithOptions(seq, pairs, safety, Options{})
+}
+
+// Options for drawing foldings as ASCII art.
+type Options struct {
+	// Drawings wider than MaxWidth characters are wrapped into several
+	// blocks. Zero means no limit.
+	MaxWidth int
+	// Label the helices with their indices and list them after the
+	// drawing.
+	HelixIndices bool
+}
+
+// Limits for searching a layout without collisions
+const (
+	maxStretch = 12
+	maxWrites  = 1000000
+)
+
+type helix struct {
+	i, j   int
+	length int
+	x, y   int
+	dir    int
+}
+
+type layout struct {
+	seq     *base.Sequence
+	pairs   folding.FoldingPairs
+	safety  []bool
+	c       *canvas
+	helices []helix
+	// Set if the write budget ran out before some part was placed without
+	// collisions
+	cutShort bool
+}
+
+type layoutMark struct {
+	undo       int
+	collisions int
+	helices    int
+}
+
+func (l *layout) mark() layoutMark {
+	return layoutMark{len(l.c.undo), l.c.collisions, len(l.helices)}
+}
+
+func (l *layout) restore(m layoutMark) {
+	l.c.restore(m.undo)
+	l.c.collisions = m.collisions
+	l.helices = l.helices[:m.helices]
+}
+
+func FoldingWithOptions(seq *base.Sequence, pairs folding.FoldingPairs, safety []bool, opts Options) string {
+	if len(pairs) != len(seq.Bases) || len(safety) != len(seq.Bases) {
+		return fmt.Sprintf("Cannot draw folding of %d bases with safety of %d bases for a sequence of %d bases\n",
+			len(pairs), len(safety), len(seq.Bases))
+	}
+	nested, crossing := folding.SplitCrossing(pairs)
+	l := &layout{seq: seq, pairs: nested, safety: safety, c: newCanvas()}
+	l.c.Set(0, -1, ">")
+	l.c.Set(0, 1, "<")
+	l.draw(1, 0, 0, len(seq.Bases)-1, 0)
+	sort.Slice(l.helices, func(a, b int) bool { return l.helices[a].i < l.helices[b].i })
+	if opts.HelixIndices {
+		l.labelHelices()
+	}
+	out := l.c.Draw(opts.MaxWidth)
+
+	if opts.HelixIndices {
+		for n, h := range l.helices {
+			out += fmt.Sprintf("Helix %d: (%d,%d) to (%d,%d)\n", n+1, h.i, h.j, h.i+h.length-1, h.j-h.length+1)
+		}
+	}
+	var notDrawn []string
+	for i, j := range crossing {
+		if j > i {
+			notDrawn = append(notDrawn, fmt.Sprintf("(%d,%d)", i, j))
+		}
+	}
+	if len(notDrawn) > 0 {
+		out += "Crossing pairs not drawn: " + strings.Join(notDrawn, ", ") + "\n"
+	}
+	if l.cutShort {
+		out += "Layout search stopped early, some parts may overlap\n"
+	}
+	return out
 }
 
 func directionToVectors(dir int) (int, int, int, int) {
@@ -66,102 +145,204 @@ func directionToVectors(dir int) (int, int, int, int) {
 }
 
 func rotateCCW(dir int) int {
-	return (dir - 1) % 4
+	return (dir + 3) % 4
 }
 
 func rotateCW(dir int) int {
 	return (dir + 1) % 4
 }
 
-func recursiveFolding(seq *base.Sequence, pairs []int, safety []bool, x, y, i, j, dir int, c *canvas) {
+// place draws a part of the folding with the first alternative that does
+// not collide with anything drawn earlier. Each alternative is tried with
+// growing distance from the rest of the drawing. If all alternatives
+// collide, the one with fewest collisions is used. The write budget is
+// shared by the whole drawing, since placements nest, and the search is
+// marked as cut short if the budget runs out.
+func (l *layout) place(alternatives ...func(stretch int)) {
+	bestStretch, bestAlt, bestCollisions := 0, 0, -1
+	stretch := 0
+	for ; stretch <= maxStretch && l.c.writes < maxWrites; stretch++ {
+		for a, alt := range alternatives {
+			m := l.mark()
+			alt(stretch)
+			collisions := l.c.collisions - m.collisions
+			if collisions == 0 {
+				return
+			}
+			l.restore(m)
+			if bestCollisions < 0 || collisions < bestCollisions {
+				bestStretch, bestAlt, bestCollisions = stretch, a, collisions
+			}
+		}
+	}
+	if stretch <= maxStretch {
+		l.cutShort = true
+	}
+	alternatives[bestAlt](bestStretch)
+}
+
+func (l *layout) code(i int) string {
+	return l.seq.Bases[i].CodeAndSafety(l.safety[i])
+}
+
+func (l *layout) draw(x, y, i, j, dir int) {
 	majorx, majory, minorx, minory := directionToVectors(dir)
+	pairs := l.pairs
+	c := l.c
 	if i > j {
-		//c.Set(x-minorx, y-minory, "\\")
-		//c.Set(x, y, "|")
-		//c.Set(x+minorx, y+minory, "/")
 		return
 	}
 	if pairs[i] == j {
-		c.Set(x-minorx, y-minory, seq.Bases[i].CodeAndSafety(safety[i]))
+		if i == 0 || j == len(pairs)-1 || pairs[i-1] != j+1 {
+			l.helices = append(l.helices, helix{i: i, j: j, x: x, y: y, dir: dir})
+		}
+		l.helices[len(l.helices)-1].length++
+		c.Set(x-minorx, y-minory, l.code(i))
 		c.Set(x, y, "#")
-		c.Set(x+minorx, y+minory, seq.Bases[j].CodeAndSafety(safety[j]))
-		recursiveFolding(seq, pairs, safety, x+majorx, y+majory, i+1, j-1, dir, c)
+		c.Set(x+minorx, y+minory, l.code(j))
+		l.draw(x+majorx, y+majory, i+1, j-1, dir)
 	} else if pairs[i] >= 0 && pairs[j] >= 0 {
 		if pairs[i]+1 > pairs[j]-1 {
+			// Two stems: one continues straight and the other turns aside
+			leftStraight := func(s int) {
+				l.draw(x+(3+s)*majorx, y+(3+s)*majory, i, pairs[i], dir)
+				l.draw(x+majorx+(2+s)*minorx, y+majory+(2+s)*minory, pairs[j], j, rotateCW(dir))
+			}
+			rightStraight := func(s int) {
+				l.draw(x+majorx-(2+s)*minorx, y+majory-(2+s)*minory, i, pairs[i], rotateCCW(dir))
+				l.draw(x+(3+s)*majorx, y+(3+s)*majory, pairs[j], j, dir)
+			}
 			if pairs[i]-i > j-pairs[j] {
-				recursiveFolding(seq, pairs, safety, x+3*majorx, y+3*majory, i, pairs[i], dir, c)
-				recursiveFolding(seq, pairs, safety, x+majorx+2*minorx, y+majory+2*minory, pairs[j], j, rotateCW(dir), c)
+				l.place(leftStraight, rightStraight)
 			} else {
-				recursiveFolding(seq, pairs, safety, x+majorx-2*minorx, y+majory-2*minory, i, pairs[i], rotateCCW(dir), c)
-				recursiveFolding(seq, pairs, safety, x+3*majorx, y+3*majory, pairs[j], j, dir, c)
+				l.place(rightStraight, leftStraight)
 			}
 		} else {
-			recursiveFolding(seq, pairs, safety, x+majorx-2*minorx, y+majory-2*minory, i, pairs[i], rotateCCW(dir), c)
-			recursiveFolding(seq, pairs, safety, x+majorx+2*minorx, y+majory+2*minory, pairs[j], j, rotateCW(dir), c)
-			recursiveFolding(seq, pairs, safety, x+3*majorx, y+3*majory, pairs[i]+1, pairs[j]-1, dir, c)
+			l.place(func(s int) {
+				l.draw(x+majorx-(2+s)*minorx, y+majory-(2+s)*minory, i, pairs[i], rotateCCW(dir))
+			})
+			l.place(func(s int) {
+				l.draw(x+majorx+(2+s)*minorx, y+majory+(2+s)*minory, pairs[j], j, rotateCW(dir))
+			})
+			l.place(func(s int) {
+				l.draw(x+(3+s)*majorx, y+(3+s)*majory, pairs[i]+1, pairs[j]-1, dir)
+			})
 		}
 	} else if pairs[i] < 0 && pairs[j] < 0 && i != j {
-		c.Set(x-minorx, y-minory, seq.Bases[i].CodeAndSafety(safety[i]))
-		c.Set(x+minorx, y+minory, seq.Bases[j].CodeAndSafety(safety[j]))
-		recursiveFolding(seq, pairs, safety, x+majorx, y+majory, i+1, j-1, dir, c)
+		c.Set(x-minorx, y-minory, l.code(i))
+		c.Set(x+minorx, y+minory, l.code(j))
+		l.draw(x+majorx, y+majory, i+1, j-1, dir)
 	} else if pairs[i] < 0 {
-		c.Set(x-minorx, y-minory, seq.Bases[i].CodeAndSafety(safety[i]))
+		c.Set(x-minorx, y-minory, l.code(i))
 		c.Set(x+minorx, y+minory, "-")
-		recursiveFolding(seq, pairs, safety, x+majorx, y+majory, i+1, j, dir, c)
+		l.draw(x+majorx, y+majory, i+1, j, dir)
 	} else {
 		c.Set(x-minorx, y-minory, "-")
-		c.Set(x+minorx, y+minory, seq.Bases[j].CodeAndSafety(safety[j]))
-		recursiveFolding(seq, pairs, safety, x+majorx, y+majory, i, j-1, dir, c)
+		c.Set(x+minorx, y+minory, l.code(j))
+		l.draw(x+majorx, y+majory, i, j-1, dir)
+	}
+}
+
+// labelHelices writes the index of each helix just before its first pair,
+// if there is room.
+func (l *layout) labelHelices() {
+	for n, h := range l.helices {
+		label := fmt.Sprintf("%d", n+1)
+		majorx, majory, _, _ := directionToVectors(h.dir)
+		x, y := h.x-majorx, h.y-majory
+		if l.c.free(x, y, len(label)) {
+			l.c.Set(x, y, label)
+		} else if l.c.free(x-len(label)+1, y, len(label)) {
+			l.c.Set(x-len(label)+1, y, label)
+		}
 	}
 }
 
+type canvas struct {
+	c map[int]map[int]rune
+	// Earlier contents of cells, for undoing failed layout attempts
+	undo       []undoCell
+	collisions int
+	writes     int
+}
+
+type undoCell struct {
+	x, y    int
+	ch      rune
+	existed bool
+}
+
+func newCanvas() *canvas {
+	return &canvas{c: map[int]map[int]rune{}}
+}
+
 func (c *canvas) Set(x, y int, str string) {
 	line, ok := c.c[y]
 	if !ok {
 		line = make(map[int]rune)
 		c.c[y] = line
 	}
-	for i, ch := range str {
+	for i, ch := range []rune(str) {
+		old, existed := line[x+i]
+		if existed {
+			c.collisions++
+		}
+		c.undo = append(c.undo, undoCell{x + i, y, old, existed})
+		c.writes++
 		line[x+i] = ch
 	}
 }
 
-func keyFromMap(m map[int]interface{}) int {
-	for k := range m {
-		return k
+func (c *canvas) free(x, y, length int) bool {
+	for i := 0; i < length; i++ {
+		if _, ok := c.c[y][x+i]; ok {
+			return false
+		}
 	}
-	return -1
+	return true
 }
 
-func (c *canvas) Draw() string {
-	var miny int
-	for k := range c.c {
-		miny = k
-		break
-	}
-	maxy := miny
-	var minx int
-	for k := range c.c[miny] {
-		miny = k
-		break
-	}
-	maxx := minx
-	for y := range c.c {
-		if y < miny {
-			miny = y
-		}
-		if y > maxy {
-			maxy = y
+// restore undoes all writes after the first n.
+func (c *canvas) restore(n int) {
+	for k := len(c.undo) - 1; k >= n; k-- {
+		u := c.undo[k]
+		if u.existed {
+			c.c[u.y][u.x] = u.ch
+		} else {
+			delete(c.c[u.y], u.x)
 		}
-		for x := range c.c[y] {
+	}
+	c.undo = c.undo[:n]
+}
+
+// Draw returns the contents of the canvas. If maxWidth is positive and the
+// drawing is wider, it is split into blocks of at most maxWidth columns.
+func (c *canvas) Draw(maxWidth int) string {
+	first := true
+	var minx, maxx, miny, maxy int
+	for y, line := range c.c {
+		for x := range line {
+			if first {
+				minx, maxx, miny, maxy = x, x, y, y
+				first = false
+			}
 			if x < minx {
 				minx = x
 			}
 			if x > maxx {
 				maxx = x
 			}
+			if y < miny {
+				miny = y
+			}
+			if y > maxy {
+				maxy = y
+			}
 		}
 	}
+	if first {
+		return ""
+	}
 
 	lines := make([][]rune, maxy-miny+1)
 	for y := 0; y < len(lines); y++ {
@@ -177,9 +358,22 @@ func (c *canvas) Draw() string {
 		}
 	}
 
-	var out string
-	for y := 0; y < len(lines); y++ {
-		out += string(lines[y]) + "\n"
+	width := maxx - minx + 1
+	if maxWidth <= 0 || width <= maxWidth {
+		maxWidth = width
 	}
-	return out
+	var out strings.Builder
+	for start := 0; start < width; start += maxWidth {
+		if start > 0 {
+			out.WriteString("\n")
+		}
+		end := start + maxWidth
+		if end > width {
+			end = width
+		}
+		for y := 0; y < len(lines); y++ {
+			out.WriteString(string(lines[y][start:end]) + "\n")
+		}
+	}
+	return out.String()
 }
@@ -0,0 +1,171 @@
+package format /* import "keltainen.duckdns.org/rnafolding/format" */
+
+import "flag"
+import "io/ioutil"
+import "math/big"
+import "math/rand"
+import "path/filepath"
+import "strings"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
+
+var update = flag.Bool("update", false, "Update golden files in testdata")
+
+func foldWithSafety(t *testing.T, seq *base.Sequence, index int64) (folding.FoldingPairs, []bool) {
+	p := &safecomplete.Predictor{Seq: seq, MinHairpin: 3}
+	p.FillArray()
+	p.CountSolutions()
+	if err := p.CountPairings(); err != nil {
+		t.Fatalf("CountPairings: %v", err)
+	}
+	safety, err := p.SafetyFromBacktrack()
+	if err != nil {
+		t.Fatalf("SafetyFromBacktrack: %v", err)
+	}
+	return p.Unrank(big.NewInt(index)), safety
+}
+
+// countDrawn counts bases and pairs in the drawing part of the output.
+func countDrawn(out string) (int, int) {
+	bases, pairs := 0, 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Helix ") || strings.HasPrefix(line, "Crossing ") {
+			continue
+		}
+		for _, ch := range line {
+			if strings.ContainsRune("ACGUNacgun", ch) {
+				bases++
+			} else if ch == '#' {
+				pairs++
+			}
+		}
+	}
+	return bases, pairs
+}
+
+func TestFoldingGolden(t *testing.T) {
+	files, err := filepath.Glob("../data/*.fasta")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No test sequences found: %v", err)
+	}
+	for _, fname := range files {
+		// The fasta package uses this package, so read the sequence here
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", fname, err)
+		}
+		var bases string
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(line, ">") {
+				bases += strings.TrimSpace(line)
+			}
+		}
+		seq := base.SequenceFromString(bases)
+		pairs, safety := foldWithSafety(t, seq, 0)
+
+		var out strings.Builder
+		out.WriteString(FoldingWithOptions(seq, pairs, safety, Options{HelixIndices: true}))
+		out.WriteString("\n")
+		out.WriteString(FoldingWithOptions(seq, pairs, safety, Options{MaxWidth: 20}))
+
+		golden := filepath.Join("testdata", strings.TrimSuffix(filepath.Base(fname), ".fasta")+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(out.String()), 0644); err != nil {
+				t.Fatalf("WriteFile(%s): %v", golden, err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", golden, err)
+		}
+		if out.String() != string(expected) {
+			t.Errorf("FoldingWithOptions(%s): expected\n%s\ngot\n%s", fname, expected, out.String())
+		}
+	}
+}
+
+func TestFoldingNoCollisions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 40; n++ {
+		bases := make([]rune, 30+r.Intn(120))
+		for i := range bases {
+			bases[i] = rune("ACGU"[r.Intn(4)])
+		}
+		seq := base.SequenceFromString(string(bases))
+		pairs, safety := foldWithSafety(t, seq, 0)
+		out := FoldingWithOptions(seq, pairs, safety, Options{HelixIndices: true})
+
+		numPairs := 0
+		for i, j := range pairs {
+			if j > i {
+				numPairs++
+			}
+		}
+		if drawnBases, drawnPairs := countDrawn(out); drawnBases != len(bases) || drawnPairs < numPairs {
+			t.Errorf("FoldingWithOptions(%s, %s): drew %d bases and %d pairs, expected %d and %d:\n%s",
+				string(bases), DotBracket(pairs), drawnBases, drawnPairs, len(bases), numPairs, out)
+		}
+	}
+}
+
+func TestFoldingCrossing(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAACCCAAAGGGAAACCCGGGAAAAAAACCCAAAA")
+	pairs := folding.NewFoldingPairs(len(seq.Bases))
+	for _, p := range [][2]int{{0, 8}, {1, 7}, {2, 6}, {12, 22}, {13, 21}, {14, 20}, {15, 29}, {16, 28}, {17, 27}} {
+		pairs[p[0]] = p[1]
+		pairs[p[1]] = p[0]
+	}
+	safety := make([]bool, len(seq.Bases))
+	out := FoldingWithSafety(seq, pairs, safety)
+	if !strings.HasSuffix(out, "Crossing pairs not drawn: (15,29), (16,28), (17,27)\n") {
+		t.Errorf("FoldingWithSafety: crossing pairs not listed in\n%s", out)
+	}
+	if bases, drawnPairs := countDrawn(out); bases != len(seq.Bases) || drawnPairs != 6 {
+		t.Errorf("FoldingWithSafety: drew %d bases and %d pairs, expected %d and 6:\n%s", bases, drawnPairs, len(seq.Bases), out)
+	}
+
+	if out := FoldingWithSafety(seq, pairs[1:], safety); !strings.HasPrefix(out, "Cannot draw") {
+		t.Errorf("FoldingWithSafety: expected error for wrong folding length, got\n%s", out)
+	}
+}
+
+func TestPlaceCutShort(t *testing.T) {
+	l := &layout{c: newCanvas()}
+	l.c.Set(0, 0, "x")
+	collide := func(s int) { l.c.Set(0, 0, "y") }
+	l.place(collide)
+	if l.cutShort {
+		t.Errorf("place: search marked as cut short within the write budget")
+	}
+	l.c.writes = maxWrites
+	l.place(collide)
+	if !l.cutShort {
+		t.Errorf("place: search not marked as cut short after the write budget ran out")
+	}
+}
+
+func TestCanvasDraw(t *testing.T) {
+	tests := []struct {
+		cells    map[[2]int]string
+		maxWidth int
+		expected string
+	}{
+		{map[[2]int]string{}, 0, ""},
+		// Leftmost cell is not on the first line
+		{map[[2]int]string{{0, 0}: "ab", {-2, 1}: "c"}, 0, "  ab\nc   \n"},
+		{map[[2]int]string{{0, 0}: "abcde", {0, 1}: "fg"}, 2, "ab\nfg\n\ncd\n  \n\ne\n \n"},
+	}
+	for _, tt := range tests {
+		c := newCanvas()
+		for pos, str := range tt.cells {
+			c.Set(pos[0], pos[1], str)
+		}
+		if actual := c.Draw(tt.maxWidth); actual != tt.expected {
+			t.Errorf("Draw(%v, %d): expected %q, got %q", tt.cells, tt.maxWidth, tt.expected, actual)
+		}
+	}
+}
@@ -7,6 +7,10 @@ func (p *Predictor) Backtrack() (int, folding.FoldingPairs) {
 	for i := 0; i < len(p.V); i++ {
 		paired[i] = -1
 	}
+	if p.NoLonelyPairs {
+		p.backtrackLonely(interval{0, len(p.V) - 1, plain}, paired)
+		return p.V[0][len(p.V)-1], paired
+	}
 	p.recursiveBacktrack(0, len(p.V)-1, paired)
 	return p.V[0][len(p.V)-1], paired
 }
@@ -17,7 +21,18 @@ func (p *Predictor) JoinedBacktrack(i, j int) (int, folding.FoldingPairs) {
 	for i := 0; i < len(p.V); i++ {
 		paired[i] = -1
 	}
-	if p.Seq.CanPair(i, j, p.MinHairpin) {
+	if p.NoLonelyPairs {
+		score, in, out := p.pairScoreLonely(i, j)
+		if score < 0 {
+			return 0, paired
+		}
+		paired[i] = j
+		paired[j] = i
+		p.backtrackLonely(in, paired)
+		p.backtrackLonely(out, paired)
+		return score, paired
+	}
+	if p.canPair(i, j) {
 		paired[i] = j
 		paired[j] = i
 		pairs++
@@ -32,7 +47,7 @@ func (p *Predictor) JoinedBacktrack(i, j int) (int, folding.FoldingPairs) {
 func (p *Predictor) recursiveBacktrack(i, j int, paired folding.FoldingPairs) {
 	if i >= j {
 		return
-	} else if p.Seq.CanPair(i, j, p.MinHairpin) && p.V[i][j] == p.V[i+1][j-1]+1 {
+	} else if p.canPair(i, j) && p.V[i][j] == p.V[i+1][j-1]+1 {
 		paired[i] = j
 		paired[j] = i
 		p.recursiveBacktrack(i+1, j-1, paired)
@@ -55,7 +70,7 @@ func (p *Predictor) complementaryBacktrack(i, j int, paired folding.FoldingPairs
 		p.recursiveBacktrack(j+1, len(p.V)-1, paired)
 	} else if j == len(p.V)-1 {
 		p.recursiveBacktrack(0, i-1, paired)
-	} else if p.Seq.CanPair(i-1, j+1, p.MinHairpin) && p.W[i][j] == p.W[i-1][j+1]+1 {
+	} else if p.canPair(i-1, j+1) && p.W[i][j] == p.W[i-1][j+1]+1 {
 		paired[i-1] = j + 1
 		paired[j+1] = i - 1
 		p.complementaryBacktrack(i-1, j+1, paired)
@@ -1,6 +1,17 @@
 package nussinov /* import "keltainen.duckdns.org/rnafolding/nussinov" */
 
+import "context"
+
 func (p *Predictor) FillArray() {
+	p.FillArrayContext(context.Background())
+}
+
+// FillArrayContext is like FillArray, but stops and returns ctx.Err() if
+// ctx is cancelled before the array is filled.
+func (p *Predictor) FillArrayContext(ctx context.Context) error {
+	if p.NoLonelyPairs {
+		return p.fillArrayLonely(ctx)
+	}
 	numBases := len(p.Seq.Bases)
 	v := make([][]int, numBases)
 	for i := 0; i < numBases; i++ {
@@ -15,6 +26,9 @@ func (p *Predictor) FillArray() {
 	}
 
 	for l := 1; l < numBases; l++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for i := 0; i < numBases-l; i++ {
 			j := i + l
 			best := 0
@@ -24,7 +38,7 @@ func (p *Predictor) FillArray() {
 					best = val
 				}
 			}
-			if p.Seq.CanPair(i, j, p.MinHairpin) {
+			if p.canPair(i, j) {
 				if val := v[i+1][j-1] + 1; val > best {
 					best = val
 				}
@@ -34,9 +48,19 @@ func (p *Predictor) FillArray() {
 	}
 
 	p.V = v
+	return nil
 }
 
 func (p *Predictor) FillComplementary() {
+	p.FillComplementaryContext(context.Background())
+}
+
+// FillComplementaryContext is like FillComplementary, but stops and returns
+// ctx.Err() if ctx is cancelled before the array is filled.
+func (p *Predictor) FillComplementaryContext(ctx context.Context) error {
+	if p.NoLonelyPairs {
+		return p.fillComplementaryLonely(ctx)
+	}
 	numBases := len(p.Seq.Bases)
 	w := make([][]int, numBases)
 	for i := 0; i < numBases; i++ {
@@ -46,6 +70,9 @@ func (p *Predictor) FillComplementary() {
 	w[0][numBases-2] = 0
 	w[1][numBases-1] = 0
 	for l := 2; l < numBases; l++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for j := numBases - l - 1; j < numBases; j++ {
 			i := j + l + 1
 			best := 0
@@ -60,7 +87,7 @@ func (p *Predictor) FillComplementary() {
 					best = val
 				}
 			}
-			if p.Seq.CanPair((i-1)%numBases, (j+1)%numBases, p.MinHairpin) {
+			if p.canPair((i-1)%numBases, (j+1)%numBases) {
 				var val int
 				if i-1 == numBases-1 {
 					val = p.V[j+2][numBases-2] + 1
@@ -77,4 +104,5 @@ func (p *Predictor) FillComplementary() {
 		}
 	}
 	p.W = w
+	return nil
 }
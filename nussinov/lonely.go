@@ -0,0 +1,206 @@
+package nussinov /* import "keltainen.duckdns.org/rnafolding/nussinov" */
+
+import "context"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// Without lonely pairs, a pair may form only if it stacks on another pair,
+// so the best foldings of an interval depend on the pair enclosing it.
+//
+// Zuker's complementary foldings are found the same way as the foldings of
+// intervals, by treating the sequence as circular: the bases outside the
+// pair (i, j) are the interval [j+1, n+i-1] enclosed by the pair (j, n+i),
+// where base n+i is base i. Bases n-1 and n are not adjacent in the
+// sequence, so no pair stacks on another across them.
+
+// kind tells which foldings of an interval are meant.
+type kind int
+
+const (
+	// Any folding, the interval is not directly enclosed by a pair
+	plain kind = iota
+	// i and j pair with each other, stacking on the enclosing pair
+	paired
+	// The interval is directly enclosed by the pair (i-1, j+1), so (i, j)
+	// may pair without a pair stacking inside it
+	inside
+)
+
+type interval struct {
+	i    int
+	j    int
+	kind kind
+}
+
+// canPairCircular tells whether bases i < j of the circular sequence may
+// pair.
+func (p *Predictor) canPairCircular(i, j int) bool {
+	n := len(p.Seq.Bases)
+	return p.canPair(i%n, j%n)
+}
+
+// insideOf returns the interval inside the pair (i, j). It is of inside
+// kind, unless (i+1, j-1) cannot stack on (i, j) because the pairs are on
+// different sides of bases n-1 and n.
+func (p *Predictor) insideOf(i, j int) interval {
+	n := len(p.Seq.Bases)
+	if i%n == n-1 || j%n == 0 {
+		return interval{i + 1, j - 1, plain}
+	}
+	return interval{i + 1, j - 1, inside}
+}
+
+// value returns the number of pairs in the best foldings of iv, or -1 if
+// iv has no foldings.
+func (p *Predictor) value(iv interval) int {
+	switch {
+	case iv.kind == paired && iv.i >= iv.j:
+		return -1
+	case iv.i >= iv.j:
+		return 0
+	}
+	if n := len(p.Seq.Bases); iv.i >= n {
+		return p.lonely[iv.kind][iv.i-n][iv.j-n]
+	}
+	return p.lonely[iv.kind][iv.i][iv.j]
+}
+
+// stacked returns the number of pairs in the best folding of [i, j] in
+// which i and j pair, and (i+1, j-1) pairs and stacks on them. Returns -1
+// if there is no such folding.
+func (p *Predictor) stacked(i, j int) int {
+	if !p.canPairCircular(i, j) || p.insideOf(i, j).kind != inside {
+		return -1
+	}
+	if v := p.value(interval{i + 1, j - 1, paired}); v >= 0 {
+		return v + 1
+	}
+	return -1
+}
+
+// fillLonely fills the entries of [i, j] in the arrays of all kinds.
+func (p *Predictor) fillLonely(i, j int) {
+	s := -1
+	if p.canPairCircular(i, j) {
+		s = 1 + p.value(p.insideOf(i, j))
+	}
+	best := p.stacked(i, j)
+	for k := i; k < j; k++ {
+		if val := p.value(interval{i, k, plain}) + p.value(interval{k + 1, j, plain}); val > best {
+			best = val
+		}
+	}
+	p.lonely[plain][i][j] = best
+	p.lonely[paired][i][j] = s
+	p.lonely[inside][i][j] = best
+	if s > best {
+		p.lonely[inside][i][j] = s
+	}
+}
+
+// fillArrayLonely is FillArrayContext with NoLonelyPairs. The arrays have
+// room for the intervals of the circular sequence, filled by
+// fillComplementaryLonely.
+func (p *Predictor) fillArrayLonely(ctx context.Context) error {
+	numBases := len(p.Seq.Bases)
+	for k := range p.lonely {
+		p.lonely[k] = make([][]int, numBases)
+		for i := range p.lonely[k] {
+			p.lonely[k][i] = make([]int, 2*numBases-1)
+		}
+	}
+	for l := 1; l < numBases; l++ {
+		if err := ctx.Err(); err != nil {
+			p.lonely = [3][][]int{}
+			return err
+		}
+		for i := 0; i < numBases-l; i++ {
+			p.fillLonely(i, i+l)
+		}
+	}
+
+	p.V = make([][]int, numBases)
+	for i := range p.V {
+		p.V[i] = p.lonely[plain][i][:numBases]
+	}
+	return nil
+}
+
+// fillComplementaryLonely is FillComplementaryContext with NoLonelyPairs.
+// W[i][j] is the number of pairs outside the pair (i, j) in the best
+// foldings that contain it.
+func (p *Predictor) fillComplementaryLonely(ctx context.Context) error {
+	numBases := len(p.Seq.Bases)
+	for l := 1; l < numBases-1; l++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := numBases - l; i < numBases; i++ {
+			p.fillLonely(i, i+l)
+		}
+	}
+
+	w := make([][]int, numBases)
+	for i := 0; i < numBases; i++ {
+		w[i] = make([]int, numBases)
+		for j := i + 1; j < numBases; j++ {
+			w[i][j] = p.value(p.insideOf(j, numBases+i))
+		}
+	}
+	p.W = w
+	return nil
+}
+
+// backtrackLonely pairs the bases of one of the best foldings of iv in f.
+func (p *Predictor) backtrackLonely(iv interval, f folding.FoldingPairs) {
+	if iv.i >= iv.j {
+		return
+	}
+	n := len(p.Seq.Bases)
+	i, j := iv.i, iv.j
+	target := p.value(iv)
+	pairUp := func(in interval) {
+		f[i%n] = j % n
+		f[j%n] = i % n
+		p.backtrackLonely(in, f)
+	}
+	switch {
+	case iv.kind == paired || iv.kind == inside && target == p.value(interval{i, j, paired}):
+		pairUp(p.insideOf(i, j))
+	case target == p.stacked(i, j):
+		pairUp(interval{i + 1, j - 1, paired})
+	default:
+		for k := i; k < j; k++ {
+			pre, suf := interval{i, k, plain}, interval{k + 1, j, plain}
+			if p.value(pre)+p.value(suf) == target {
+				p.backtrackLonely(pre, f)
+				p.backtrackLonely(suf, f)
+				break
+			}
+		}
+	}
+}
+
+// pairScoreLonely is PairScore with NoLonelyPairs. It also returns the
+// intervals inside and outside the pair to backtrack for the best folding.
+func (p *Predictor) pairScoreLonely(i, j int) (int, interval, interval) {
+	best, in, out := -1, interval{}, interval{}
+	if !p.canPair(i, j) {
+		return best, in, out
+	}
+	outside := p.insideOf(j, len(p.Seq.Bases)+i)
+	// (i+1, j-1) stacks on (i, j)
+	if v := p.value(interval{i + 1, j - 1, paired}); v >= 0 {
+		best = 1 + v + p.value(outside)
+		in, out = interval{i + 1, j - 1, paired}, outside
+	}
+	// (i-1, j+1) stacks on (i, j)
+	if outside.kind == inside {
+		outside.kind = paired
+		if v := p.value(outside); v >= 0 && 1+p.value(p.insideOf(i, j))+v > best {
+			best = 1 + p.value(p.insideOf(i, j)) + v
+			in, out = p.insideOf(i, j), outside
+		}
+	}
+	return best, in, out
+}
@@ -8,4 +8,20 @@ type Predictor struct {
 	W   [][]int
 
 	MinHairpin int
+	// Largest allowed j - i of a pair (i, j), or 0 for no limit
+	MaxSpan int
+	// Whether every pair must stack on another pair
+	NoLonelyPairs bool
+
+	// Best foldings of each kind of interval of the circular sequence,
+	// only used with NoLonelyPairs. V shares the plain ones.
+	lonely [3][][]int
+}
+
+// canPair tells whether bases i and j may pair, in either order.
+func (p *Predictor) canPair(i, j int) bool {
+	if i > j {
+		i, j = j, i
+	}
+	return (p.MaxSpan == 0 || j-i <= p.MaxSpan) && p.Seq.CanPair(i, j, p.MinHairpin)
 }
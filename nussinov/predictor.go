@@ -0,0 +1,54 @@
+package nussinov /* import "keltainen.duckdns.org/rnafolding/nussinov" */
+
+import "context"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/predictor"
+
+func init() {
+	predictor.Register(predictor.Algorithm{
+		Name: "nussinov",
+		New: func(seq *base.Sequence, rules predictor.Rules) predictor.Predictor {
+			return &Predictor{Seq: seq, MinHairpin: rules.MinHairpin, MaxSpan: rules.MaxSpan, NoLonelyPairs: rules.NoLonelyPairs}
+		},
+	})
+}
+
+// Fill fills both the array of subsequences and the complementary array
+// used by Zuker's method.
+func (p *Predictor) Fill(ctx context.Context) error {
+	if err := p.FillArrayContext(ctx); err != nil {
+		return err
+	}
+	return p.FillComplementaryContext(ctx)
+}
+
+func (p *Predictor) OptimalScore() int {
+	return p.V[0][len(p.V)-1]
+}
+
+func (p *Predictor) Optimal() folding.FoldingPairs {
+	_, f := p.Backtrack()
+	return f
+}
+
+// OptimalFoldings returns the distinct optimal foldings found by Zuker's
+// method, by forcing each possible pair in turn. These are not necessarily
+// all optimal foldings.
+func (p *Predictor) OptimalFoldings(ctx context.Context) (folding.FoldingSet, error) {
+	subopt, err := p.Suboptimals(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, fold := p.Backtrack()
+	optimals := folding.FoldingSet{fold}
+	seen := foldingSet{}
+	seen.add(fold)
+	for _, s := range subopt {
+		if seen.add(s.Folding) {
+			optimals = append(optimals, s.Folding)
+		}
+	}
+	return optimals, nil
+}
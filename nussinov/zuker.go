@@ -0,0 +1,96 @@
+package nussinov /* import "keltainen.duckdns.org/rnafolding/nussinov" */
+
+import "context"
+import "encoding/binary"
+import "sort"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// PairFolding is the best folding that contains the pair (I, J), and the
+// number of pairs in it.
+type PairFolding struct {
+	I       int
+	J       int
+	Score   int
+	Folding folding.FoldingPairs
+}
+
+// PairScore returns the number of pairs in the best folding that contains
+// the pair (i, j), or -1 if no folding contains it. Requires both FillArray
+// and FillComplementary to have been run.
+func (p *Predictor) PairScore(i, j int) int {
+	if p.NoLonelyPairs {
+		score, _, _ := p.pairScoreLonely(i, j)
+		return score
+	}
+	if !p.canPair(i, j) {
+		return -1
+	}
+	return 1 + p.V[i+1][j-1] + p.W[i][j]
+}
+
+// PairFoldings returns the best folding containing each pair that can be
+// formed, ordered by i and then j. There are up to n² pairs for a sequence
+// of n bases, so the result takes a lot of memory for long sequences.
+func (p *Predictor) PairFoldings(ctx context.Context) ([]PairFolding, error) {
+	var out []PairFolding
+	for i := 0; i < len(p.Seq.Bases); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for j := i + 1; j < len(p.Seq.Bases); j++ {
+			if score := p.PairScore(i, j); score >= 0 {
+				_, f := p.JoinedBacktrack(i, j)
+				out = append(out, PairFolding{i, j, score, f})
+			}
+		}
+	}
+	return out, nil
+}
+
+// Suboptimals returns the distinct foldings among the best foldings of
+// each pair, whose number of pairs is at most percent per cent less than
+// optimal, like the P parameter of mfold. The foldings are sorted by
+// decreasing number of pairs, and among equal ones by the pair that
+// produced them. Only the first pair producing each folding is reported.
+func (p *Predictor) Suboptimals(ctx context.Context, percent int) ([]PairFolding, error) {
+	optimal := p.V[0][len(p.V)-1]
+	seen := foldingSet{}
+	var out []PairFolding
+	for i := 0; i < len(p.Seq.Bases); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for j := i + 1; j < len(p.Seq.Bases); j++ {
+			score := p.PairScore(i, j)
+			if score < 0 || score*100 < optimal*(100-percent) {
+				continue
+			}
+			_, f := p.JoinedBacktrack(i, j)
+			if seen.add(f) {
+				out = append(out, PairFolding{i, j, score, f})
+			}
+		}
+	}
+	sort.SliceStable(out, func(a, b int) bool {
+		return out[a].Score > out[b].Score
+	})
+	return out, nil
+}
+
+// foldingSet holds distinct foldings in a hash table, keyed by their
+// encoding as bytes.
+type foldingSet map[string]struct{}
+
+// add adds f to the set. Returns false if it was already there.
+func (s foldingSet) add(f folding.FoldingPairs) bool {
+	key := make([]byte, 0, 2*len(f))
+	for _, j := range f {
+		key = binary.AppendVarint(key, int64(j))
+	}
+	if _, ok := s[string(key)]; ok {
+		return false
+	}
+	s[string(key)] = struct{}{}
+	return true
+}
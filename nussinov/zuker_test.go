@@ -0,0 +1,165 @@
+package nussinov /* import "keltainen.duckdns.org/rnafolding/nussinov" */
+
+import "context"
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/wuchty"
+
+func countPairs(f folding.FoldingPairs) int {
+	c := 0
+	for _, j := range f {
+		if j >= 0 {
+			c++
+		}
+	}
+	return c / 2
+}
+
+func TestPairFoldings(t *testing.T) {
+	for _, str := range []string{"GGGAAAUCC", "GGGAAAUCCAAACCCUUUGGG", "ACGUACGUACGUACGUACGU"} {
+		seq := base.SequenceFromString(str)
+		p := &Predictor{Seq: seq, MinHairpin: 3}
+		p.FillArray()
+		p.FillComplementary()
+
+		// All foldings, to find the best one containing each pair
+		w := &wuchty.Predictor{Seq: seq, MinHairpin: 3}
+		w.FillArray()
+		all := w.BacktrackWithin(p.V[0][len(seq.Bases)-1])
+		best := map[[2]int]int{}
+		for _, f := range all {
+			for i, j := range f {
+				if i < j && countPairs(f) > best[[2]int{i, j}] {
+					best[[2]int{i, j}] = countPairs(f)
+				}
+			}
+		}
+
+		pf, err := p.PairFoldings(context.Background())
+		if err != nil {
+			t.Fatalf("PairFoldings(%s): %v", str, err)
+		}
+		if len(pf) != len(best) {
+			t.Errorf("PairFoldings(%s): %d pairs, expected %d", str, len(pf), len(best))
+		}
+		for _, b := range pf {
+			if b.Score != best[[2]int{b.I, b.J}] || b.Score != p.PairScore(b.I, b.J) {
+				t.Errorf("PairFoldings(%s): pair (%d, %d) score %d, expected %d", str, b.I, b.J, b.Score, best[[2]int{b.I, b.J}])
+			}
+			if b.Folding[b.I] != b.J || countPairs(b.Folding) != b.Score {
+				t.Errorf("PairFoldings(%s): folding %v for pair (%d, %d) does not contain it with %d pairs", str, b.Folding, b.I, b.J, b.Score)
+			}
+		}
+	}
+}
+
+func TestSuboptimals(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAAUCCAAACCCUUUGGG")
+	p := &Predictor{Seq: seq, MinHairpin: 3}
+	p.FillArray()
+	p.FillComplementary()
+	pf, err := p.PairFoldings(context.Background())
+	if err != nil {
+		t.Fatalf("PairFoldings: %v", err)
+	}
+
+	for _, percent := range []int{0, 20, 50, 100} {
+		subopt, err := p.Suboptimals(context.Background(), percent)
+		if err != nil {
+			t.Fatalf("Suboptimals(%d): %v", percent, err)
+		}
+		var expected folding.FoldingSet
+		for _, b := range pf {
+			if b.Score*100 >= 6*(100-percent) {
+				if found, _ := folding.FoldingInArray(b.Folding, expected); !found {
+					expected = append(expected, b.Folding)
+				}
+			}
+		}
+		var ff folding.FoldingSet
+		for i, s := range subopt {
+			if i > 0 && s.Score > subopt[i-1].Score {
+				t.Errorf("Suboptimals(%d): not sorted by score", percent)
+			}
+			if !reflect.DeepEqual(s.Folding, pf[indexOf(pf, s.I, s.J)].Folding) {
+				t.Errorf("Suboptimals(%d): folding for (%d, %d) is not the best folding of the pair", percent, s.I, s.J)
+			}
+			ff = append(ff, s.Folding)
+		}
+		if equal, err := folding.FoldingSetsEqual(ff, expected); err != nil || !equal || len(ff) != len(expected) {
+			t.Errorf("Suboptimals(%d): %d foldings, expected %d distinct foldings", percent, len(ff), len(expected))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Suboptimals(ctx, 0); err != context.Canceled {
+		t.Errorf("Suboptimals with cancelled context: expected context.Canceled, got %v", err)
+	}
+}
+
+func indexOf(pf []PairFolding, i, j int) int {
+	for n, b := range pf {
+		if b.I == i && b.J == j {
+			return n
+		}
+	}
+	return -1
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		seq     string
+		maxSpan int
+		noLP    bool
+	}{
+		{"GGGAAAUCCAAACCCUUUGGG", 0, true},
+		{"GGGAAAUCCAAACCCUUUGGG", 8, false},
+		{"GGGAAAUCCAAACCCUUUGGG", 10, true},
+		{"GCGCAAAGCAAAGCGCAAAGCGC", 0, true},
+		{"ACGUACGUACGUACGUACGU", 7, true},
+		{"CCAGAAAUCCAAAGGAGGAAACUGG", 0, true},
+	}
+	for _, tt := range tests {
+		seq := base.SequenceFromString(tt.seq)
+		p := &Predictor{Seq: seq, MinHairpin: 3, MaxSpan: tt.maxSpan, NoLonelyPairs: tt.noLP}
+		p.FillArray()
+		p.FillComplementary()
+
+		w := &wuchty.Predictor{Seq: seq, MinHairpin: 3, MaxSpan: tt.maxSpan, NoLonelyPairs: tt.noLP}
+		w.FillArray()
+		all := w.BacktrackWithin(w.V[0][len(seq.Bases)-1])
+		best := map[[2]int]int{}
+		for _, f := range all {
+			for i, j := range f {
+				if i < j && countPairs(f) > best[[2]int{i, j}] {
+					best[[2]int{i, j}] = countPairs(f)
+				}
+			}
+		}
+
+		if score, f := p.Backtrack(); score != w.V[0][len(seq.Bases)-1] || countPairs(f) != score {
+			t.Errorf("%s, span %d, no lonely pairs %v: Backtrack %d pairs, folding %v, expected %d pairs", tt.seq, tt.maxSpan, tt.noLP, score, f, w.V[0][len(seq.Bases)-1])
+		} else if found, _ := folding.FoldingInArray(f, all); !found {
+			t.Errorf("%s, span %d, no lonely pairs %v: Backtrack folding %v is not allowed", tt.seq, tt.maxSpan, tt.noLP, f)
+		}
+		pf, err := p.PairFoldings(context.Background())
+		if err != nil {
+			t.Fatalf("PairFoldings: %v", err)
+		}
+		if len(pf) != len(best) {
+			t.Errorf("%s, span %d, no lonely pairs %v: %d pairs, expected %d", tt.seq, tt.maxSpan, tt.noLP, len(pf), len(best))
+		}
+		for _, b := range pf {
+			if b.Score != best[[2]int{b.I, b.J}] {
+				t.Errorf("%s, span %d, no lonely pairs %v: pair (%d, %d) score %d, expected %d", tt.seq, tt.maxSpan, tt.noLP, b.I, b.J, b.Score, best[[2]int{b.I, b.J}])
+			}
+			if found, _ := folding.FoldingInArray(b.Folding, all); !found || b.Folding[b.I] != b.J || countPairs(b.Folding) != b.Score {
+				t.Errorf("%s, span %d, no lonely pairs %v: folding %v for pair (%d, %d) is not allowed or does not contain it with %d pairs", tt.seq, tt.maxSpan, tt.noLP, b.Folding, b.I, b.J, b.Score)
+			}
+		}
+	}
+}
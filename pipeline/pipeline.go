@@ -0,0 +1,516 @@
+package pipeline /* import "keltainen.duckdns.org/rnafolding/pipeline" */
+
+import "context"
+import "errors"
+import "fmt"
+import "math/big"
+import "reflect"
+import "time"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/compare"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/format"
+import "keltainen.duckdns.org/rnafolding/predictor"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
+import "keltainen.duckdns.org/rnafolding/types"
+
+// Register the predictors included in this repository
+import _ "keltainen.duckdns.org/rnafolding/nussinov"
+import _ "keltainen.duckdns.org/rnafolding/wuchty"
+
+// Formats of the folding tree in OutputEntry.SafeCompleteFoldingTree
+const (
+	TreeNone = ""
+	TreeText = "text"
+	TreeDot  = "dot"
+)
+
+// Options selects the folding rules, the algorithms run in addition to the
+// safe and complete algorithm, and the outputs built for each sequence.
+type Options struct {
+	Rules predictor.Rules
+
+	// Names of registered algorithms to run and check against the safe and
+	// complete algorithm, which is always run
+	Algorithms []string
+	// Compute safety also with the trivial algorithm and check that the
+	// results agree
+	TrivialSafety bool
+
+	// Format of the folding tree, TreeNone leaves it out
+	TreeFormat string
+	// Draw foldings as ASCII art, wrapped to AsciiWidth columns if it is
+	// not zero
+	AsciiArt   bool
+	AsciiWidth int
+	// Maximum number of optimal foldings listed. Zero lists all
+	MaxListed int64
+	// Sequences with more optimal foldings than this are skipped after
+	// counting the foldings. Zero does not limit
+	MaxFoldings int64
+	// List also foldings with at most Delta pairs less than optimal,
+	// at most MaxListed of them with the most pairs
+	Delta int
+}
+
+// DefaultOptions returns the options used by the rnafolding command: all
+// algorithms are run and all outputs are built.
+func DefaultOptions() Options {
+	return Options{
+		Rules:         predictor.Rules{MinHairpin: 3},
+		Algorithms:    []string{"nussinov", "wuchty", "safecomplete"},
+		TrivialSafety: true,
+		TreeFormat:    TreeText,
+		AsciiArt:      true,
+		MaxListed:     1000,
+	}
+}
+
+// Validate checks that the options are usable.
+func (opts Options) Validate() error {
+	if opts.Rules.MinHairpin < 0 {
+		return fmt.Errorf("minimum hairpin length must not be negative, got %d", opts.Rules.MinHairpin)
+	}
+	if opts.Rules.MaxSpan < 0 {
+		return fmt.Errorf("maximum pair span must not be negative, got %d", opts.Rules.MaxSpan)
+	}
+	for _, name := range opts.Algorithms {
+		if _, err := predictor.Lookup(name); err != nil {
+			return err
+		}
+	}
+	if opts.TreeFormat != TreeNone && opts.TreeFormat != TreeText && opts.TreeFormat != TreeDot {
+		return fmt.Errorf("unknown folding tree format %q, must be %s or %s", opts.TreeFormat, TreeText, TreeDot)
+	}
+	if opts.AsciiWidth < 0 {
+		return fmt.Errorf("ASCII drawing width must not be negative, got %d", opts.AsciiWidth)
+	}
+	if opts.MaxListed < 0 {
+		return fmt.Errorf("maximum number of listed foldings must not be negative, got %d", opts.MaxListed)
+	}
+	if opts.MaxFoldings < 0 {
+		return fmt.Errorf("maximum number of foldings must not be negative, got %d", opts.MaxFoldings)
+	}
+	if opts.Delta < 0 {
+		return fmt.Errorf("suboptimal pair count range must not be negative, got %d", opts.Delta)
+	}
+	return nil
+}
+
+// Status of the analysis in OutputEntry.Status
+const (
+	StatusDone    = "done"
+	StatusSkipped = "skipped"
+	StatusAborted = "aborted"
+)
+
+// FoldingLimitError tells that a sequence was skipped because it has more
+// optimal foldings than Options.MaxFoldings.
+type FoldingLimitError struct {
+	Foldings *big.Int
+	Max      int64
+}
+
+func (e *FoldingLimitError) Error() string {
+	return fmt.Sprintf("%v optimal foldings, more than the maximum of %d", e.Foldings, e.Max)
+}
+
+type Timing struct {
+	ZukerSeconds              float64
+	WuchtySeconds             float64
+	SafeCompleteSeconds       float64
+	PairArraysSeconds         float64
+	SafeCompleteTotalSeconds  float64
+	TrivialSafetySeconds      float64
+	SafeCompleteSafetySeconds float64
+	SuboptimalSeconds         float64
+}
+
+type Counts struct {
+	SequenceBases          int
+	OptimalPairs           int
+	ZukerFoldings          int
+	WuchtyFoldings         int
+	SafeCompleteFoldings   *big.Int
+	AfterCollapseTree      *big.Int
+	AfterLiftCommon        *big.Int
+	SafeCompletePairArrays int
+	SafeBases              int
+	SuboptimalFoldings     int64
+
+	ExpectedPairDistance      float64
+	ExpectedReferenceDistance float64
+	ConsensusDistance         []*big.Int
+}
+
+// PredictorResult summarizes the results of one registered algorithm.
+type PredictorResult struct {
+	Name         string
+	Complete     bool
+	Seconds      float64
+	OptimalPairs int
+	Foldings     int
+	Sanity       string
+}
+
+type Sanity struct {
+	Zuker        string
+	Wuchty       string
+	SafeComplete string
+	Safety       string
+}
+
+type Folding struct {
+	Pairing    folding.FoldingPairs
+	PairCount  int
+	DotBracket string
+	AsciiArt   string
+}
+
+type Safety struct {
+	SafeBase  []bool
+	PairCount [][]*big.Int
+	FreeCount []*big.Int
+}
+
+type ReferenceComparison struct {
+	Zuker     []compare.Comparison
+	Example   compare.Comparison
+	Consensus compare.Comparison
+}
+
+// Optimality tells whether the reference folding is one of the optimal
+// foldings, and if not, why.
+type Optimality struct {
+	Membership *safecomplete.Membership
+	// Why optimality of the reference could not be checked
+	Error string
+}
+
+type OutputEntry struct {
+	Name                    string
+	Comment                 string
+	Sequence                string
+	SequenceWithSafety      string
+	Rules                   predictor.Rules
+	Predictors              []PredictorResult
+	Timing                  Timing
+	Counts                  Counts
+	Sanity                  Sanity
+	ReferenceOptimality     *Optimality
+	ReferenceFolding        Folding
+	ZukerFoldings           []Folding
+	AllFoldings             []Folding
+	ConsensusFolding        Folding
+	ReferenceComparison     *ReferenceComparison
+	SafeCompleteFoldingTree string
+	SafeCompleteTree        *types.FoldTree
+	Safety                  Safety
+	ReferencePosition       []int
+
+	// Foldings with at most Delta pairs less than optimal, with the most
+	// pairs first. Counts.SuboptimalFoldings tells how many there are in
+	// total
+	Delta              int
+	SuboptimalFoldings []Folding
+
+	// StatusDone, or StatusSkipped or StatusAborted with the reason in
+	// Reason. Only some results are present in skipped and aborted entries
+	Status string
+	Reason string
+}
+
+// SafePairs returns the pairs that appear in all optimal foldings.
+func (o *OutputEntry) SafePairs() folding.FoldingPairs {
+	f := folding.NewFoldingPairs(len(o.Safety.PairCount))
+	for i, row := range o.Safety.PairCount {
+		for j := i + 1; j < len(row); j++ {
+			if row[j].Cmp(o.Counts.SafeCompleteFoldings) == 0 {
+				f[i] = j
+				f[j] = i
+			}
+		}
+	}
+	return f
+}
+
+// Fold analyzes the optimal foldings of seq with the algorithms and outputs
+// selected in opts.
+//
+// If the analysis is stopped because ctx is done, because seq has more
+// optimal foldings than opts.MaxFoldings or because an algorithm fails,
+// Fold returns the error together with an entry that has Status and Reason
+// set and contains the results computed so far.
+func Fold(ctx context.Context, seq *base.Sequence, opts Options) (*OutputEntry, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if seq == nil || len(seq.Bases) == 0 {
+		return nil, errors.New("sequence has no bases")
+	}
+
+	o := &OutputEntry{
+		Name:     seq.Name,
+		Comment:  seq.Comment,
+		Sequence: seq.BasesString(),
+		Rules:    opts.Rules,
+		Status:   StatusDone,
+		Counts: Counts{
+			SequenceBases: len(seq.Bases),
+		},
+		ReferencePosition: seq.ReferencePosition,
+	}
+	stop := func(stage string, err error) (*OutputEntry, error) {
+		o.Status = StatusAborted
+		if _, ok := err.(*FoldingLimitError); ok {
+			o.Status = StatusSkipped
+		}
+		o.Reason = fmt.Sprintf("%s: %v", stage, err)
+		return o, err
+	}
+
+	scStart := time.Now()
+	sc := &safecomplete.Predictor{
+		Seq:           seq,
+		MinHairpin:    opts.Rules.MinHairpin,
+		MaxSpan:       opts.Rules.MaxSpan,
+		NoLonelyPairs: opts.Rules.NoLonelyPairs,
+	}
+	if err := sc.FillArrayContext(ctx); err != nil {
+		return stop("safe and complete fill", err)
+	}
+	fillTime := time.Since(scStart)
+	flen := sc.V[0][len(seq.Bases)-1]
+	o.Counts.OptimalPairs = flen
+
+	countStart := time.Now()
+	if err := sc.CountSolutionsContext(ctx); err != nil {
+		return stop("counting foldings", err)
+	}
+	countTime := time.Since(countStart)
+	o.Counts.SafeCompleteFoldings = sc.CountOptimal()
+	if opts.MaxFoldings > 0 && o.Counts.SafeCompleteFoldings.Cmp(big.NewInt(opts.MaxFoldings)) > 0 {
+		return stop("counting foldings", &FoldingLimitError{Foldings: o.Counts.SafeCompleteFoldings, Max: opts.MaxFoldings})
+	}
+
+	treeStart := time.Now()
+	scFoldings, err := sc.BacktrackFoldingContext(ctx)
+	if err != nil {
+		return stop("building folding tree", err)
+	}
+	scCountOriginal := scFoldings.CountSolutions()
+	scFoldings.CollapseTree()
+	scCountCollapsed := scFoldings.CountSolutions()
+	scFoldings.LiftCommon()
+	scCountLifted := scFoldings.CountSolutions()
+	scTime := fillTime + time.Since(treeStart)
+
+	paStart := time.Now()
+	scPairArrays, err := listFoldings(ctx, seq, scFoldings, opts.MaxListed)
+	if err != nil {
+		return stop("listing foldings", err)
+	}
+	paTime := time.Since(paStart)
+	scTotalTime := scTime + paTime
+
+	var results []PredictorResult
+	var zukerOptimals folding.FoldingSet
+	for _, name := range opts.Algorithms {
+		if name == "safecomplete" {
+			continue
+		}
+		r, foldings, err := runPredictor(ctx, name, seq, opts.Rules, scCountOriginal, scPairArrays)
+		if err != nil {
+			return stop(name, err)
+		}
+		results = append(results, r)
+		if name == "nussinov" {
+			zukerOptimals = foldings
+		}
+	}
+
+	var suboptimals folding.FoldingSet
+	var numSuboptimal int64
+	suboptStart := time.Now()
+	if opts.Delta > 0 {
+		suboptimals, numSuboptimal, err = runSuboptimal(ctx, seq, opts.Rules, opts.Delta, opts.MaxListed)
+		if err != nil {
+			return stop("suboptimal foldings", err)
+		}
+	}
+	suboptTime := time.Since(suboptStart)
+
+	var safety []bool
+	trsaStart := time.Now()
+	if opts.TrivialSafety {
+		safety, err = sc.IteratedTrivialSafetyContext(ctx, scFoldings)
+		if err != nil {
+			return stop("trivial safety", err)
+		}
+	}
+	trsaTime := time.Since(trsaStart)
+	newsaStart := time.Now()
+	if err := sc.CountPairingsContext(ctx); err != nil {
+		return stop("counting pairings", err)
+	}
+	newSafety, err := sc.SafetyFromBacktrack()
+	if err != nil {
+		return stop("safety", err)
+	}
+	newsaTime := countTime + time.Since(newsaStart)
+
+	var safetySanity string
+	if !opts.TrivialSafety {
+		safety = newSafety
+	} else if !reflect.DeepEqual(safety, newSafety) {
+		safetySanity = "Sanity check failed! TrivialSafety and SafetyFromBacktrack return different values!"
+	}
+	numSafe := 0
+	for _, s := range safety {
+		if s {
+			numSafe++
+		}
+	}
+
+	pairDistance, _ := sc.ExpectedPairDistance().Float64()
+	consensus := sc.Consensus()
+	consensusDistance := sc.DistanceHistogram(consensus)
+	var refDistance float64
+	var refComparison *ReferenceComparison
+	var refOptimality *Optimality
+	if len(seq.ReferenceFolding) == len(seq.Bases) {
+		refDistance, _ = sc.ExpectedDistanceTo(seq.ReferenceFolding).Float64()
+		refComparison = &ReferenceComparison{
+			Example:   compare.Compare(scPairArrays[0], seq.ReferenceFolding),
+			Consensus: compare.Compare(consensus, seq.ReferenceFolding),
+		}
+		membership, err := sc.Membership(seq.ReferenceFolding)
+		refOptimality = &Optimality{Membership: membership}
+		if err != nil {
+			refOptimality.Error = err.Error()
+		}
+		for _, f := range zukerOptimals {
+			refComparison.Zuker = append(refComparison.Zuker, compare.Compare(f, seq.ReferenceFolding))
+		}
+	}
+
+	o.SequenceWithSafety = seq.BasesSafetyString(safety)
+	o.Predictors = results
+	o.Timing = Timing{
+		SafeCompleteSeconds:       scTime.Seconds(),
+		PairArraysSeconds:         paTime.Seconds(),
+		SafeCompleteTotalSeconds:  scTotalTime.Seconds(),
+		SafeCompleteSafetySeconds: newsaTime.Seconds(),
+	}
+	o.Counts = Counts{
+		SequenceBases:          len(seq.Bases),
+		OptimalPairs:           flen,
+		ZukerFoldings:          len(zukerOptimals),
+		SafeCompleteFoldings:   scCountOriginal,
+		AfterCollapseTree:      scCountCollapsed,
+		AfterLiftCommon:        scCountLifted,
+		SafeCompletePairArrays: len(scPairArrays),
+		SafeBases:              numSafe,
+		SuboptimalFoldings:     numSuboptimal,
+
+		ExpectedPairDistance:      pairDistance,
+		ExpectedReferenceDistance: refDistance,
+		ConsensusDistance:         consensusDistance,
+	}
+	o.Sanity = Sanity{
+		SafeComplete: sanitySafeComplete(sc, scFoldings, opts.Rules, flen, scPairArrays),
+		Safety:       safetySanity,
+	}
+	o.ReferenceFolding = foldingsToOutputFormat(seq, folding.FoldingSet{seq.ReferenceFolding}, safety, opts)[0]
+	o.ZukerFoldings = foldingsToOutputFormat(seq, zukerOptimals, safety, opts)
+	o.AllFoldings = foldingsToOutputFormat(seq, scPairArrays, safety, opts)
+	o.ConsensusFolding = foldingsToOutputFormat(seq, folding.FoldingSet{consensus}, safety, opts)[0]
+	o.Delta = opts.Delta
+	o.SuboptimalFoldings = foldingsToOutputFormat(seq, suboptimals, safety, opts)
+	o.ReferenceComparison = refComparison
+	o.ReferenceOptimality = refOptimality
+	o.SafeCompleteFoldingTree = formatTree(scFoldings, opts.TreeFormat)
+	o.SafeCompleteTree = scFoldings
+	o.Safety = Safety{
+		SafeBase:  safety,
+		PairCount: sc.PairSafety,
+		FreeCount: sc.SingleSafety,
+	}
+	// Fields kept from the time when only these algorithms were run
+	for _, r := range results {
+		switch r.Name {
+		case "nussinov":
+			o.Timing.ZukerSeconds = r.Seconds
+			o.Sanity.Zuker = r.Sanity
+		case "wuchty":
+			o.Timing.WuchtySeconds = r.Seconds
+			o.Counts.WuchtyFoldings = r.Foldings
+			o.Sanity.Wuchty = r.Sanity
+		}
+	}
+	if opts.TrivialSafety {
+		o.Timing.TrivialSafetySeconds = trsaTime.Seconds()
+	}
+	if opts.Delta > 0 {
+		o.Timing.SuboptimalSeconds = suboptTime.Seconds()
+	}
+	return o, nil
+}
+
+func foldingsToOutputFormat(seq *base.Sequence, ff folding.FoldingSet, safety []bool, opts Options) []Folding {
+	if len(ff) == 1 && ff[0] == nil {
+		// Escape hatch for reference foldings, when one does not exist
+		return []Folding{{}}
+	}
+	out := make([]Folding, len(ff))
+	for i, f := range ff {
+		out[i] = Folding{
+			Pairing:    f,
+			PairCount:  countPairs(f),
+			DotBracket: format.DotBracket(f),
+		}
+		if opts.AsciiArt {
+			out[i].AsciiArt = DrawAscii(seq, f, safety, opts.AsciiWidth)
+		}
+	}
+	return out
+}
+
+// DrawAscii draws a folding as ASCII art with numbered helices, wrapped to
+// maxWidth columns if it is not zero.
+func DrawAscii(seq *base.Sequence, f folding.FoldingPairs, safety []bool, maxWidth int) string {
+	return format.FoldingWithOptions(seq, f, safety, format.Options{MaxWidth: maxWidth, HelixIndices: true})
+}
+
+func formatTree(tree *types.FoldTree, treeFormat string) string {
+	switch treeFormat {
+	case TreeText:
+		return tree.String()
+	case TreeDot:
+		return tree.Dot()
+	}
+	return ""
+}
+
+func listFoldings(ctx context.Context, seq *base.Sequence, tree *types.FoldTree, maxListed int64) (folding.FoldingSet, error) {
+	var ff folding.FoldingSet
+	it := tree.Iterate(ctx, len(seq.Bases))
+	if maxListed > 0 {
+		it.Limit(maxListed)
+	}
+	for it.Next() {
+		ff = append(ff, it.Folding())
+	}
+	return ff, it.Err()
+}
+
+func countPairs(f []int) int {
+	c := 0
+	for _, n := range f {
+		if n >= 0 {
+			c++
+		}
+	}
+	return c / 2
+}
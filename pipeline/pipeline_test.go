@@ -0,0 +1,343 @@
+package pipeline /* import "keltainen.duckdns.org/rnafolding/pipeline" */
+
+import "context"
+import "reflect"
+import "strings"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/fasta"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/predictor"
+import "keltainen.duckdns.org/rnafolding/wuchty"
+
+func testSequence(t *testing.T) *base.Sequence {
+	seq, err := fasta.ReadSequence(strings.NewReader(
+		">test Two independently variable parts\n" +
+			"GGGAAAUCCAAACCCUUUGGG\n" +
+			"(((...)))...(((...)))\n"))
+	if err != nil {
+		t.Fatalf("ReadSequence: %v", err)
+	}
+	return seq
+}
+
+func TestFold(t *testing.T) {
+	seq := testSequence(t)
+	o, err := Fold(context.Background(), seq, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Fold: %v", err)
+	}
+	if o.Status != StatusDone || o.Reason != "" {
+		t.Errorf("Fold: status %q, reason %q", o.Status, o.Reason)
+	}
+	if o.Sanity != (Sanity{}) {
+		t.Errorf("Fold: sanity checks failed: %+v", o.Sanity)
+	}
+	if o.Counts.SequenceBases != len(seq.Bases) {
+		t.Errorf("Counts.SequenceBases = %d, want %d", o.Counts.SequenceBases, len(seq.Bases))
+	}
+	if o.Counts.OptimalPairs != 6 {
+		t.Errorf("Counts.OptimalPairs = %d, want 6", o.Counts.OptimalPairs)
+	}
+	if n := o.Counts.SafeCompleteFoldings.Int64(); int(n) != o.Counts.WuchtyFoldings || int(n) != len(o.AllFoldings) {
+		t.Errorf("Fold: %d safe and complete foldings, %d Wuchty foldings and %d listed foldings",
+			n, o.Counts.WuchtyFoldings, len(o.AllFoldings))
+	}
+	if len(o.Predictors) != 2 {
+		t.Errorf("Fold: results of %d predictors, want 2", len(o.Predictors))
+	}
+	if len(o.ZukerFoldings) == 0 || o.SafeCompleteFoldingTree == "" || o.AllFoldings[0].AsciiArt == "" {
+		t.Errorf("Fold: outputs missing with default options")
+	}
+	if len(o.Safety.SafeBase) != len(seq.Bases) {
+		t.Errorf("len(Safety.SafeBase) = %d, want %d", len(o.Safety.SafeBase), len(seq.Bases))
+	}
+	if o.ReferenceComparison == nil || o.ReferenceOptimality == nil || o.ReferenceOptimality.Membership == nil {
+		t.Fatalf("Fold: reference folding not compared")
+	}
+	if !o.ReferenceOptimality.Membership.Optimal {
+		t.Errorf("Fold: reference folding not recognized as optimal: %v", o.ReferenceOptimality.Membership)
+	}
+	if safe := o.SafePairs(); countPairs(safe) > o.Counts.OptimalPairs {
+		t.Errorf("SafePairs() = %v, more pairs than in an optimal folding", safe)
+	}
+}
+
+func TestFoldOptions(t *testing.T) {
+	seq := testSequence(t)
+	full, err := Fold(context.Background(), seq, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Fold: %v", err)
+	}
+
+	opts := Options{Rules: predictor.Rules{MinHairpin: 3}, MaxListed: 2}
+	o, err := Fold(context.Background(), seq, opts)
+	if err != nil {
+		t.Fatalf("Fold(%+v): %v", opts, err)
+	}
+	if o.Sanity != (Sanity{}) {
+		t.Errorf("Fold(%+v): sanity checks failed: %+v", opts, o.Sanity)
+	}
+	if len(o.Predictors) != 0 || len(o.ZukerFoldings) != 0 || o.Counts.WuchtyFoldings != 0 {
+		t.Errorf("Fold(%+v): ran algorithms that were not selected", opts)
+	}
+	if o.SafeCompleteFoldingTree != "" || o.AllFoldings[0].AsciiArt != "" {
+		t.Errorf("Fold(%+v): built outputs that were not selected", opts)
+	}
+	if len(o.AllFoldings) != 2 {
+		t.Errorf("Fold(%+v): listed %d foldings, want 2", opts, len(o.AllFoldings))
+	}
+	if o.Counts.OptimalPairs != full.Counts.OptimalPairs {
+		t.Errorf("Fold(%+v): %d optimal pairs, want %d", opts, o.Counts.OptimalPairs, full.Counts.OptimalPairs)
+	}
+	if !reflect.DeepEqual(o.Safety.SafeBase, full.Safety.SafeBase) {
+		t.Errorf("Fold(%+v): safety %v, want %v", opts, o.Safety.SafeBase, full.Safety.SafeBase)
+	}
+}
+
+func TestFoldErrors(t *testing.T) {
+	seq := testSequence(t)
+	badOptions := []func(*Options){
+		func(o *Options) { o.Rules.MinHairpin = -1 },
+		func(o *Options) { o.Algorithms = []string{"nussinov", "nonexistent"} },
+		func(o *Options) { o.TreeFormat = "xml" },
+		func(o *Options) { o.AsciiWidth = -1 },
+		func(o *Options) { o.MaxListed = -1 },
+		func(o *Options) { o.MaxFoldings = -1 },
+		func(o *Options) { o.Delta = -1 },
+		func(o *Options) { o.Rules.MaxSpan = -1 },
+	}
+	for i, modify := range badOptions {
+		opts := DefaultOptions()
+		modify(&opts)
+		if _, err := Fold(context.Background(), seq, opts); err == nil {
+			t.Errorf("Fold with bad options %d (%+v) returned no error", i, opts)
+		}
+	}
+	if _, err := Fold(context.Background(), base.SequenceFromString(""), DefaultOptions()); err == nil {
+		t.Errorf("Fold of empty sequence returned no error")
+	}
+}
+
+func TestRegisteredPredictors(t *testing.T) {
+	seq := testSequence(t)
+	rules := predictor.Rules{MinHairpin: 3}
+	for _, name := range []string{"nussinov", "wuchty", "safecomplete"} {
+		a, err := predictor.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%s): %v", name, err)
+		}
+		p := a.New(seq, rules)
+		if err := p.Fill(context.Background()); err != nil {
+			t.Fatalf("%s: Fill: %v", name, err)
+		}
+		if score := p.OptimalScore(); score != 6 {
+			t.Errorf("%s: OptimalScore() = %d, want 6", name, score)
+		}
+		if sanity := singleFoldingSanity(seq, p.Optimal(), rules, 6); sanity != "" {
+			t.Errorf("%s: Optimal() = %v: %s", name, p.Optimal(), sanity)
+		}
+		ff, err := p.OptimalFoldings(context.Background())
+		if err != nil {
+			t.Fatalf("%s: OptimalFoldings: %v", name, err)
+		}
+		if a.Complete && len(ff) != 21 {
+			t.Errorf("%s: OptimalFoldings() returned %d foldings, want 21", name, len(ff))
+		}
+		if found, err := folding.FoldingInArray(p.Optimal(), ff); err != nil || !found {
+			t.Errorf("%s: Optimal() not among OptimalFoldings()", name)
+		}
+		if c, ok := p.(predictor.Counter); ok && c.CountOptimal().Int64() != int64(len(ff)) {
+			t.Errorf("%s: CountOptimal() = %v, want %d", name, c.CountOptimal(), len(ff))
+		}
+		if s, ok := p.(predictor.SafetyPredictor); ok {
+			if safety, err := s.Safety(); err != nil || len(safety) != len(seq.Bases) {
+				t.Errorf("%s: Safety() = %v, %v, want one value for each base", name, safety, err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := a.New(seq, rules).Fill(ctx); err != context.Canceled {
+			t.Errorf("%s: Fill with cancelled context returned %v", name, err)
+		}
+		if _, err := p.OptimalFoldings(ctx); err != context.Canceled {
+			t.Errorf("%s: OptimalFoldings with cancelled context returned %v", name, err)
+		}
+	}
+}
+
+func TestFoldCancelled(t *testing.T) {
+	seq := testSequence(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o, err := Fold(ctx, seq, DefaultOptions())
+	if err != context.Canceled {
+		t.Fatalf("Fold with cancelled context returned %v", err)
+	}
+	if o == nil || o.Status != StatusAborted || o.Reason == "" {
+		t.Fatalf("Fold with cancelled context: expected aborted entry with a reason, got %+v", o)
+	}
+	if o.Name != seq.Name || o.Counts.SequenceBases != len(seq.Bases) {
+		t.Errorf("Fold with cancelled context: entry does not describe the sequence: %+v", o)
+	}
+}
+
+func TestFoldMaxFoldings(t *testing.T) {
+	seq := testSequence(t)
+	opts := DefaultOptions()
+	opts.MaxFoldings = 20
+	o, err := Fold(context.Background(), seq, opts)
+	if e, ok := err.(*FoldingLimitError); !ok || e.Foldings.Int64() != 21 || e.Max != 20 {
+		t.Fatalf("Fold with MaxFoldings 20: expected FoldingLimitError for 21 foldings, got %v", err)
+	}
+	if o == nil || o.Status != StatusSkipped || o.Reason == "" {
+		t.Fatalf("Fold with MaxFoldings 20: expected skipped entry with a reason, got %+v", o)
+	}
+	if o.Counts.OptimalPairs != 6 || o.Counts.SafeCompleteFoldings.Int64() != 21 {
+		t.Errorf("Fold with MaxFoldings 20: counts %+v, want 6 pairs and 21 foldings", o.Counts)
+	}
+	if len(o.AllFoldings) != 0 || len(o.Predictors) != 0 {
+		t.Errorf("Fold with MaxFoldings 20: foldings were listed for a skipped sequence")
+	}
+
+	opts.MaxFoldings = 21
+	if o, err := Fold(context.Background(), seq, opts); err != nil || o.Status != StatusDone {
+		t.Errorf("Fold with MaxFoldings 21: %v, status %q", err, o.Status)
+	}
+}
+
+func TestFoldDelta(t *testing.T) {
+	seq := testSequence(t)
+	p := &wuchty.Predictor{Seq: seq, MinHairpin: 3}
+	p.FillArray()
+	all := p.BacktrackWithin(1)
+
+	opts := DefaultOptions()
+	opts.Delta = 1
+	opts.MaxListed = 25
+	o, err := Fold(context.Background(), seq, opts)
+	if err != nil {
+		t.Fatalf("Fold(%+v): %v", opts, err)
+	}
+	if o.Delta != 1 || o.Counts.SuboptimalFoldings != int64(len(all)) {
+		t.Errorf("Fold(%+v): %d foldings within %d pairs, want %d within 1", opts, o.Counts.SuboptimalFoldings, o.Delta, len(all))
+	}
+	if len(o.SuboptimalFoldings) != 25 {
+		t.Fatalf("Fold(%+v): listed %d suboptimal foldings, want 25", opts, len(o.SuboptimalFoldings))
+	}
+	for i, f := range o.SuboptimalFoldings {
+		want := 6
+		if i >= 21 {
+			want = 5
+		}
+		if f.PairCount != want {
+			t.Errorf("Fold(%+v): suboptimal folding %d has %d pairs, want %d", opts, i, f.PairCount, want)
+		}
+	}
+}
+
+func TestFoldRules(t *testing.T) {
+	seq := testSequence(t)
+	opts := DefaultOptions()
+	opts.Rules = predictor.Rules{MinHairpin: 3, MaxSpan: 10, NoLonelyPairs: true}
+	o, err := Fold(context.Background(), seq, opts)
+	if err != nil {
+		t.Fatalf("Fold(%+v): %v", opts, err)
+	}
+	if o.Sanity != (Sanity{}) {
+		t.Errorf("Fold(%+v): sanity checks failed: %+v", opts, o.Sanity)
+	}
+	if o.Rules != opts.Rules {
+		t.Errorf("Fold(%+v): rules recorded as %+v", opts, o.Rules)
+	}
+	p := &wuchty.Predictor{Seq: seq, MinHairpin: 3, MaxSpan: 10, NoLonelyPairs: true}
+	p.FillArray()
+	if all := p.BacktrackAll(); o.Counts.WuchtyFoldings != len(all) || len(o.AllFoldings) != len(all) {
+		t.Errorf("Fold(%+v): %d Wuchty foldings and %d listed foldings, want %d", opts, o.Counts.WuchtyFoldings, len(o.AllFoldings), len(all))
+	}
+
+	// (0, 8) spans too far and (12, 20) is lonely
+	f := folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1, 0, -1, -1, -1, 20, -1, -1, -1, -1, -1, -1, -1, 12}
+	sanity := singleFoldingSanity(seq, f, predictor.Rules{MinHairpin: 3, MaxSpan: 7, NoLonelyPairs: true}, 4)
+	if !strings.Contains(sanity, "0 (G) and 8 (C) are paired, but the pair spans more than 7 bases") ||
+		!strings.Contains(sanity, "12 (C) and 20 (G) are paired, but the pair is lonely") {
+		t.Errorf("singleFoldingSanity(%v): got %q", f, sanity)
+	}
+}
+
+func TestWindowStarts(t *testing.T) {
+	tests := []struct {
+		numBases, width, step int
+		starts                []int
+	}{
+		{10, 20, 5, []int{0}},
+		{10, 10, 5, []int{0}},
+		{20, 10, 5, []int{0, 5, 10}},
+		{23, 10, 5, []int{0, 5, 10, 13}},
+		{23, 10, 20, []int{0, 13}},
+	}
+	for _, tt := range tests {
+		if starts := windowStarts(tt.numBases, tt.width, tt.step); !reflect.DeepEqual(starts, tt.starts) {
+			t.Errorf("windowStarts(%d, %d, %d) = %v, want %v", tt.numBases, tt.width, tt.step, starts, tt.starts)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	seq := testSequence(t)
+	opts := DefaultScanOptions()
+	prof, err := Scan(context.Background(), seq, opts)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	// One window covers the whole sequence
+	o, err := Fold(context.Background(), seq, Options{Rules: opts.Rules})
+	if err != nil {
+		t.Fatalf("Fold: %v", err)
+	}
+	for i, safe := range o.Safety.SafeBase {
+		if prof.Windows[i] != 1 || (prof.SafeFraction(i) == 1) != safe {
+			t.Errorf("Scan of whole sequence: base %d in %d windows, safe in %v of them, want safety %v", i, prof.Windows[i], prof.SafeFraction(i), safe)
+		}
+	}
+
+	opts.Window = 9
+	opts.Step = 3
+	prof, err = Scan(context.Background(), seq, opts)
+	if err != nil {
+		t.Fatalf("Scan(%+v): %v", opts, err)
+	}
+	if !reflect.DeepEqual(prof.Starts, []int{0, 3, 6, 9, 12}) {
+		t.Errorf("Scan(%+v): windows at %v", opts, prof.Starts)
+	}
+	for i := range seq.Bases {
+		windows := 0
+		for _, start := range prof.Starts {
+			if start <= i && i < start+opts.Window {
+				windows++
+			}
+		}
+		if prof.Windows[i] != windows || prof.SafePaired[i]+prof.SafeUnpaired[i] > windows {
+			t.Errorf("Scan(%+v): base %d in %d windows, safe paired in %d and unpaired in %d, want %d windows",
+				opts, i, prof.Windows[i], prof.SafePaired[i], prof.SafeUnpaired[i], windows)
+		}
+	}
+	// The first window folds into one hairpin, the second one has
+	// several optimal foldings
+	if prof.SafePaired[0] != 1 || prof.SafeUnpaired[4] != 2 {
+		t.Errorf("Scan(%+v): base 0 safe and paired in %d windows, base 4 safe and unpaired in %d", opts, prof.SafePaired[0], prof.SafeUnpaired[4])
+	}
+
+	for _, bad := range []ScanOptions{{Window: 0, Step: 1}, {Window: 10, Step: 0}, {Rules: predictor.Rules{MaxSpan: -1}, Window: 10, Step: 1}} {
+		if _, err := Scan(context.Background(), seq, bad); err == nil {
+			t.Errorf("Scan with bad options %+v returned no error", bad)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Scan(ctx, seq, opts); err != context.Canceled {
+		t.Errorf("Scan with cancelled context: expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package pipeline /* import "keltainen.duckdns.org/rnafolding/pipeline" */
+
+import "context"
+import "fmt"
+import "math/big"
+import "sort"
+import "strings"
+import "time"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/predictor"
+import "keltainen.duckdns.org/rnafolding/types"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
+import "keltainen.duckdns.org/rnafolding/wuchty"
+
+// runPredictor runs the algorithm registered with name and checks its
+// results against the safe and complete algorithm, whose foldings are
+// listed in scPairArrays out of scCount in total. Foldings of predictors
+// that implement predictor.Enumerator are checked as they are found and
+// not returned.
+func runPredictor(ctx context.Context, name string, seq *base.Sequence, rules predictor.Rules, scCount *big.Int, scPairArrays folding.FoldingSet) (PredictorResult, folding.FoldingSet, error) {
+	a, err := predictor.Lookup(name)
+	if err != nil {
+		return PredictorResult{}, nil, err
+	}
+	start := time.Now()
+	p := a.New(seq, rules)
+	if err := p.Fill(ctx); err != nil {
+		return PredictorResult{}, nil, err
+	}
+	check := newFoldingCheck(seq, rules, scCount, scPairArrays)
+	var foldings folding.FoldingSet
+	var checkTime time.Duration
+	if e, ok := p.(predictor.Enumerator); ok {
+		_, err = e.Enumerate(ctx, 0, func(f folding.FoldingPairs) bool {
+			checkStart := time.Now()
+			check.add(f)
+			checkTime += time.Since(checkStart)
+			return true
+		})
+		if err != nil {
+			return PredictorResult{}, nil, err
+		}
+	} else {
+		foldings, err = p.OptimalFoldings(ctx)
+		if err != nil {
+			return PredictorResult{}, nil, err
+		}
+		checkStart := time.Now()
+		for _, f := range foldings {
+			check.add(f)
+		}
+		checkTime = time.Since(checkStart)
+	}
+	r := PredictorResult{
+		Name:         name,
+		Complete:     a.Complete,
+		Seconds:      (time.Since(start) - checkTime).Seconds(),
+		OptimalPairs: p.OptimalScore(),
+		Foldings:     check.count,
+	}
+	r.Sanity = check.sanity(r, foldings)
+	return r, foldings, nil
+}
+
+// foldingCheck checks the foldings of a predictor one at a time against
+// the foldings listed by the safe and complete algorithm.
+type foldingCheck struct {
+	seq      *base.Sequence
+	rules    predictor.Rules
+	numPairs int
+	scCount  *big.Int
+	// Whether each folding of the safe and complete algorithm has been
+	// seen, if they were all listed
+	listed map[string]bool
+
+	count     int
+	errs      []string
+	duplicate bool
+	unlisted  bool
+}
+
+func newFoldingCheck(seq *base.Sequence, rules predictor.Rules, scCount *big.Int, scPairArrays folding.FoldingSet) *foldingCheck {
+	c := &foldingCheck{
+		seq:      seq,
+		rules:    rules,
+		numPairs: countPairs(scPairArrays[0]),
+		scCount:  scCount,
+	}
+	// Foldings may have been listed only partially
+	if scCount.Cmp(big.NewInt(int64(len(scPairArrays)))) == 0 {
+		c.listed = make(map[string]bool, len(scPairArrays))
+		for _, f := range scPairArrays {
+			c.listed[fmt.Sprint(f)] = false
+		}
+	}
+	return c
+}
+
+func (c *foldingCheck) add(f folding.FoldingPairs) {
+	c.count++
+	if sanity := singleFoldingSanity(c.seq, f, c.rules, c.numPairs); len(sanity) > 0 {
+		c.errs = append(c.errs, fmt.Sprint("Sanity check failed!\n", sanity))
+	}
+	if c.listed == nil {
+		return
+	}
+	key := fmt.Sprint(f)
+	if seen, ok := c.listed[key]; !ok {
+		c.unlisted = true
+	} else if seen {
+		c.duplicate = true
+	} else {
+		c.listed[key] = true
+	}
+}
+
+// sanity describes the failed checks. Foldings that were kept in memory
+// are also checked for duplicates that the safe and complete algorithm
+// did not list.
+func (c *foldingCheck) sanity(r PredictorResult, foldings folding.FoldingSet) string {
+	var out []string
+	if r.OptimalPairs != c.numPairs {
+		out = append(out, fmt.Sprintf("Sanity check failed! %s found optimal foldings with %d pairs, safe & complete method with %d pairs", r.Name, r.OptimalPairs, c.numPairs))
+	}
+	if c.duplicate {
+		out = append(out, "Sanity check failed!\nAt least two foldings are exactly the same")
+	} else if sanity := allFoldingsSanity(c.seq, foldings); sanity != "" {
+		out = append(out, fmt.Sprint("Sanity check failed!\n", sanity))
+	}
+	out = append(out, c.errs...)
+	if r.Complete && c.scCount.Cmp(big.NewInt(int64(c.count))) != 0 {
+		out = append(out, fmt.Sprintf("Sanity check failed! %s found %d foldings, safe & complete method %d foldings", r.Name, c.count, c.scCount))
+	}
+	if c.listed != nil {
+		if r.Complete {
+			if c.unlisted || c.duplicate || c.count != len(c.listed) {
+				out = append(out, fmt.Sprintf("Sanity check failed! %s method and safe & complete method produced different foldings", r.Name))
+			}
+		} else if c.unlisted {
+			out = append(out, fmt.Sprintf("Sanity check failed! %s method found solutions that safe & complete method didn't", r.Name))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// runSuboptimal finds the foldings that have at most delta pairs less
+// than optimal with the Wuchty algorithm, sorted by decreasing number of
+// pairs. All of them are counted, but if maxListed is positive, only that
+// many with the most pairs are kept.
+func runSuboptimal(ctx context.Context, seq *base.Sequence, rules predictor.Rules, delta int, maxListed int64) (folding.FoldingSet, int64, error) {
+	p := &wuchty.Predictor{Seq: seq, MinHairpin: rules.MinHairpin, MaxSpan: rules.MaxSpan, NoLonelyPairs: rules.NoLonelyPairs}
+	if err := p.FillArrayContext(ctx); err != nil {
+		return nil, 0, err
+	}
+	optimal := p.V[0][len(seq.Bases)-1]
+	// Foldings by the number of pairs less than optimal
+	byLoss := make([]folding.FoldingSet, delta+1)
+	var total, kept int64
+	_, err := p.EnumerateWithin(ctx, delta, 0, func(f folding.FoldingPairs) bool {
+		total++
+		loss := optimal - countPairs(f)
+		if maxListed > 0 && kept >= maxListed {
+			worst := delta
+			for len(byLoss[worst]) == 0 {
+				worst--
+			}
+			if loss >= worst {
+				return true
+			}
+			byLoss[worst] = byLoss[worst][:len(byLoss[worst])-1]
+			kept--
+		}
+		byLoss[loss] = append(byLoss[loss], f)
+		kept++
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var ff folding.FoldingSet
+	for _, l := range byLoss {
+		ff = append(ff, l...)
+	}
+	return ff, total, nil
+}
+
+func sanitySafeComplete(sc *safecomplete.Predictor, scFoldings *types.FoldTree, rules predictor.Rules, numOptimalPairs int, scPairArrays folding.FoldingSet) string {
+	var out []string
+	if numSol := scFoldings.CountSolutions(); sc.Sol[0][len(sc.Sol)-1].Cmp(numSol) != 0 {
+		out = append(out, fmt.Sprintf("Sanity check failed! Solution count matrix shows %d solutions, folding tree %d solutions", sc.Sol[0][len(sc.Sol)-1], numSol))
+	}
+
+	if sanity := allFoldingsSanity(sc.Seq, scPairArrays); sanity != "" {
+		out = append(out, fmt.Sprint("Sanity check failed!\n", sanity, "\n"))
+	}
+	for _, f := range scPairArrays {
+		if sanity := singleFoldingSanity(sc.Seq, f, rules, numOptimalPairs); len(sanity) > 0 {
+			out = append(out, fmt.Sprint("Sanity check failed!\n", sanity, "\n"))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func singleFoldingSanity(seq *base.Sequence, f folding.FoldingPairs, rules predictor.Rules, numPairs int) string {
+	var errs []string
+	for i, j := range f {
+		if j < 0 {
+			continue
+		}
+		if i == j {
+			errs = append(errs, fmt.Sprintf("Base %d (%s) is paired with itself", i, seq.Bases[i].ToCode()))
+		}
+		if f[j] != i {
+			k := f[j]
+			if k >= 0 && k < len(seq.Bases) {
+				errs = append(errs, fmt.Sprintf("Non-symmetric pair: %d (%s) -> %d (%s) but %[3]d (%s) -> %d (%s)", i, seq.Bases[i].ToCode(), j, seq.Bases[j].ToCode(), k, seq.Bases[k].ToCode()))
+			} else {
+				errs = append(errs, fmt.Sprintf("Non-symmetric pair: %d (%s) -> %d (%s) but %[3]d (%s) -> %d (outside sequence)", i, seq.Bases[i].ToCode(), j, seq.Bases[j].ToCode(), k))
+			}
+		}
+		if i < j && !seq.CanPair(i, j, rules.MinHairpin) {
+			errs = append(errs, fmt.Sprintf("%d (%s) and %d (%s) are paired, but not a valid base pair", i, seq.Bases[i].ToCode(), j, seq.Bases[j].ToCode()))
+		} else if i < j && !rules.CanPair(seq, i, j) {
+			errs = append(errs, fmt.Sprintf("%d (%s) and %d (%s) are paired, but the pair spans more than %d bases", i, seq.Bases[i].ToCode(), j, seq.Bases[j].ToCode(), rules.MaxSpan))
+		}
+		if i < j && f[j] == i && rules.NoLonelyPairs && folding.Lonely(f, i) {
+			errs = append(errs, fmt.Sprintf("%d (%s) and %d (%s) are paired, but the pair is lonely", i, seq.Bases[i].ToCode(), j, seq.Bases[j].ToCode()))
+		}
+	}
+	if fPairs := countPairs(f); fPairs != numPairs {
+		errs = append(errs, fmt.Sprintf("Folding has %d pairs, expected %d", fPairs, numPairs))
+	}
+	return strings.Join(errs, "\n")
+}
+
+func allFoldingsSanity(seq *base.Sequence, foldings folding.FoldingSet) string {
+	var errs []string
+	ff := make(folding.FoldingSet, len(foldings))
+	copy(ff, foldings)
+	sort.Sort(folding.FoldingOrdering{FoldingSet: ff})
+	for i := 0; i < len(ff)-1; i++ {
+		equal, err := folding.FoldingArraysEqual(ff[i], ff[i+1])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Foldings are not all of sequence length: %v", err))
+			break
+		}
+		if equal {
+			errs = append(errs, fmt.Sprintf("At least two foldings are exactly the same"))
+			break
+		}
+	}
+	return strings.Join(errs, "\n")
+}
@@ -0,0 +1,160 @@
+package pipeline /* import "keltainen.duckdns.org/rnafolding/pipeline" */
+
+import "context"
+import "errors"
+import "fmt"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/predictor"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
+
+// ScanOptions selects the windows folded by Scan.
+type ScanOptions struct {
+	Rules predictor.Rules
+	// Number of bases in each window
+	Window int
+	// Distance between the starts of consecutive windows
+	Step int
+}
+
+// DefaultScanOptions returns the options used by the scan command.
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Rules:  predictor.Rules{MinHairpin: 3},
+		Window: 150,
+		Step:   10,
+	}
+}
+
+// Validate checks that the options are usable.
+func (opts ScanOptions) Validate() error {
+	if opts.Rules.MinHairpin < 0 {
+		return fmt.Errorf("minimum hairpin length must not be negative, got %d", opts.Rules.MinHairpin)
+	}
+	if opts.Rules.MaxSpan < 0 {
+		return fmt.Errorf("maximum pair span must not be negative, got %d", opts.Rules.MaxSpan)
+	}
+	if opts.Window <= 0 {
+		return fmt.Errorf("window width must be positive, got %d", opts.Window)
+	}
+	if opts.Step <= 0 {
+		return fmt.Errorf("window step must be positive, got %d", opts.Step)
+	}
+	return nil
+}
+
+// ScanProfile is the safety of each base of a sequence, counted over the
+// windows that contain the base.
+type ScanProfile struct {
+	Name string
+	// Start of each window folded
+	Starts []int
+	// Number of windows containing each base
+	Windows []int
+	// Number of windows in which each base is safe and paired, that is
+	// paired with the same base in all optimal foldings of the window
+	SafePaired []int
+	// Number of windows in which each base is safe and unpaired, that is
+	// free in all optimal foldings of the window
+	SafeUnpaired []int
+}
+
+// SafeFraction returns the fraction of the windows containing base i in
+// which it is safe.
+func (p *ScanProfile) SafeFraction(i int) float64 {
+	return fraction(p.SafePaired[i]+p.SafeUnpaired[i], p.Windows[i])
+}
+
+// SafePairedFraction returns the fraction of the windows containing base
+// i in which it is safe and paired.
+func (p *ScanProfile) SafePairedFraction(i int) float64 {
+	return fraction(p.SafePaired[i], p.Windows[i])
+}
+
+// SafeUnpairedFraction returns the fraction of the windows containing
+// base i in which it is safe and unpaired.
+func (p *ScanProfile) SafeUnpairedFraction(i int) float64 {
+	return fraction(p.SafeUnpaired[i], p.Windows[i])
+}
+
+func fraction(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// windowStarts returns the starts of windows of the given width, step
+// apart. The last window ends at the end of the sequence, so that every
+// base is in some window. A sequence shorter than the window is folded
+// as one window.
+func windowStarts(numBases, width, step int) []int {
+	if numBases <= width {
+		return []int{0}
+	}
+	var starts []int
+	for start := 0; start+width <= numBases; start += step {
+		starts = append(starts, start)
+	}
+	if last := starts[len(starts)-1]; last+width < numBases {
+		starts = append(starts, numBases-width)
+	}
+	return starts
+}
+
+// Scan folds each window of seq with the safe and complete algorithm, like
+// RNALfold and RNAplfold fold local structure, and counts for each base the
+// windows in which it is safe. It returns ctx.Err() if ctx is cancelled
+// before all windows are folded.
+func Scan(ctx context.Context, seq *base.Sequence, opts ScanOptions) (*ScanProfile, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	numBases := len(seq.Bases)
+	if numBases == 0 {
+		return nil, errors.New("sequence has no bases")
+	}
+	prof := &ScanProfile{
+		Name:         seq.Name,
+		Starts:       windowStarts(numBases, opts.Window, opts.Step),
+		Windows:      make([]int, numBases),
+		SafePaired:   make([]int, numBases),
+		SafeUnpaired: make([]int, numBases),
+	}
+	for _, start := range prof.Starts {
+		end := start + opts.Window
+		if end > numBases {
+			end = numBases
+		}
+		sc := &safecomplete.Predictor{
+			Seq:           &base.Sequence{Name: seq.Name, Bases: seq.Bases[start:end]},
+			MinHairpin:    opts.Rules.MinHairpin,
+			MaxSpan:       opts.Rules.MaxSpan,
+			NoLonelyPairs: opts.Rules.NoLonelyPairs,
+		}
+		if err := sc.FillArrayContext(ctx); err != nil {
+			return nil, err
+		}
+		if err := sc.CountSolutionsContext(ctx); err != nil {
+			return nil, err
+		}
+		if err := sc.CountPairingsContext(ctx); err != nil {
+			return nil, err
+		}
+		safety, err := sc.SafetyFromBacktrack()
+		if err != nil {
+			return nil, fmt.Errorf("window at %d: %v", start, err)
+		}
+		for i, safe := range safety {
+			prof.Windows[start+i]++
+			switch {
+			case !safe:
+			case sc.SingleSafety[i].Sign() == 0:
+				prof.SafePaired[start+i]++
+			default:
+				prof.SafeUnpaired[start+i]++
+			}
+		}
+	}
+	return prof, nil
+}
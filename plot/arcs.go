@@ -0,0 +1,131 @@
+package plot /* import "keltainen.duckdns.org/rnafolding/plot" */
+
+import "image/color"
+import "math"
+import "strconv"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// Layer is one folding drawn in an arc diagram or a circle plot. Pairs
+// may cross each other.
+type Layer struct {
+	Name    string
+	Folding folding.FoldingPairs
+	Color   color.RGBA
+	// Draw arcs below the sequence in arc diagrams
+	Below bool
+}
+
+// LayerColors are distinct colors for up to six layers.
+var LayerColors = []color.RGBA{
+	{31, 119, 180, 255},
+	{255, 127, 14, 255},
+	{44, 160, 44, 255},
+	{214, 39, 40, 255},
+	{148, 103, 189, 255},
+	{140, 86, 75, 255},
+}
+
+// layerWidth makes earlier layers wider, so that a pair present in several
+// layers shows the colors of all of them.
+func layerWidth(k, numLayers int) float64 {
+	return 0.08 * float64(1+numLayers-k)
+}
+
+func arcPoints(i, j int, y0, dir float64) []Point {
+	r := float64(j-i) / 2
+	mid := float64(i+j) / 2
+	n := int(math.Min(64, math.Max(8, 2*r)))
+	pts := make([]Point, n+1)
+	for k := 0; k <= n; k++ {
+		a := math.Pi * float64(k) / float64(n)
+		pts[k] = Point{mid - r*math.Cos(a), y0 - dir*r*math.Sin(a)}
+	}
+	return pts
+}
+
+func (p *Picture) legend(layers []Layer, x, y float64) {
+	for k, l := range layers {
+		ly := y + 1.2*float64(k)
+		p.Line(x, ly, x+2, ly, layerWidth(0, 1), l.Color)
+		p.Text(x+3+0.25*float64(len(l.Name)), ly, 0.8, l.Name, black)
+	}
+}
+
+// ArcDiagram draws the sequence on a line, and pairs of each layer as
+// semicircles above or below it.
+func ArcDiagram(seq *base.Sequence, layers []Layer) *Picture {
+	p := NewPicture()
+	maxBelow := 0.0
+	for k, l := range layers {
+		y0, dir := -0.6, 1.0
+		if l.Below {
+			y0, dir = 0.6, -1.0
+		}
+		for i, j := range l.Folding {
+			if j <= i || j >= len(l.Folding) {
+				continue
+			}
+			p.Polyline(arcPoints(i, j, y0, dir), layerWidth(k, len(layers)), l.Color)
+			if l.Below {
+				maxBelow = math.Max(maxBelow, float64(j-i)/2)
+			}
+		}
+	}
+	for i, b := range seq.Bases {
+		p.Text(float64(i), 0, 0.8, b.ToCode(), black)
+		if (i+1)%10 == 0 || i == 0 {
+			p.Text(float64(i), 1.2+maxBelow, 0.5, strconv.Itoa(i+1), grey)
+		}
+	}
+	p.legend(layers, 0, maxBelow+3)
+	return p
+}
+
+// CirclePlot draws the sequence around a circle, and pairs of each layer
+// as curves inside it.
+func CirclePlot(seq *base.Sequence, layers []Layer) *Picture {
+	p := NewPicture()
+	n := len(seq.Bases)
+	radius := math.Max(3, float64(n)/(2*math.Pi))
+	at := func(i int, r float64) Point {
+		a := 2*math.Pi*float64(i)/float64(n) - math.Pi/2
+		return Point{r * math.Cos(a), r * math.Sin(a)}
+	}
+
+	var ring []Point
+	for k := 0; k <= 128; k++ {
+		a := 2 * math.Pi * float64(k) / 128
+		ring = append(ring, Point{radius * math.Cos(a), radius * math.Sin(a)})
+	}
+	p.Polyline(ring, 0.05, lightGrey)
+
+	for k, l := range layers {
+		for i, j := range l.Folding {
+			if j <= i || j >= len(l.Folding) {
+				continue
+			}
+			a, b := at(i, radius), at(j, radius)
+			// Quadratic Bezier curve bending towards the center
+			ctrl := a.add(b).mul(0.25)
+			var pts []Point
+			for s := 0; s <= 24; s++ {
+				t := float64(s) / 24
+				pt := a.mul((1 - t) * (1 - t)).add(ctrl.mul(2 * (1 - t) * t)).add(b.mul(t * t))
+				pts = append(pts, pt)
+			}
+			p.Polyline(pts, layerWidth(k, len(layers)), l.Color)
+		}
+	}
+	for i, b := range seq.Bases {
+		pt := at(i, radius+0.7)
+		p.Text(pt.X, pt.Y, 0.8, b.ToCode(), black)
+		if (i+1)%10 == 0 || i == 0 {
+			pt = at(i, radius+1.7)
+			p.Text(pt.X, pt.Y, 0.5, strconv.Itoa(i+1), grey)
+		}
+	}
+	p.legend(layers, -radius, radius+3)
+	return p
+}
@@ -0,0 +1,106 @@
+package plot /* import "keltainen.duckdns.org/rnafolding/plot" */
+
+import "math"
+import "math/big"
+import "strconv"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// CountFractions divides pair and free counts by the number of foldings.
+func CountFractions(pairs [][]*big.Int, free []*big.Int, total *big.Int) ([][]float64, []float64) {
+	fraction := func(c *big.Int) float64 {
+		if c == nil || total.Sign() == 0 {
+			return 0
+		}
+		f, _ := new(big.Rat).SetFrac(c, total).Float64()
+		return f
+	}
+	outPairs := make([][]float64, len(pairs))
+	outFree := make([]float64, len(free))
+	for i, row := range pairs {
+		outPairs[i] = make([]float64, len(row))
+		for j, c := range row {
+			outPairs[i][j] = fraction(c)
+		}
+	}
+	for i, c := range free {
+		outFree[i] = fraction(c)
+	}
+	return outPairs, outFree
+}
+
+// IntFractions divides pair and free counts by the number of foldings.
+func IntFractions(pairs [][]int, free []int, total int) ([][]float64, []float64) {
+	outPairs := make([][]float64, len(pairs))
+	outFree := make([]float64, len(free))
+	if total == 0 {
+		total = 1
+	}
+	for i, row := range pairs {
+		outPairs[i] = make([]float64, len(row))
+		for j, c := range row {
+			outPairs[i][j] = float64(c) / float64(total)
+		}
+	}
+	for i, c := range free {
+		outFree[i] = float64(c) / float64(total)
+	}
+	return outPairs, outFree
+}
+
+// Heatmap draws pair frequencies in the upper triangle of a matrix, and
+// frequencies of bases being free on its diagonal. Pairs of the reference
+// folding, if given, are marked in the lower triangle.
+func Heatmap(seq *base.Sequence, pairs [][]float64, free []float64, reference folding.FoldingPairs) *Picture {
+	p := NewPicture()
+	n := len(seq.Bases)
+	p.Scale = math.Min(20, math.Max(1, 1000/float64(n)))
+
+	p.Rect(0, 0, float64(n), float64(n), white)
+	for i := 0; i < n; i++ {
+		if free != nil && free[i] > 0 {
+			p.Rect(float64(i), float64(i), 1, 1, Gradient(free[i]))
+		}
+		for j := i + 1; j < n; j++ {
+			if pairs[i][j] > 0 {
+				p.Rect(float64(j), float64(i), 1, 1, Gradient(pairs[i][j]))
+			}
+		}
+	}
+	if len(reference) == n {
+		for i, j := range reference {
+			if j > i && j < n {
+				p.Rect(float64(i), float64(j), 1, 1, black)
+			}
+		}
+	}
+
+	// Diagonal and border
+	p.Line(0, 0, float64(n), float64(n), 0.05, lightGrey)
+	p.Line(0, 0, float64(n), 0, 0.05, grey)
+	p.Line(float64(n), 0, float64(n), float64(n), 0.05, grey)
+	p.Line(float64(n), float64(n), 0, float64(n), 0.05, grey)
+	p.Line(0, float64(n), 0, 0, 0.05, grey)
+
+	for i, b := range seq.Bases {
+		c := float64(i) + 0.5
+		p.Text(c, -0.7, 0.8, b.ToCode(), black)
+		p.Text(-0.7, c, 0.8, b.ToCode(), black)
+		if (i+1)%10 == 0 || i == 0 {
+			p.Text(c, -2, 0.8, strconv.Itoa(i+1), grey)
+			p.Text(-2.5, c, 0.8, strconv.Itoa(i+1), grey)
+		}
+	}
+
+	// Color scale
+	x := float64(n) + 2
+	for k := 0; k < 10; k++ {
+		y := float64(n) * float64(9-k) / 10
+		p.Rect(x, y, 1, float64(n)/10, Gradient((float64(k)+0.5)/10))
+	}
+	p.Text(x+2, float64(n), 0.8, "0", black)
+	p.Text(x+2, float64(n)/2, 0.8, "0.5", black)
+	p.Text(x+2, 0, 0.8, "1", black)
+	return p
+}
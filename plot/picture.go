@@ -0,0 +1,319 @@
+// Package plot draws foldings and pairing statistics as SVG or PNG
+// images.
+package plot /* import "keltainen.duckdns.org/rnafolding/plot" */
+
+import "fmt"
+import "image"
+import "image/color"
+import "image/png"
+import "io"
+import "math"
+import "strings"
+
+// Picture is a list of shapes in arbitrary units. It can be written out
+// as SVG, where one unit is Scale pixels, or as PNG.
+type Picture struct {
+	Scale  float64
+	shapes []shape
+}
+
+type shape interface {
+	svg() string
+	bounds() (minx, miny, maxx, maxy float64)
+	raster(img *image.RGBA, tr transform)
+}
+
+type transform struct {
+	scale  float64
+	dx, dy float64
+}
+
+func (t transform) apply(x, y float64) (float64, float64) {
+	return (x + t.dx) * t.scale, (y + t.dy) * t.scale
+}
+
+func NewPicture() *Picture {
+	return &Picture{Scale: 20}
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+type line struct {
+	x1, y1, x2, y2 float64
+	width          float64
+	color          color.RGBA
+	dashed         bool
+}
+
+// Line draws a line segment of given width.
+func (p *Picture) Line(x1, y1, x2, y2, width float64, c color.RGBA) {
+	p.shapes = append(p.shapes, &line{x1, y1, x2, y2, width, c, false})
+}
+
+// DashedLine draws a dashed line segment of given width.
+func (p *Picture) DashedLine(x1, y1, x2, y2, width float64, c color.RGBA) {
+	p.shapes = append(p.shapes, &line{x1, y1, x2, y2, width, c, true})
+}
+
+func (l *line) svg() string {
+	dash := ""
+	if l.dashed {
+		dash = fmt.Sprintf(` stroke-dasharray="%g,%g"`, 3*l.width, 2*l.width)
+	}
+	return fmt.Sprintf(`<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="%g"%s/>`,
+		round(l.x1), round(l.y1), round(l.x2), round(l.y2), svgColor(l.color), l.width, dash)
+}
+
+func (l *line) bounds() (float64, float64, float64, float64) {
+	w := l.width / 2
+	return math.Min(l.x1, l.x2) - w, math.Min(l.y1, l.y2) - w, math.Max(l.x1, l.x2) + w, math.Max(l.y1, l.y2) + w
+}
+
+func (l *line) raster(img *image.RGBA, tr transform) {
+	x1, y1 := tr.apply(l.x1, l.y1)
+	x2, y2 := tr.apply(l.x2, l.y2)
+	w := l.width * tr.scale / 2
+	dx, dy := x2-x1, y2-y1
+	length := math.Hypot(dx, dy)
+	fill(img, math.Min(x1, x2)-w, math.Min(y1, y2)-w, math.Max(x1, x2)+w, math.Max(y1, y2)+w, l.color,
+		func(x, y float64) bool {
+			t := 0.0
+			if length > 0 {
+				t = ((x-x1)*dx + (y-y1)*dy) / (length * length)
+			}
+			t = math.Max(0, math.Min(1, t))
+			if l.dashed && math.Mod(t*length, 5*l.width*tr.scale) > 3*l.width*tr.scale {
+				return false
+			}
+			return math.Hypot(x-x1-t*dx, y-y1-t*dy) <= w
+		})
+}
+
+type polyline struct {
+	pts   []Point
+	width float64
+	color color.RGBA
+}
+
+// Polyline draws line segments through the given points.
+func (p *Picture) Polyline(pts []Point, width float64, c color.RGBA) {
+	p.shapes = append(p.shapes, &polyline{pts, width, c})
+}
+
+func (l *polyline) svg() string {
+	coords := make([]string, len(l.pts))
+	for i, pt := range l.pts {
+		coords[i] = fmt.Sprintf("%g,%g", round(pt.X), round(pt.Y))
+	}
+	return fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="%g"/>`,
+		strings.Join(coords, " "), svgColor(l.color), l.width)
+}
+
+func (l *polyline) bounds() (float64, float64, float64, float64) {
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, pt := range l.pts {
+		minx, miny = math.Min(minx, pt.X), math.Min(miny, pt.Y)
+		maxx, maxy = math.Max(maxx, pt.X), math.Max(maxy, pt.Y)
+	}
+	w := l.width / 2
+	return minx - w, miny - w, maxx + w, maxy + w
+}
+
+func (l *polyline) raster(img *image.RGBA, tr transform) {
+	for i := 1; i < len(l.pts); i++ {
+		a, b := l.pts[i-1], l.pts[i]
+		seg := &line{a.X, a.Y, b.X, b.Y, l.width, l.color, false}
+		seg.raster(img, tr)
+	}
+}
+
+type circle struct {
+	x, y, r float64
+	fill    color.RGBA
+	stroke  color.RGBA
+}
+
+// Circle draws a filled circle with a thin outline.
+func (p *Picture) Circle(x, y, r float64, fill, stroke color.RGBA) {
+	p.shapes = append(p.shapes, &circle{x, y, r, fill, stroke})
+}
+
+func (c *circle) svg() string {
+	return fmt.Sprintf(`<circle cx="%g" cy="%g" r="%g" fill="%s" stroke="%s" stroke-width="%g"/>`,
+		round(c.x), round(c.y), c.r, svgColor(c.fill), svgColor(c.stroke), c.r/8)
+}
+
+func (c *circle) bounds() (float64, float64, float64, float64) {
+	return c.x - c.r, c.y - c.r, c.x + c.r, c.y + c.r
+}
+
+func (c *circle) raster(img *image.RGBA, tr transform) {
+	x, y := tr.apply(c.x, c.y)
+	r := c.r * tr.scale
+	inner := r * 7 / 8
+	fill(img, x-r, y-r, x+r, y+r, c.stroke, func(px, py float64) bool {
+		return math.Hypot(px-x, py-y) <= r
+	})
+	fill(img, x-r, y-r, x+r, y+r, c.fill, func(px, py float64) bool {
+		return math.Hypot(px-x, py-y) <= inner
+	})
+}
+
+type rect struct {
+	x, y, w, h float64
+	fill       color.RGBA
+}
+
+// Rect draws a filled rectangle.
+func (p *Picture) Rect(x, y, w, h float64, fill color.RGBA) {
+	p.shapes = append(p.shapes, &rect{x, y, w, h, fill})
+}
+
+func (r *rect) svg() string {
+	return fmt.Sprintf(`<rect x="%g" y="%g" width="%g" height="%g" fill="%s"/>`,
+		round(r.x), round(r.y), round(r.w), round(r.h), svgColor(r.fill))
+}
+
+func (r *rect) bounds() (float64, float64, float64, float64) {
+	return r.x, r.y, r.x + r.w, r.y + r.h
+}
+
+func (r *rect) raster(img *image.RGBA, tr transform) {
+	x1, y1 := tr.apply(r.x, r.y)
+	x2, y2 := tr.apply(r.x+r.w, r.y+r.h)
+	fill(img, x1, y1, x2, y2, r.fill, func(x, y float64) bool {
+		return x >= x1 && x < x2 && y >= y1 && y < y2
+	})
+}
+
+type text struct {
+	x, y, size float64
+	str        string
+	color      color.RGBA
+}
+
+// Text draws a string centered on the given position. Text is left out
+// of PNG images, as the standard library has no fonts.
+func (p *Picture) Text(x, y, size float64, str string, c color.RGBA) {
+	p.shapes = append(p.shapes, &text{x, y, size, str, c})
+}
+
+func (t *text) svg() string {
+	str := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(t.str)
+	return fmt.Sprintf(`<text x="%g" y="%g" font-size="%g" font-family="sans-serif" text-anchor="middle" dominant-baseline="central" fill="%s">%s</text>`,
+		round(t.x), round(t.y), t.size, svgColor(t.color), str)
+}
+
+func (t *text) bounds() (float64, float64, float64, float64) {
+	w := float64(len(t.str)) * t.size * 0.3
+	return t.x - w, t.y - t.size/2, t.x + w, t.y + t.size/2
+}
+
+func (t *text) raster(img *image.RGBA, tr transform) {
+}
+
+// fill sets the pixels within the given box for which inside returns true.
+// Pixels are tested at their centers.
+func fill(img *image.RGBA, x1, y1, x2, y2 float64, c color.RGBA, inside func(x, y float64) bool) {
+	b := img.Bounds()
+	for py := int(math.Max(math.Floor(y1), float64(b.Min.Y))); py < b.Max.Y && float64(py) <= y2; py++ {
+		for px := int(math.Max(math.Floor(x1), float64(b.Min.X))); px < b.Max.X && float64(px) <= x2; px++ {
+			if inside(float64(px)+0.5, float64(py)+0.5) {
+				img.SetRGBA(px, py, c)
+			}
+		}
+	}
+}
+
+func round(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
+
+// Bounds returns the area covered by the picture, with a margin of one
+// unit on each side.
+func (p *Picture) Bounds() (minx, miny, maxx, maxy float64) {
+	if len(p.shapes) == 0 {
+		return 0, 0, 0, 0
+	}
+	minx, miny = math.Inf(1), math.Inf(1)
+	maxx, maxy = math.Inf(-1), math.Inf(-1)
+	for _, s := range p.shapes {
+		x1, y1, x2, y2 := s.bounds()
+		minx, miny = math.Min(minx, x1), math.Min(miny, y1)
+		maxx, maxy = math.Max(maxx, x2), math.Max(maxy, y2)
+	}
+	return minx - 1, miny - 1, maxx + 1, maxy + 1
+}
+
+// WriteSVG writes the picture as an SVG document.
+func (p *Picture) WriteSVG(w io.Writer) error {
+	minx, miny, maxx, maxy := p.Bounds()
+	var out strings.Builder
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="%g %g %g %g">`+"\n",
+		round((maxx-minx)*p.Scale), round((maxy-miny)*p.Scale), round(minx), round(miny), round(maxx-minx), round(maxy-miny))
+	fmt.Fprintf(&out, `<rect x="%g" y="%g" width="%g" height="%g" fill="#ffffff"/>`+"\n",
+		round(minx), round(miny), round(maxx-minx), round(maxy-miny))
+	for _, s := range p.shapes {
+		out.WriteString(s.svg())
+		out.WriteString("\n")
+	}
+	out.WriteString("</svg>\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Image draws the picture into an image.
+func (p *Picture) Image() *image.RGBA {
+	minx, miny, maxx, maxy := p.Bounds()
+	tr := transform{scale: p.Scale, dx: -minx, dy: -miny}
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil((maxx-minx)*p.Scale)), int(math.Ceil((maxy-miny)*p.Scale))))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for _, s := range p.shapes {
+		s.raster(img, tr)
+	}
+	return img
+}
+
+// WritePNG writes the picture as a PNG image.
+func (p *Picture) WritePNG(w io.Writer) error {
+	return png.Encode(w, p.Image())
+}
+
+var (
+	black     = color.RGBA{0, 0, 0, 255}
+	white     = color.RGBA{255, 255, 255, 255}
+	grey      = color.RGBA{160, 160, 160, 255}
+	lightGrey = color.RGBA{220, 220, 220, 255}
+	safeGreen = color.RGBA{120, 200, 120, 255}
+)
+
+// Gradient returns a color for frac in [0, 1], going from pale yellow
+// through green to dark blue.
+func Gradient(frac float64) color.RGBA {
+	stops := []color.RGBA{{255, 255, 204, 255}, {161, 218, 180, 255}, {65, 182, 196, 255}, {34, 94, 168, 255}}
+	frac = math.Max(0, math.Min(1, frac))
+	pos := frac * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	t := pos - float64(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-t) + float64(b)*t))
+	}
+	a, b := stops[i], stops[i+1]
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// textColor returns black or white, whichever is more visible on c.
+func textColor(c color.RGBA) color.RGBA {
+	if 299*int(c.R)+587*int(c.G)+114*int(c.B) < 128000 {
+		return white
+	}
+	return black
+}
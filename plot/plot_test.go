@@ -0,0 +1,205 @@
+package plot /* import "keltainen.duckdns.org/rnafolding/plot" */
+
+import "bytes"
+import "image/color"
+import "image/png"
+import "math"
+import "math/big"
+import "reflect"
+import "strings"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func parseDotBracket(db string) folding.FoldingPairs {
+	f := folding.NewFoldingPairs(len(db))
+	stacks := map[rune][]int{}
+	closing := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	for i, c := range db {
+		if o, ok := closing[c]; ok {
+			s := stacks[o]
+			j := s[len(s)-1]
+			stacks[o] = s[:len(s)-1]
+			f[i], f[j] = j, i
+		} else if c != '.' {
+			stacks[c] = append(stacks[c], i)
+		}
+	}
+	return f
+}
+
+func TestLayout(t *testing.T) {
+	tests := []string{
+		"(((((((..((((........)))).(((((.......))))).....(((((.......))))))))))))....",
+		"..(((...)))...((((....))))..((((((.............))))))..",
+		"((((.((...))..((...))...((...)))))).",
+		"()",
+		"....",
+	}
+	for _, tt := range tests {
+		f := parseDotBracket(tt)
+		pos := Layout(f)
+		for i, j := range f {
+			if j > i {
+				if d := pos[i].sub(pos[j]).length(); math.Abs(d-1) > 1e-9 {
+					t.Errorf("Layout(%s): pair (%d,%d) at distance %f", tt, i, j, d)
+				}
+			}
+		}
+		for i := 1; i < len(f); i++ {
+			if d := pos[i].sub(pos[i-1]).length(); d < 1-1e-9 {
+				t.Errorf("Layout(%s): bases %d and %d at distance %f", tt, i-1, i, d)
+			}
+			for j := 0; j < i; j++ {
+				if d := pos[i].sub(pos[j]).length(); d < 0.5 {
+					t.Errorf("Layout(%s): bases %d and %d overlap at distance %f", tt, j, i, d)
+				}
+			}
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	tests := []struct {
+		frac     float64
+		expected color.RGBA
+	}{
+		{-1, color.RGBA{255, 255, 204, 255}},
+		{0, color.RGBA{255, 255, 204, 255}},
+		{1, color.RGBA{34, 94, 168, 255}},
+		{2, color.RGBA{34, 94, 168, 255}},
+	}
+	for _, tt := range tests {
+		if actual := Gradient(tt.frac); actual != tt.expected {
+			t.Errorf("Gradient(%f): expected %v, got %v", tt.frac, tt.expected, actual)
+		}
+	}
+}
+
+func TestStructure(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAACCCA")
+	f := parseDotBracket("(((...))).")
+	safety := []bool{true, true, true, false, false, false, true, true, true, true}
+	p := Structure(seq, f, StructureOptions{Safety: safety})
+
+	var svg bytes.Buffer
+	if err := p.WriteSVG(&svg); err != nil {
+		t.Fatalf("WriteSVG: unexpected error %v", err)
+	}
+	for _, tt := range []struct {
+		element string
+		count   int
+	}{{"<circle ", 10}, {"<line ", 12}, {`fill="#78c878"`, 7}} {
+		if n := strings.Count(svg.String(), tt.element); n != tt.count {
+			t.Errorf("WriteSVG: expected %d %s, got %d in\n%s", tt.count, tt.element, n, svg.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := p.WritePNG(&out); err != nil {
+		t.Fatalf("WritePNG: unexpected error %v", err)
+	}
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("png.Decode: unexpected error %v", err)
+	}
+	minx, miny, maxx, maxy := p.Bounds()
+	b := img.Bounds()
+	if b.Dx() != int(math.Ceil((maxx-minx)*p.Scale)) || b.Dy() != int(math.Ceil((maxy-miny)*p.Scale)) {
+		t.Errorf("WritePNG: image size %v does not match bounds %f,%f - %f,%f", b, minx, miny, maxx, maxy)
+	}
+	// First base is safe, so its center is green
+	pos := Layout(f)
+	x := int((pos[0].X - minx) * p.Scale)
+	y := int((pos[0].Y - miny) * p.Scale)
+	if c := color.RGBAModel.Convert(img.At(x, y)); c != safeGreen {
+		t.Errorf("WritePNG: expected %v at base 0, got %v", safeGreen, c)
+	}
+}
+
+func TestArcsAndCircle(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAACCCAAAGGGAAACCCGGGAAAAAAACCCAAAA")
+	layers := []Layer{
+		{Name: "Reference", Folding: parseDotBracket("(((...)))...((([[[..)))....]]]........"), Color: LayerColors[0]},
+		{Name: "Example", Folding: parseDotBracket("(((...)))...(((...)))((((......))))..."), Color: LayerColors[1], Below: true},
+	}
+	tests := []struct {
+		name      string
+		p         *Picture
+		polylines int
+	}{
+		// One polyline per pair
+		{"ArcDiagram", ArcDiagram(seq, layers), 19},
+		// Pairs and the backbone circle
+		{"CirclePlot", CirclePlot(seq, layers), 20},
+	}
+	for _, tt := range tests {
+		var svg bytes.Buffer
+		if err := tt.p.WriteSVG(&svg); err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if n := strings.Count(svg.String(), "<polyline "); n != tt.polylines {
+			t.Errorf("%s: expected %d polylines, got %d", tt.name, tt.polylines, n)
+		}
+		for _, l := range layers {
+			if n := strings.Count(svg.String(), svgColor(l.Color)); n == 0 {
+				t.Errorf("%s: layer %s not drawn", tt.name, l.Name)
+			}
+			if !strings.Contains(svg.String(), ">"+l.Name+"<") {
+				t.Errorf("%s: layer %s missing from legend", tt.name, l.Name)
+			}
+		}
+	}
+
+	// Arcs of layers below the sequence do not go above it
+	p := ArcDiagram(seq, layers[1:])
+	if _, miny, _, _ := p.Bounds(); miny < -2 {
+		t.Errorf("ArcDiagram: arcs below the sequence extend to %f", miny)
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAACCC")
+	total := big.NewInt(4)
+	pairs := make([][]*big.Int, 9)
+	for i := range pairs {
+		pairs[i] = make([]*big.Int, 9)
+		for j := i + 1; j < 9; j++ {
+			pairs[i][j] = new(big.Int)
+		}
+	}
+	pairs[0][8].SetInt64(4)
+	pairs[1][7].SetInt64(2)
+	free := make([]*big.Int, 9)
+	for i := range free {
+		free[i] = big.NewInt(1)
+	}
+	fPairs, fFree := CountFractions(pairs, free, total)
+	if fPairs[0][8] != 1 || fPairs[1][7] != 0.5 || fPairs[0][1] != 0 || fFree[3] != 0.25 {
+		t.Errorf("CountFractions: unexpected fractions %v, %v", fPairs, fFree)
+	}
+	iPairs, iFree := IntFractions([][]int{{0, 2}, {0, 0}}, []int{2, 1}, 4)
+	if !reflect.DeepEqual(iPairs, [][]float64{{0, 0.5}, {0, 0}}) || !reflect.DeepEqual(iFree, []float64{0.5, 0.25}) {
+		t.Errorf("IntFractions: unexpected fractions %v, %v", iPairs, iFree)
+	}
+
+	ref := parseDotBracket("(((...)))")
+	p := Heatmap(seq, fPairs, fFree, ref)
+	var svg bytes.Buffer
+	if err := p.WriteSVG(&svg); err != nil {
+		t.Fatalf("WriteSVG: unexpected error %v", err)
+	}
+	// Background, two pairs, nine free bases, three reference pairs and
+	// ten steps of color scale
+	if n := strings.Count(svg.String(), "<rect "); n != 1+1+2+9+3+10 {
+		t.Errorf("Heatmap: expected %d rectangles, got %d", 1+1+2+9+3+10, n)
+	}
+	if !strings.Contains(svg.String(), `<rect x="2" y="6" width="1" height="1" fill="#000000"/>`) {
+		t.Errorf("Heatmap: reference pair (2,6) not marked in lower triangle")
+	}
+	if !strings.Contains(svg.String(), `<rect x="8" y="0" width="1" height="1" fill="#225ea8"/>`) {
+		t.Errorf("Heatmap: pair (0,8) not drawn in upper triangle")
+	}
+}
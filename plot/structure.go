@@ -0,0 +1,183 @@
+package plot /* import "keltainen.duckdns.org/rnafolding/plot" */
+
+import "math"
+import "math/big"
+import "strconv"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// Point is a position in a drawing.
+type Point struct {
+	X, Y float64
+}
+
+func (p Point) add(o Point) Point {
+	return Point{p.X + o.X, p.Y + o.Y}
+}
+
+func (p Point) sub(o Point) Point {
+	return Point{p.X - o.X, p.Y - o.Y}
+}
+
+func (p Point) mul(k float64) Point {
+	return Point{p.X * k, p.Y * k}
+}
+
+func (p Point) length() float64 {
+	return math.Hypot(p.X, p.Y)
+}
+
+// Layout places the bases of f in the plane, with one unit between
+// consecutive bases and paired bases. Stems are drawn as straight ladders
+// and loops as regular polygons, radiating out from the exterior loop,
+// which is drawn as a straight line. Crossing pairs are left out of the
+// layout.
+func Layout(f folding.FoldingPairs) []Point {
+	nested, _ := folding.SplitCrossing(f)
+	pos := make([]Point, len(f))
+	// Next position on the exterior loop, and leftmost position where the
+	// next stem does not overlap the previous ones
+	x, clear := 0.0, math.Inf(-1)
+	for i := 0; i < len(f); i++ {
+		j := nested[i]
+		if j < i {
+			pos[i] = Point{x, 0}
+			x++
+			continue
+		}
+		layoutStem(nested, pos, i, j, Point{0, 0}, Point{1, 0}, Point{0, -1})
+		minx, maxx := math.Inf(1), math.Inf(-1)
+		for k := i; k <= j; k++ {
+			minx = math.Min(minx, pos[k].X)
+			maxx = math.Max(maxx, pos[k].X)
+		}
+		shift := Point{math.Max(x, clear-minx), 0}
+		for k := i; k <= j; k++ {
+			pos[k] = pos[k].add(shift)
+		}
+		x = pos[j].X + 1
+		clear = maxx + shift.X + 1
+		i = j
+	}
+	return pos
+}
+
+// layoutStem places the stem starting with pair (i, j) at pi and pj and
+// continuing in direction dir, and the loop closing it.
+func layoutStem(f folding.FoldingPairs, pos []Point, i, j int, pi, pj, dir Point) {
+	for {
+		pos[i] = pi
+		pos[j] = pj
+		if f[i+1] != j-1 || i+1 >= j-1 {
+			break
+		}
+		i, j = i+1, j-1
+		pi, pj = pi.add(dir), pj.add(dir)
+	}
+
+	// Loop is a regular polygon with sides of unit length
+	numVertices := 2
+	for k := i + 1; k < j; k++ {
+		if f[k] > k {
+			numVertices += 2
+			k = f[k]
+		} else {
+			numVertices++
+		}
+	}
+	step := 2 * math.Pi / float64(numVertices)
+	radius := 0.5 / math.Sin(step/2)
+	mid := pi.add(pj).mul(0.5)
+	center := mid.add(dir.mul(radius * math.Cos(step/2)))
+
+	angle := math.Atan2(pi.Y-center.Y, pi.X-center.X)
+	// Direction of rotation from j to i
+	toJ := math.Atan2(pj.Y-center.Y, pj.X-center.X)
+	if math.Sin(angle-toJ) < 0 {
+		step = -step
+	}
+	vertex := func(n int) Point {
+		a := angle + float64(n)*step
+		return center.add(Point{math.Cos(a), math.Sin(a)}.mul(radius))
+	}
+	n := 1
+	for k := i + 1; k < j; k++ {
+		if f[k] > k {
+			l := f[k]
+			pk, pl := vertex(n), vertex(n+1)
+			d := pk.add(pl).mul(0.5).sub(center)
+			layoutStem(f, pos, k, l, pk, pl, d.mul(1/d.length()))
+			n += 2
+			k = l
+		} else {
+			pos[k] = vertex(n)
+			n++
+		}
+	}
+}
+
+// StructureOptions selects how bases are colored in Structure. If
+// PairCount and FreeCount are set, each base is colored by the fraction
+// of foldings in which it is paired or free as in the drawn folding.
+// Otherwise, if Safety is set, safe bases are highlighted.
+type StructureOptions struct {
+	Safety    []bool
+	PairCount [][]*big.Int
+	FreeCount []*big.Int
+	Total     *big.Int
+}
+
+func (o *StructureOptions) frequency(f folding.FoldingPairs, i int) float64 {
+	var count *big.Int
+	if j := f[i]; j < 0 {
+		count = o.FreeCount[i]
+	} else if i < j {
+		count = o.PairCount[i][j]
+	} else {
+		count = o.PairCount[j][i]
+	}
+	frac, _ := new(big.Rat).SetFrac(count, o.Total).Float64()
+	return frac
+}
+
+// Structure draws the secondary structure of the folding f.
+func Structure(seq *base.Sequence, f folding.FoldingPairs, opts StructureOptions) *Picture {
+	pos := Layout(f)
+	byFrequency := opts.PairCount != nil && opts.FreeCount != nil && opts.Total != nil && opts.Total.Sign() > 0
+	p := NewPicture()
+
+	for i := 1; i < len(pos); i++ {
+		p.Line(pos[i-1].X, pos[i-1].Y, pos[i].X, pos[i].Y, 0.1, grey)
+	}
+	nested, crossing := folding.SplitCrossing(f)
+	for i, j := range nested {
+		if j > i {
+			p.Line(pos[i].X, pos[i].Y, pos[j].X, pos[j].Y, 0.15, black)
+		}
+	}
+	for i, j := range crossing {
+		if j > i {
+			p.DashedLine(pos[i].X, pos[i].Y, pos[j].X, pos[j].Y, 0.1, black)
+		}
+	}
+
+	for i, pt := range pos {
+		fill := white
+		if byFrequency {
+			fill = Gradient(opts.frequency(f, i))
+		} else if opts.Safety != nil {
+			if opts.Safety[i] {
+				fill = safeGreen
+			} else {
+				fill = lightGrey
+			}
+		}
+		p.Circle(pt.X, pt.Y, 0.4, fill, grey)
+		p.Text(pt.X, pt.Y, 0.5, seq.Bases[i].ToCode(), textColor(fill))
+		if (i+1)%10 == 0 || i == 0 {
+			p.Text(pt.X, pt.Y-0.7, 0.35, strconv.Itoa(i+1), grey)
+		}
+	}
+	return p
+}
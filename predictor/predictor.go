@@ -0,0 +1,136 @@
+// Package predictor defines the interface shared by the maximum pairs
+// predictors, and a registry for selecting them by name.
+//
+// Predictor packages register themselves when imported, so a program
+// using a third party predictor only needs to import its package:
+//
+//	import _ "example.com/myfolding"
+package predictor /* import "keltainen.duckdns.org/rnafolding/predictor" */
+
+import "context"
+import "fmt"
+import "math/big"
+import "sort"
+import "strings"
+import "sync"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// Rules restricts which foldings are allowed.
+type Rules struct {
+	MinHairpin int
+	// Largest allowed j - i of a pair (i, j), or 0 for no limit
+	MaxSpan int
+	// Whether every pair (i, j) must stack on (i+1, j-1) or (i-1, j+1)
+	NoLonelyPairs bool
+}
+
+// CanPair tells whether bases i < j of seq may pair under the rules. Lonely
+// pairs depend on the rest of the folding and are not checked.
+func (r Rules) CanPair(seq *base.Sequence, i, j int) bool {
+	return (r.MaxSpan == 0 || j-i <= r.MaxSpan) && seq.CanPair(i, j, r.MinHairpin)
+}
+
+// Predictor finds the foldings of a sequence that have maximal number of
+// pairs.
+//
+// Fill and OptimalFoldings may take a long time. They return ctx.Err() if
+// ctx is cancelled before they are done.
+type Predictor interface {
+	// Fill computes the dynamic programming arrays. It must be called
+	// successfully before other methods.
+	Fill(ctx context.Context) error
+	// OptimalScore returns the number of pairs in optimal foldings.
+	OptimalScore() int
+	// Optimal returns one optimal folding.
+	Optimal() folding.FoldingPairs
+	// OptimalFoldings returns distinct optimal foldings. Unless the
+	// algorithm is registered as complete, some may be missing.
+	OptimalFoldings(ctx context.Context) (folding.FoldingSet, error)
+}
+
+// Counter is implemented by predictors that can count the optimal foldings
+// without listing them.
+type Counter interface {
+	CountOptimal() *big.Int
+}
+
+// Enumerator is implemented by predictors that can pass the optimal
+// foldings to a function one at a time, without keeping them all in memory.
+type Enumerator interface {
+	// Enumerate calls fn with each optimal folding until fn returns false.
+	// If limit is positive, at most limit foldings are passed, and
+	// truncated tells whether there were more.
+	Enumerate(ctx context.Context, limit int64, fn func(folding.FoldingPairs) bool) (truncated bool, err error)
+}
+
+// SafetyPredictor is implemented by predictors that can tell which bases
+// are paired or left free the same way in all optimal foldings.
+type SafetyPredictor interface {
+	Safety() ([]bool, error)
+}
+
+// Algorithm describes a registered predictor.
+type Algorithm struct {
+	Name string
+	// Whether OptimalFoldings returns all optimal foldings
+	Complete bool
+	// New returns a predictor for seq following rules
+	New func(seq *base.Sequence, rules Rules) Predictor
+}
+
+var (
+	mu         sync.RWMutex
+	algorithms = map[string]Algorithm{}
+)
+
+// Register makes an algorithm available by its name. It panics if the name
+// is already in use.
+func Register(a Algorithm) {
+	mu.Lock()
+	defer mu.Unlock()
+	if a.New == nil {
+		panic("predictor: Register of " + a.Name + " without New")
+	}
+	if _, dup := algorithms[a.Name]; dup {
+		panic("predictor: Register called twice for " + a.Name)
+	}
+	algorithms[a.Name] = a
+}
+
+// Lookup returns the algorithm registered with name.
+func Lookup(name string) (Algorithm, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	a, ok := algorithms[name]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("unknown algorithm %q, known algorithms are %s", name, strings.Join(namesLocked(), ", "))
+	}
+	return a, nil
+}
+
+// New returns a predictor of the algorithm registered with name.
+func New(name string, seq *base.Sequence, rules Rules) (Predictor, error) {
+	a, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return a.New(seq, rules), nil
+}
+
+// Names returns the names of registered algorithms in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
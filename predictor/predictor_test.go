@@ -0,0 +1,70 @@
+package predictor /* import "keltainen.duckdns.org/rnafolding/predictor" */
+
+import "context"
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+type fakePredictor struct {
+	seq   *base.Sequence
+	rules Rules
+}
+
+func (p *fakePredictor) Fill(ctx context.Context) error { return nil }
+func (p *fakePredictor) OptimalScore() int              { return 0 }
+func (p *fakePredictor) Optimal() folding.FoldingPairs {
+	return folding.NewFoldingPairs(len(p.seq.Bases))
+}
+func (p *fakePredictor) OptimalFoldings(ctx context.Context) (folding.FoldingSet, error) {
+	return folding.FoldingSet{p.Optimal()}, nil
+}
+
+func newFake(seq *base.Sequence, rules Rules) Predictor {
+	return &fakePredictor{seq, rules}
+}
+
+func TestRegistry(t *testing.T) {
+	Register(Algorithm{Name: "test-fake-b", New: newFake})
+	Register(Algorithm{Name: "test-fake-a", Complete: true, New: newFake})
+
+	names := Names()
+	var fakes []string
+	for _, name := range names {
+		if name == "test-fake-a" || name == "test-fake-b" {
+			fakes = append(fakes, name)
+		}
+	}
+	if !reflect.DeepEqual(fakes, []string{"test-fake-a", "test-fake-b"}) {
+		t.Errorf("Names() = %v, want registered algorithms in sorted order", names)
+	}
+
+	a, err := Lookup("test-fake-a")
+	if err != nil || a.Name != "test-fake-a" || !a.Complete {
+		t.Errorf("Lookup(test-fake-a) = %+v, %v", a, err)
+	}
+
+	seq := base.SequenceFromString("GGGAAAUCC")
+	p, err := New("test-fake-b", seq, Rules{MinHairpin: 2})
+	if err != nil {
+		t.Fatalf("New(test-fake-b): %v", err)
+	}
+	if fp, ok := p.(*fakePredictor); !ok || fp.seq != seq || fp.rules.MinHairpin != 2 {
+		t.Errorf("New(test-fake-b) = %#v, want fake predictor for the sequence and rules", p)
+	}
+
+	if _, err := New("test-missing", seq, Rules{}); err == nil {
+		t.Errorf("New(test-missing) returned no error")
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	Register(Algorithm{Name: "test-twice", New: newFake})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register did not panic for a name already in use")
+		}
+	}()
+	Register(Algorithm{Name: "test-twice", New: newFake})
+}
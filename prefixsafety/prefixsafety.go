@@ -0,0 +1,132 @@
+package main /* import "keltainen.duckdns.org/rnafolding/prefixsafety" */
+
+import "bufio"
+import "context"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "io"
+import "log"
+import "os"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/fasta"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
+
+var (
+	infile     = flag.String("in", "", "Name of input file in multi-FASTA format")
+	minhairpin = flag.Int("minhairpin", 3, "Minimum number of free bases in hairpin loop")
+	maxspan    = flag.Int("maxspan", 0, "Maximum distance j-i of paired bases i and j. Zero does not limit")
+	nolp       = flag.Bool("nolp", false, "Allow only pairs that stack on another pair")
+	format     = flag.String("format", "tsv", "Output format: tsv or json")
+	timeout    = flag.Duration("timeout", 0, "Abort analysis of a sequence after given time, for example 10m. Zero does not limit")
+)
+
+// profile is the safety of each prefix of one sequence.
+type profile struct {
+	Name     string
+	Sequence string
+	Prefixes []safecomplete.PrefixSafety
+}
+
+func main() {
+	flag.Parse()
+
+	if *infile == "" {
+		fmt.Print("Please set the input file with --in flag")
+		return
+	}
+	if *format != "tsv" && *format != "json" {
+		log.Fatalf("Unknown output format \"%s\", must be tsv or json", *format)
+	}
+	if *minhairpin < 0 || *maxspan < 0 {
+		log.Fatalf("Minimum hairpin length and maximum pair span must not be negative")
+	}
+
+	var profiles []profile
+	seqs, err := fasta.ReadMultiSequenceFile(*infile)
+	// Reference foldings are not used, so invalid ones do not matter
+	if _, ok := err.(fasta.FoldingErrors); err != nil && !ok {
+		log.Fatalf("Error reading FASTA format file \"%s\": %v", *infile, err)
+	}
+	for _, seq := range seqs {
+		prefixes, err := prefixSafety(seq)
+		if err != nil {
+			log.Printf("Analysis of %s failed: %v", seq.Name, err)
+			continue
+		}
+		profiles = append(profiles, profile{seq.Name, seq.BasesString(), prefixes})
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *format == "json" {
+		d, err := json.MarshalIndent(profiles, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to write JSON: %v", err)
+		}
+		w.Write(d)
+		w.WriteString("\n")
+	} else {
+		for _, p := range profiles {
+			writeMatrix(w, p)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+}
+
+// analysisContext returns the context for analysing one sequence, limited
+// by the -timeout flag.
+func analysisContext() (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(context.Background(), *timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func prefixSafety(seq *base.Sequence) ([]safecomplete.PrefixSafety, error) {
+	ctx, cancel := analysisContext()
+	defer cancel()
+	p := &safecomplete.Predictor{Seq: seq, MinHairpin: *minhairpin, MaxSpan: *maxspan, NoLonelyPairs: *nolp}
+	if err := p.FillArrayContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.CountSolutionsContext(ctx); err != nil {
+		return nil, err
+	}
+	return p.PrefixSafetyContext(ctx)
+}
+
+// writeMatrix writes the prefix safety of a sequence as a table with a row
+// for each prefix and a column for each base. A base is marked with a
+// bracket if it is safe and paired, a dot if it is safe and free, and a
+// dash if it is not safe. Bases after the prefix are left empty.
+func writeMatrix(w io.Writer, p profile) {
+	fmt.Fprintf(w, "name\tlength\tpairs\tfoldings")
+	for i, b := range p.Sequence {
+		fmt.Fprintf(w, "\t%c%d", b, i+1)
+	}
+	fmt.Fprintln(w)
+	for _, ps := range p.Prefixes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s", p.Name, ps.Length, ps.OptimalPairs, ps.Foldings)
+		for i := range p.Sequence {
+			fmt.Fprintf(w, "\t%s", cell(ps, i))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func cell(ps safecomplete.PrefixSafety, i int) string {
+	switch {
+	case i >= ps.Length:
+		return ""
+	case !ps.Safe[i]:
+		return "-"
+	case ps.SafePairs[i] < 0:
+		return "."
+	case ps.SafePairs[i] > i:
+		return "("
+	}
+	return ")"
+}
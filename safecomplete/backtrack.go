@@ -1,25 +1,50 @@
 package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
 
-import "log"
+import "context"
 import "math/big"
 
 import "keltainen.duckdns.org/rnafolding/types"
 
-func (p *Predictor) BacktrackAll() *types.FoldTree {
-	p.BacktrackSafety()
-	return p.BacktrackFolding()
+func (p *Predictor) BacktrackAll() (*types.FoldTree, error) {
+	if err := p.BacktrackSafety(); err != nil {
+		return nil, err
+	}
+	return p.BacktrackFolding(), nil
 }
 
 func (p *Predictor) BacktrackFolding() *types.FoldTree {
-	numBases := len(p.Seq.Bases)
-	folding := &types.FoldTree{}
-	p.recursiveFolding(0, numBases-1, folding)
+	folding, _ := p.BacktrackFoldingContext(context.Background())
 	return folding
 }
 
-func (p *Predictor) BacktrackSafety() {
+// BacktrackFoldingContext is like BacktrackFolding, but stops and returns
+// ctx.Err() if ctx is cancelled before the tree is complete.
+func (p *Predictor) BacktrackFoldingContext(ctx context.Context) (*types.FoldTree, error) {
+	numBases := len(p.Seq.Bases)
+	memo := map[pair]*interval{}
+	top, err := p.recursiveFolding(ctx, &pair{I: 0, J: numBases - 1}, memo)
+	if err != nil {
+		return nil, err
+	}
+	folding := &types.FoldTree{
+		Pairs: append([]types.Pair(nil), top.pairs...),
+		Free:  append([]int(nil), top.free...),
+	}
+	top.addAlternatives(folding)
+	return folding, nil
+}
+
+// BacktrackSafety counts the foldings in which each pair and free base
+// appears. Returns ErrNotCounted if CountSolutions has not been run.
+func (p *Predictor) BacktrackSafety() error {
+	return p.BacktrackSafetyContext(context.Background())
+}
+
+// BacktrackSafetyContext is like BacktrackSafety, but stops and returns
+// ctx.Err() if ctx is cancelled before the counts are complete.
+func (p *Predictor) BacktrackSafetyContext(ctx context.Context) error {
 	if p.Sol == nil {
-		log.Fatal("Must run safecomplete.CountSolutions before safecomplete.SafetyBacktrack")
+		return ErrNotCounted
 	}
 	numBases := len(p.Seq.Bases)
 	p.PairSafety = make([][]*big.Int, numBases)
@@ -34,77 +59,131 @@ func (p *Predictor) BacktrackSafety() {
 		p.SingleSafety[i] = new(big.Int)
 	}
 
-	p.recursiveSafety(0, numBases-1, p.Sol[0][numBases-1])
+	return p.recursiveSafety(ctx, &pair{I: 0, J: numBases - 1}, p.Sol[0][numBases-1])
 }
 
-func (p *Predictor) recursiveFolding(i, j int, folding *types.FoldTree) {
-	if i >= j {
-		if i == j {
-			folding.Free = append(folding.Free, i)
-		}
-		return
-	}
+// interval holds the foldings of one subinterval: pairs and free bases
+// common to all of them, and a node with the alternatives for the rest,
+// or nil if there is only one folding. The alternatives node is shared by
+// all parents of the interval, which makes the folding tree a DAG.
+type interval struct {
+	pairs []types.Pair
+	free  []int
+	alt   *types.FoldTree
+}
 
-	splits := p.findSplits(i, j)
+func (iv *interval) addTo(f *types.FoldTree) {
+	f.Pairs = append(f.Pairs, iv.pairs...)
+	f.Free = append(f.Free, iv.free...)
+}
 
-	for _, s := range splits {
-		branch := folding
-		if len(splits) > 1 {
-			branch = &types.FoldTree{}
-			folding.Branches = append(folding.Branches, branch)
+func (iv *interval) addAlternatives(f *types.FoldTree) {
+	if iv.alt != nil {
+		f.Branches = iv.alt.Branches
+		f.JoinPrefix = iv.alt.JoinPrefix
+		f.JoinSuffix = iv.alt.JoinSuffix
+	}
+}
+
+func (p *Predictor) recursiveFolding(ctx context.Context, span *pair, memo map[pair]*interval) (*interval, error) {
+	if span.I >= span.J {
+		if span.I == span.J {
+			return &interval{free: []int{span.I}}, nil
 		}
+		return &interval{}, nil
+	}
+	if iv, ok := memo[*span]; ok {
+		return iv, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	splits := p.findSplits(span)
+	branches := make([]*types.FoldTree, len(splits))
+	for n, s := range splits {
+		branch := &types.FoldTree{}
 		if s.Pair != nil {
 			branch.Pairs = append(branch.Pairs, types.Pair{I: s.Pair.I, J: s.Pair.J})
 		}
 
+		pref, err := p.recursiveFolding(ctx, s.Pre, memo)
+		if err != nil {
+			return nil, err
+		}
+		pref.addTo(branch)
 		if s.Suf != nil {
-			branch.JoinPrefix = &types.FoldTree{}
-			p.recursiveFolding(s.Pre.I, s.Pre.J, branch.JoinPrefix)
-			branch.JoinSuffix = &types.FoldTree{}
-			p.recursiveFolding(s.Suf.I, s.Suf.J, branch.JoinSuffix)
+			suff, err := p.recursiveFolding(ctx, s.Suf, memo)
+			if err != nil {
+				return nil, err
+			}
+			suff.addTo(branch)
+			if pref.alt != nil && suff.alt != nil {
+				branch.JoinPrefix = pref.alt
+				branch.JoinSuffix = suff.alt
+			} else if pref.alt == nil {
+				suff.addAlternatives(branch)
+			} else {
+				pref.addAlternatives(branch)
+			}
 		} else {
-			p.recursiveFolding(s.Pre.I, s.Pre.J, branch)
+			pref.addAlternatives(branch)
 		}
-
+		branches[n] = branch
 	}
 
-	folding.SimplifyImmediate()
+	iv := &interval{}
+	if len(branches) == 1 {
+		b := branches[0]
+		iv.pairs = b.Pairs
+		iv.free = b.Free
+		if b.JoinPrefix != nil || len(b.Branches) > 0 {
+			iv.alt = &types.FoldTree{Branches: b.Branches, JoinPrefix: b.JoinPrefix, JoinSuffix: b.JoinSuffix}
+		}
+	} else {
+		iv.pairs, iv.free, branches = types.SplitCommon(branches)
+		iv.alt = &types.FoldTree{Branches: branches}
+	}
+	memo[*span] = iv
+	return iv, nil
 }
 
-func (p *Predictor) recursiveSafety(i, j int, numSols *big.Int) {
-	if i >= j {
-		if i == j {
-			p.SingleSafety[i].Add(p.SingleSafety[i], numSols)
+func (p *Predictor) recursiveSafety(ctx context.Context, iv *pair, numSols *big.Int) error {
+	if iv.I >= iv.J {
+		if iv.I == iv.J {
+			p.SingleSafety[iv.I].Add(p.SingleSafety[iv.I], numSols)
 		}
-		return
+		return nil
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	solScale := new(big.Int)
 	solMod := new(big.Int)
-	solScale.DivMod(numSols, p.Sol[i][j], solMod)
-	if solMod.Cmp(big.NewInt(0)) != 0 {
-		log.Printf("recursiveFolding(%d, %d, ...): numSols=%v is not divisible by p.Sol=%v",
-			i, j, numSols, p.Sol[i][j])
+	solScale.DivMod(numSols, p.sol(iv), solMod)
+	if solMod.Sign() != 0 {
+		return &CountError{I: iv.I, J: iv.J, Count: numSols, Sol: p.sol(iv)}
 	}
 
-	splits := p.findSplits(i, j)
+	splits := p.findSplits(iv)
 
 	for _, s := range splits {
-		partNumSols := new(big.Int).Mul(p.Sol[s.Pre.I][s.Pre.J], solScale)
-		if s.Suf != nil {
-			partNumSols.Mul(partNumSols, p.Sol[s.Suf.I][s.Suf.J])
-		}
+		partNumSols := p.splitCount(s)
+		partNumSols.Mul(partNumSols, solScale)
 
 		if s.Pair != nil {
 			p.PairSafety[s.Pair.I][s.Pair.J].Add(p.PairSafety[s.Pair.I][s.Pair.J], partNumSols)
 		}
 
+		if err := p.recursiveSafety(ctx, s.Pre, partNumSols); err != nil {
+			return err
+		}
 		if s.Suf != nil {
-			p.recursiveSafety(s.Pre.I, s.Pre.J, partNumSols)
-			p.recursiveSafety(s.Suf.I, s.Suf.J, partNumSols)
-		} else {
-			p.recursiveSafety(s.Pre.I, s.Pre.J, partNumSols)
+			if err := p.recursiveSafety(ctx, s.Suf, partNumSols); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
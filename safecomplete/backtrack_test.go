@@ -0,0 +1,53 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "strings"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/types"
+
+func countNodes(f *types.FoldTree, seen map[*types.FoldTree]bool) {
+	if seen[f] {
+		return
+	}
+	seen[f] = true
+	if f.JoinPrefix != nil {
+		countNodes(f.JoinPrefix, seen)
+		countNodes(f.JoinSuffix, seen)
+	}
+	for _, b := range f.Branches {
+		countNodes(b, seen)
+	}
+}
+
+func TestBacktrackFoldingShared(t *testing.T) {
+	tests := []struct {
+		seq      string
+		maxNodes int
+	}{
+		{"GGGAAACCCAAAGGGAAACCC", 10},
+		{strings.Repeat("GGGAAACCCAAA", 8), 2000},
+		{strings.Repeat("GGAAACCAAUUUAAA", 6), 2000},
+	}
+	for _, tt := range tests {
+		p := &Predictor{Seq: base.SequenceFromString(tt.seq), MinHairpin: 3}
+		p.FillArray()
+		p.CountSolutions()
+		tree := p.BacktrackFolding()
+		expected := p.Sol[0][len(tt.seq)-1]
+		if n := tree.CountSolutions(); n.Cmp(expected) != 0 {
+			t.Errorf("BacktrackFolding(%s): expected %v foldings, got %v", tt.seq, expected, n)
+		}
+		tree.CollapseTree()
+		tree.LiftCommon()
+		if n := tree.CountSolutions(); n.Cmp(expected) != 0 {
+			t.Errorf("BacktrackFolding(%s): expected %v foldings after simplification, got %v", tt.seq, expected, n)
+		}
+		seen := map[*types.FoldTree]bool{}
+		countNodes(tree, seen)
+		if len(seen) > tt.maxNodes {
+			t.Errorf("BacktrackFolding(%s): %d nodes for %v foldings, expected at most %d",
+				tt.seq, len(seen), expected, tt.maxNodes)
+		}
+	}
+}
@@ -1,98 +1,155 @@
 package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
 
-import "log"
+import "context"
 import "math/big"
 
 func (p *Predictor) CountSolutions() {
+	p.CountSolutionsContext(context.Background())
+}
+
+// CountSolutionsContext is like CountSolutions, but stops and returns
+// ctx.Err() if ctx is cancelled before the counts are complete. Sol is
+// left nil in that case.
+func (p *Predictor) CountSolutionsContext(ctx context.Context) error {
 	numBases := len(p.V)
-	p.Sol = make([][]*big.Int, numBases)
-	for i := 0; i < len(p.V); i++ {
-		p.Sol[i] = make([]*big.Int, numBases)
+	p.Sol = newCountTable(numBases)
+	for i := 0; i < numBases; i++ {
 		p.Sol[i][i] = big.NewInt(1)
 		if i > 0 {
 			p.Sol[i][i-1] = big.NewInt(1)
 		}
 	}
+	if p.NoLonelyPairs {
+		p.solS = newCountTable(numBases)
+		p.solX = newCountTable(numBases)
+	}
 
 	for l := 2; l <= numBases; l++ {
+		if err := ctx.Err(); err != nil {
+			p.Sol, p.solS, p.solX = nil, nil, nil
+			return err
+		}
 		for i := 0; i <= numBases-l; i++ {
 			j := i + l - 1
-			numFound := big.NewInt(0)
-			if p.V[i][j] == p.V[i][j-1] {
-				numFound.Add(numFound, p.Sol[i][j-1])
-			}
-			// Have to check CanPair here: p.W[i][j] might be less than p.V[i][j]
-			if p.Seq.CanPair(i, j, p.MinHairpin) && p.V[i][j] == p.V[i+1][j-1]+1 {
-				numFound.Add(numFound, p.Sol[i+1][j-1])
-			}
-			for k := i; k < j; k++ {
-				if p.V[i][j] == p.V[i][k]+p.W[k+1][j] && p.W[k+1][j] > 0 {
-					// k+1 and i are paired, so check p.Sol for bases inside that pair
-					numFound.Add(numFound, new(big.Int).Mul(p.Sol[i][k], p.Sol[k+2][j-1]))
+			for _, k := range p.kinds() {
+				numFound := big.NewInt(0)
+				iv := &pair{i, j, k}
+				for _, s := range p.findSplits(iv) {
+					numFound.Add(numFound, p.splitCount(s))
 				}
+				p.solTable(k)[i][j] = numFound
 			}
-			p.Sol[i][j] = numFound
 		}
 	}
+	return nil
+}
+
+func newCountTable(n int) [][]*big.Int {
+	t := make([][]*big.Int, n)
+	for i := range t {
+		t[i] = make([]*big.Int, n)
+	}
+	return t
 }
 
-func (p *Predictor) CountPairings() {
+func (p *Predictor) solTable(k kind) [][]*big.Int {
+	switch k {
+	case paired:
+		return p.solS
+	case inside:
+		return p.solX
+	}
+	return p.Sol
+}
+
+// CountPairings counts the foldings in which each pair and free base
+// appears. Returns ErrNotCounted if CountSolutions has not been run.
+func (p *Predictor) CountPairings() error {
+	return p.CountPairingsContext(context.Background())
+}
+
+// CountPairingsContext is like CountPairings, but stops and returns
+// ctx.Err() if ctx is cancelled before the counts are complete.
+func (p *Predictor) CountPairingsContext(ctx context.Context) error {
 	if p.Sol == nil {
-		log.Fatal("Must run safecomplete.CountSolutions before safecomplete.CountPairings")
+		return ErrNotCounted
+	}
+	pairSafety, usedBy, err := p.countPairings(ctx, len(p.Seq.Bases))
+	if err != nil {
+		return err
 	}
-	numBases := len(p.Seq.Bases)
-	p.PairSafety = make([][]*big.Int, numBases)
+	p.PairSafety, p.UsedBy = pairSafety, usedBy
+	p.SingleSafety = make([]*big.Int, len(usedBy))
+	for i := range usedBy {
+		p.SingleSafety[i] = usedBy[i][i]
+	}
+	return nil
+}
+
+// countPairings counts the optimal foldings of the prefix of numBases
+// bases in which each pair appears, and in which each interval is folded
+// on its own.
+func (p *Predictor) countPairings(ctx context.Context, numBases int) ([][]*big.Int, [][]*big.Int, error) {
+	pairSafety := make([][]*big.Int, numBases)
 	for i := 0; i < numBases; i++ {
-		p.PairSafety[i] = make([]*big.Int, numBases)
+		pairSafety[i] = make([]*big.Int, numBases)
 		for j := i + 1; j < numBases; j++ {
-			p.PairSafety[i][j] = new(big.Int)
+			pairSafety[i][j] = new(big.Int)
 		}
 	}
 
-	p.UsedBy = make([][]*big.Int, numBases)
-	for i := 0; i < numBases; i++ {
-		p.UsedBy[i] = make([]*big.Int, numBases)
-		for j := i; j < numBases; j++ {
-			p.UsedBy[i][j] = new(big.Int)
+	usedBy := make([][][]*big.Int, len(p.kinds()))
+	for _, k := range p.kinds() {
+		usedBy[k] = newCountTable(numBases)
+		for i := 0; i < numBases; i++ {
+			for j := i; j < numBases; j++ {
+				usedBy[k][i][j] = new(big.Int)
+			}
+		}
+	}
+	if numBases > 0 {
+		usedBy[plain][0][numBases-1] = p.Sol[0][numBases-1]
+	}
+	use := func(iv *pair, n *big.Int) {
+		if iv.I <= iv.J {
+			usedBy[iv.Kind][iv.I][iv.J].Add(usedBy[iv.Kind][iv.I][iv.J], n)
 		}
 	}
-	p.UsedBy[0][numBases-1] = p.Sol[0][numBases-1]
 
 	for l := numBases; l >= 2; l-- {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		for i := 0; i <= numBases-l; i++ {
 			j := i + l - 1
-
-			numSols := p.UsedBy[i][j]
-			solScale := new(big.Int)
-			solMod := new(big.Int)
-			solScale.DivMod(numSols, p.Sol[i][j], solMod)
-			if solMod.Cmp(big.NewInt(0)) != 0 {
-				log.Printf("recursiveFolding(%d, %d, ...): numSols=%v is not divisible by p.Sol=%v",
-					i, j, numSols, p.Sol[i][j])
-			}
-
-			splits := p.findSplits(i, j)
-
-			for _, s := range splits {
-				partNumSols := new(big.Int).Mul(p.Sol[s.Pre.I][s.Pre.J], solScale)
-				if s.Suf != nil {
-					partNumSols.Mul(partNumSols, p.Sol[s.Suf.I][s.Suf.J])
+			for _, k := range p.kinds() {
+				iv := &pair{i, j, k}
+				numSols := usedBy[k][i][j]
+				if numSols.Sign() == 0 {
+					continue
 				}
-
-				if s.Pair != nil {
-					p.PairSafety[s.Pair.I][s.Pair.J].Add(p.PairSafety[s.Pair.I][s.Pair.J], partNumSols)
+				solScale := new(big.Int)
+				solMod := new(big.Int)
+				solScale.DivMod(numSols, p.sol(iv), solMod)
+				if solMod.Sign() != 0 {
+					return nil, nil, &CountError{I: i, J: j, Count: numSols, Sol: p.sol(iv)}
 				}
 
-				p.UsedBy[s.Pre.I][s.Pre.J].Add(p.UsedBy[s.Pre.I][s.Pre.J], partNumSols)
-				if s.Suf != nil {
-					p.UsedBy[s.Suf.I][s.Suf.J].Add(p.UsedBy[s.Suf.I][s.Suf.J], partNumSols)
+				for _, s := range p.findSplits(iv) {
+					partNumSols := p.splitCount(s)
+					partNumSols.Mul(partNumSols, solScale)
+
+					if s.Pair != nil {
+						pairSafety[s.Pair.I][s.Pair.J].Add(pairSafety[s.Pair.I][s.Pair.J], partNumSols)
+					}
+
+					use(s.Pre, partNumSols)
+					if s.Suf != nil {
+						use(s.Suf, partNumSols)
+					}
 				}
 			}
 		}
 	}
-
-	p.SingleSafety = make([]*big.Int, numBases)
-	for i := 0; i < numBases; i++ {
-		p.SingleSafety[i] = p.UsedBy[i][i]
-	}
+	return pairSafety, usedBy[plain], nil
 }
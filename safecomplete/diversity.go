@@ -0,0 +1,165 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "math/big"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// ExpectedPairDistance returns the expected base pair distance between two
+// optimal foldings chosen independently and uniformly at random.
+// Requires CountSolutions and CountPairings to have been run. An empty
+// sequence has only the empty folding, at distance zero.
+func (p *Predictor) ExpectedPairDistance() *big.Rat {
+	numBases := len(p.Seq.Bases)
+	if numBases == 0 {
+		return new(big.Rat)
+	}
+	total := p.Sol[0][numBases-1]
+	sum := new(big.Int)
+	for i := 0; i < numBases; i++ {
+		for j := i + 1; j < numBases; j++ {
+			c := p.PairSafety[i][j]
+			if c.Sign() == 0 {
+				continue
+			}
+			// Pair is in exactly one of the two foldings: 2 * c * (total - c)
+			rest := new(big.Int).Sub(total, c)
+			sum.Add(sum, rest.Mul(rest, c))
+		}
+	}
+	sum.Lsh(sum, 1)
+	return new(big.Rat).SetFrac(sum, new(big.Int).Mul(total, total))
+}
+
+// ExpectedDistanceTo returns the expected base pair distance between
+// an optimal folding chosen uniformly at random and the folding f.
+// Requires CountSolutions and CountPairings to have been run.
+func (p *Predictor) ExpectedDistanceTo(f folding.FoldingPairs) *big.Rat {
+	numBases := len(p.Seq.Bases)
+	if numBases == 0 {
+		return new(big.Rat)
+	}
+	total := p.Sol[0][numBases-1]
+	sum := new(big.Int)
+	for i := 0; i < numBases; i++ {
+		for j := i + 1; j < numBases; j++ {
+			if f[i] == j {
+				sum.Add(sum, total)
+				sum.Sub(sum, p.PairSafety[i][j])
+			} else {
+				sum.Add(sum, p.PairSafety[i][j])
+			}
+		}
+	}
+	return new(big.Rat).SetFrac(sum, total)
+}
+
+// Consensus returns the folding containing those pairs that appear in
+// more than half of the optimal foldings.
+// Requires CountSolutions and CountPairings to have been run.
+func (p *Predictor) Consensus() folding.FoldingPairs {
+	numBases := len(p.Seq.Bases)
+	f := make(folding.FoldingPairs, numBases)
+	if numBases == 0 {
+		return f
+	}
+	total := p.Sol[0][numBases-1]
+	for i := 0; i < numBases; i++ {
+		f[i] = -1
+	}
+	for i := 0; i < numBases; i++ {
+		for j := i + 1; j < numBases; j++ {
+			c := new(big.Int).Lsh(p.PairSafety[i][j], 1)
+			if c.Cmp(total) > 0 {
+				f[i] = j
+				f[j] = i
+			}
+		}
+	}
+	return f
+}
+
+// DistanceHistogram returns the number of optimal foldings at each base
+// pair distance from the folding f: element d of the returned slice is
+// the number of optimal foldings at distance d.
+func (p *Predictor) DistanceHistogram(f folding.FoldingPairs) []*big.Int {
+	numBases := len(p.Seq.Bases)
+	if numBases == 0 {
+		// The empty folding is at distance zero
+		return []*big.Int{big.NewInt(1)}
+	}
+	// Since all optimal foldings have the same number of pairs, distance
+	// depends only on the number of pairs shared with f. Count foldings
+	// by shared pairs with a polynomial version of CountSolutions.
+	shared := map[pair][]*big.Int{}
+	one := []*big.Int{big.NewInt(1)}
+	get := func(iv *pair) []*big.Int {
+		if iv.I >= iv.J {
+			return one
+		}
+		return shared[*iv]
+	}
+
+	for l := 2; l <= numBases; l++ {
+		for i := 0; i <= numBases-l; i++ {
+			j := i + l - 1
+			for _, k := range p.kinds() {
+				iv := &pair{i, j, k}
+				var sum []*big.Int
+				for _, s := range p.findSplits(iv) {
+					part := get(s.Pre)
+					if s.Suf != nil {
+						part = polyMul(part, get(s.Suf))
+					}
+					if s.Pair != nil && f[s.Pair.I] == s.Pair.J {
+						part = append([]*big.Int{new(big.Int)}, part...)
+					}
+					sum = polyAdd(sum, part)
+				}
+				shared[*iv] = sum
+			}
+		}
+	}
+
+	optimalPairs := p.V[0][numBases-1]
+	refPairs := 0
+	for i, j := range f {
+		if i < j {
+			refPairs++
+		}
+	}
+	hist := make([]*big.Int, optimalPairs+refPairs+1)
+	for d := range hist {
+		hist[d] = new(big.Int)
+	}
+	for k, c := range get(&pair{I: 0, J: numBases - 1}) {
+		hist[optimalPairs+refPairs-2*k].Set(c)
+	}
+	return hist
+}
+
+func polyAdd(a, b []*big.Int) []*big.Int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	out := make([]*big.Int, len(a))
+	for i := range a {
+		out[i] = new(big.Int).Set(a[i])
+		if i < len(b) {
+			out[i].Add(out[i], b[i])
+		}
+	}
+	return out
+}
+
+func polyMul(a, b []*big.Int) []*big.Int {
+	out := make([]*big.Int, len(a)+len(b)-1)
+	for i := range out {
+		out[i] = new(big.Int)
+	}
+	for i := range a {
+		for j := range b {
+			out[i+j].Add(out[i+j], new(big.Int).Mul(a[i], b[j]))
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "math/big"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func pairDistance(a, b folding.FoldingPairs) int {
+	d := 0
+	for i := range a {
+		if a[i] > i && b[i] != a[i] {
+			d++
+		}
+		if b[i] > i && a[i] != b[i] {
+			d++
+		}
+	}
+	return d
+}
+
+func TestDiversity(t *testing.T) {
+	tests := []string{
+		"GGGAAAUCC",
+		"GGGAAACCCAAAGGGAAACCC",
+		"NNAAANNNUUNNNNGGNNNCCCNN",
+		"GCGGAUUUAGCUCAGUUGGGAGAGCGCCAGACUGAA",
+	}
+	for _, tt := range tests {
+		seq := base.SequenceFromString(tt)
+		p := &Predictor{Seq: seq, MinHairpin: 3}
+		p.FillArray()
+		p.CountSolutions()
+		if err := p.CountPairings(); err != nil {
+			t.Fatalf("CountPairings(%s): %v", tt, err)
+		}
+		all := p.BacktrackFolding().GeneratePairArrays(seq)
+		n := int64(len(all))
+
+		pairSum := int64(0)
+		for _, a := range all {
+			for _, b := range all {
+				pairSum += int64(pairDistance(a, b))
+			}
+		}
+		expected := big.NewRat(pairSum, n*n)
+		if actual := p.ExpectedPairDistance(); actual.Cmp(expected) != 0 {
+			t.Errorf("ExpectedPairDistance(%s): expected %v, actual %v", tt, expected, actual)
+		}
+
+		consensus := p.Consensus()
+		refSum := int64(0)
+		hist := map[int]int64{}
+		for _, a := range all {
+			d := pairDistance(a, consensus)
+			refSum += int64(d)
+			hist[d]++
+		}
+		expected = big.NewRat(refSum, n)
+		if actual := p.ExpectedDistanceTo(consensus); actual.Cmp(expected) != 0 {
+			t.Errorf("ExpectedDistanceTo(%s): expected %v, actual %v", tt, expected, actual)
+		}
+
+		actualHist := p.DistanceHistogram(consensus)
+		for d, c := range actualHist {
+			if c.Cmp(big.NewInt(hist[d])) != 0 {
+				t.Errorf("DistanceHistogram(%s): expected %d foldings at distance %d, actual %v", tt, hist[d], d, c)
+			}
+			delete(hist, d)
+		}
+		if len(hist) > 0 {
+			t.Errorf("DistanceHistogram(%s): distances %v missing from %v", tt, hist, actualHist)
+		}
+	}
+}
+
+func TestDiversityEmpty(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString(""), MinHairpin: 3}
+	p.FillArray()
+	p.CountSolutions()
+	if err := p.CountPairings(); err != nil {
+		t.Fatalf("CountPairings: %v", err)
+	}
+	if d := p.ExpectedPairDistance(); d.Sign() != 0 {
+		t.Errorf("ExpectedPairDistance: expected 0, actual %v", d)
+	}
+	consensus := p.Consensus()
+	if len(consensus) != 0 {
+		t.Errorf("Consensus: expected empty folding, actual %v", consensus)
+	}
+	if d := p.ExpectedDistanceTo(consensus); d.Sign() != 0 {
+		t.Errorf("ExpectedDistanceTo: expected 0, actual %v", d)
+	}
+	if hist := p.DistanceHistogram(consensus); len(hist) != 1 || hist[0].Int64() != 1 {
+		t.Errorf("DistanceHistogram: expected [1], actual %v", hist)
+	}
+}
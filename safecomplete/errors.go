@@ -0,0 +1,66 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "errors"
+import "fmt"
+import "math/big"
+
+// ErrNotCounted is returned by methods that need the solution counts, when
+// CountSolutions or CountPairings has not been run.
+var ErrNotCounted = errors.New("safecomplete: solutions have not been counted")
+
+// LengthError tells that a folding is not of the same length as the
+// sequence.
+type LengthError struct {
+	Folding int
+	Bases   int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("folding has %d bases, sequence %d bases", e.Folding, e.Bases)
+}
+
+// SymmetryError tells that base I is paired with J, but J is not paired
+// with I.
+type SymmetryError struct {
+	I int
+	J int
+}
+
+func (e *SymmetryError) Error() string {
+	return fmt.Sprintf("folding is not symmetric: %d is paired with %d, but not the other way around", e.I, e.J)
+}
+
+// NotOptimalError tells that a folding is not one of the optimal foldings.
+type NotOptimalError struct {
+	Reason string
+}
+
+func (e *NotOptimalError) Error() string {
+	return "not an optimal folding: " + e.Reason
+}
+
+// CountError tells that the number of foldings using interval [I, J] is
+// not a multiple of the number of foldings of the interval, which means
+// that the solution counts are corrupt.
+type CountError struct {
+	I     int
+	J     int
+	Count *big.Int
+	Sol   *big.Int
+}
+
+func (e *CountError) Error() string {
+	return fmt.Sprintf("%v foldings use interval [%d, %d], not divisible by its %v foldings", e.Count, e.I, e.J, e.Sol)
+}
+
+// SafetyError tells that the number of foldings in which a base is paired
+// or free does not add up to the number of all foldings.
+type SafetyError struct {
+	Base  int
+	Count *big.Int
+	Total *big.Int
+}
+
+func (e *SafetyError) Error() string {
+	return fmt.Sprintf("base %d is in %v foldings, expected %v", e.Base, e.Count, e.Total)
+}
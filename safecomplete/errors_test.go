@@ -0,0 +1,100 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "context"
+import "math/big"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func TestNotCounted(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCC"), MinHairpin: 3}
+	p.FillArray()
+	if err := p.CountPairings(); err != ErrNotCounted {
+		t.Errorf("CountPairings: expected ErrNotCounted, got %v", err)
+	}
+	if err := p.BacktrackSafety(); err != ErrNotCounted {
+		t.Errorf("BacktrackSafety: expected ErrNotCounted, got %v", err)
+	}
+	if _, err := p.BacktrackAll(); err != ErrNotCounted {
+		t.Errorf("BacktrackAll: expected ErrNotCounted, got %v", err)
+	}
+	if _, err := p.SafetyFromBacktrack(); err != ErrNotCounted {
+		t.Errorf("SafetyFromBacktrack: expected ErrNotCounted, got %v", err)
+	}
+	if _, err := p.Rank(folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1, 0}); err != ErrNotCounted {
+		t.Errorf("Rank: expected ErrNotCounted, got %v", err)
+	}
+	if f := p.Unrank(new(big.Int)); f != nil {
+		t.Errorf("Unrank: expected nil, got %v", f)
+	}
+}
+
+func TestCountError(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCCAAACCCUUUGGG"), MinHairpin: 3}
+	p.FillArray()
+	p.CountSolutions()
+	if err := p.BacktrackSafety(); err != nil {
+		t.Fatalf("BacktrackSafety: %v", err)
+	}
+	n := len(p.Seq.Bases)
+	bad := new(big.Int).Add(p.Sol[0][n-1], big.NewInt(1))
+	err := p.recursiveSafety(context.Background(), &pair{I: 0, J: n - 1}, bad)
+	if e, ok := err.(*CountError); !ok || e.I != 0 || e.J != n-1 {
+		t.Errorf("recursiveSafety with %v foldings: expected CountError for [0, %d], got %v", bad, n-1, err)
+	}
+}
+
+func TestSafetyError(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCC"), MinHairpin: 3}
+	p.FillArray()
+	p.CountSolutions()
+	if err := p.CountPairings(); err != nil {
+		t.Fatalf("CountPairings: %v", err)
+	}
+	p.SingleSafety[4].Add(p.SingleSafety[4], big.NewInt(1))
+	_, err := p.SafetyFromBacktrack()
+	if e, ok := err.(*SafetyError); !ok || e.Base != 4 {
+		t.Errorf("SafetyFromBacktrack: expected SafetyError for base 4, got %v", err)
+	}
+}
+
+func TestMembershipErrors(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCC"), MinHairpin: 3}
+	p.FillArray()
+	if _, err := p.Membership(folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1}); err == nil {
+		t.Errorf("Membership of short folding: expected LengthError, got nil")
+	} else if _, ok := err.(*LengthError); !ok {
+		t.Errorf("Membership of short folding: expected LengthError, got %v", err)
+	}
+	_, err := p.Membership(folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1, -1})
+	if e, ok := err.(*SymmetryError); !ok || e.I != 0 || e.J != 8 {
+		t.Errorf("Membership of asymmetric folding: expected SymmetryError for (0, 8), got %v", err)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCCAAACCCUUUGGG"), MinHairpin: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.FillArrayContext(ctx); err != context.Canceled || p.V != nil {
+		t.Errorf("FillArrayContext: expected context.Canceled and no arrays, got %v", err)
+	}
+	p.FillArray()
+	if err := p.CountSolutionsContext(ctx); err != context.Canceled || p.Sol != nil {
+		t.Errorf("CountSolutionsContext: expected context.Canceled and no counts, got %v", err)
+	}
+	if _, err := p.BacktrackFoldingContext(ctx); err != context.Canceled {
+		t.Errorf("BacktrackFoldingContext: expected context.Canceled, got %v", err)
+	}
+	p.CountSolutions()
+	if err := p.CountPairingsContext(ctx); err != context.Canceled {
+		t.Errorf("CountPairingsContext: expected context.Canceled, got %v", err)
+	}
+	if err := p.BacktrackSafetyContext(ctx); err != context.Canceled {
+		t.Errorf("BacktrackSafetyContext: expected context.Canceled, got %v", err)
+	}
+	if _, err := p.IteratedTrivialSafetyContext(ctx, p.BacktrackFolding()); err != context.Canceled {
+		t.Errorf("IteratedTrivialSafetyContext: expected context.Canceled, got %v", err)
+	}
+}
@@ -1,54 +1,75 @@
 package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
 
+import "context"
+
 func (p *Predictor) FillArray() {
-	numBases := len(p.Seq.Bases)
+	p.FillArrayContext(context.Background())
+}
 
-	v := make([][]int, numBases)
-	for i := 0; i < numBases; i++ {
-		v[i] = make([]int, numBases)
+// FillArrayContext is like FillArray, but stops and returns ctx.Err() if
+// ctx is cancelled before the arrays are filled.
+func (p *Predictor) FillArrayContext(ctx context.Context) error {
+	numBases := len(p.Seq.Bases)
+	v := newTable(numBases, 0)
+	w := newTable(numBases, 0)
+	var s, x [][]int
+	if p.NoLonelyPairs {
+		s = newTable(numBases, -1)
+		x = newTable(numBases, 0)
 	}
-
-	for i := 0; i < numBases; i++ {
-		v[i][i] = 0
-		if i > 0 {
-			v[i-1][i] = 0
+	get := func(t [][]int, i, j int) int {
+		if i > j {
+			return 0
 		}
+		return t[i][j]
 	}
 
 	for l := 1; l < numBases; l++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for i := 0; i < numBases-l; i++ {
 			j := i + l
-			best := 0
-			for k := i; k < j; k++ {
-				val := v[i][k] + v[k+1][j]
-				if val > best {
-					best = val
+			// w[i][j] is the best folding of [i, j] where i and j pair
+			if p.canPair(i, j) {
+				if !p.NoLonelyPairs {
+					w[i][j] = get(v, i+1, j-1) + 1
+				} else {
+					s[i][j] = get(x, i+1, j-1) + 1
+					if i+1 < j-1 && s[i+1][j-1] >= 0 {
+						w[i][j] = s[i+1][j-1] + 1
+					}
 				}
 			}
-			if p.Seq.CanPair(i, j, p.MinHairpin) {
-				if val := v[i+1][j-1] + 1; val > best {
-					best = val
+			best := v[i][j-1]
+			for k := i; k < j; k++ {
+				if w[k][j] > 0 && get(v, i, k-1)+w[k][j] > best {
+					best = get(v, i, k-1) + w[k][j]
 				}
 			}
 			v[i][j] = best
+			if p.NoLonelyPairs {
+				x[i][j] = best
+				if s[i][j] > best {
+					x[i][j] = s[i][j]
+				}
+			}
 		}
 	}
 
-	p.V = v
-
-	w := make([][]int, numBases)
-	for i := 0; i < numBases; i++ {
-		w[i] = make([]int, numBases)
-	}
+	p.V, p.W, p.s, p.x = v, w, s, x
+	return nil
+}
 
-	for l := 2; l <= numBases; l++ {
-		for i := 0; i <= numBases-l; i++ {
-			j := i + l - 1
-			if p.Seq.CanPair(i, j, p.MinHairpin) {
-				w[i][j] = p.V[i+1][j-1] + 1
+func newTable(n, fill int) [][]int {
+	t := make([][]int, n)
+	for i := range t {
+		t[i] = make([]int, n)
+		if fill != 0 {
+			for j := range t[i] {
+				t[i][j] = fill
 			}
 		}
 	}
-
-	p.W = w
+	return t
 }
@@ -0,0 +1,146 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "fmt"
+import "strings"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/types"
+
+// Deviation is a place where a folding makes a choice that leads to fewer
+// pairs than optimal within interval [I, J].
+type Deviation struct {
+	I int
+	J int
+	// Pair ending at J chosen by the folding, nil if J is unpaired
+	Pair *types.Pair
+	// An optimal choice, nil if leaving J unpaired is optimal
+	Best *types.Pair
+	// Number of pairs lost by the choice
+	Loss int
+}
+
+// Membership tells whether a folding is one of the optimal foldings, and
+// if not, where the difference in number of pairs comes from.
+type Membership struct {
+	Optimal      bool
+	Pairs        int
+	OptimalPairs int
+	// Pairs which are not allowed by folding rules: crossing pairs, pairs
+	// of non-complementary bases, too short hairpins, too long spans and,
+	// with NoLonelyPairs, pairs left without a stacking pair
+	Invalid []types.Pair
+	// Deviations from optimal choices. Loss of deviations adds up to
+	// OptimalPairs - (Pairs - len(Invalid)).
+	Deviations []Deviation
+}
+
+// Membership checks if f is an optimal folding. Requires FillArray to have
+// been run.
+func (p *Predictor) Membership(f folding.FoldingPairs) (*Membership, error) {
+	numBases := len(p.Seq.Bases)
+	if len(f) != numBases {
+		return nil, &LengthError{Folding: len(f), Bases: numBases}
+	}
+	m := &Membership{OptimalPairs: p.V[0][numBases-1]}
+
+	for j, i := range f {
+		if i >= 0 && i != j && (i >= numBases || f[i] != j) {
+			return nil, &SymmetryError{I: j, J: i}
+		}
+	}
+
+	// Remove invalid pairs, so that the rest of the folding can be
+	// decomposed in the same way as the DP arrays
+	nested, crossing := folding.SplitCrossing(f)
+	for j, i := range f {
+		if i < 0 || i >= j {
+			continue
+		}
+		m.Pairs++
+		if crossing[j] == i || !p.canPair(i, j) {
+			m.Invalid = append(m.Invalid, types.Pair{I: i, J: j})
+			nested[i] = -1
+			nested[j] = -1
+		}
+	}
+
+	if p.NoLonelyPairs {
+		// Removing lonely pairs leaves no new lonely pairs, since the
+		// stacking pair of a pair is not lonely
+		var lonely []int
+		for i, j := range nested {
+			if i < j && folding.Lonely(nested, i) {
+				m.Invalid = append(m.Invalid, types.Pair{I: i, J: j})
+				lonely = append(lonely, i, j)
+			}
+		}
+		for _, i := range lonely {
+			nested[i] = -1
+		}
+	}
+
+	p.recursiveMembership(&pair{I: 0, J: numBases - 1}, nested, m)
+	m.Optimal = len(m.Invalid) == 0 && len(m.Deviations) == 0
+	return m, nil
+}
+
+func (p *Predictor) recursiveMembership(iv *pair, f folding.FoldingPairs, m *Membership) {
+	for iv.I < iv.J {
+		i, j := iv.I, iv.J
+		if iv.Kind == paired {
+			// f pairs i and j, the only choice
+			iv = p.pairInside(iv, i, j)
+			continue
+		}
+		var val int
+		var choice *types.Pair
+		var in *pair
+		if f[j] < 0 {
+			val = p.value(&pair{I: i, J: j - 1})
+		} else {
+			choice = &types.Pair{I: f[j], J: j}
+			in = p.pairInside(iv, f[j], j)
+			val = p.value(&pair{I: i, J: f[j] - 1}) + 1 + p.value(in)
+		}
+		if loss := p.value(iv) - val; loss > 0 {
+			var best *types.Pair
+			if s := p.findSplits(iv)[0]; s.Pair != nil {
+				best = &types.Pair{I: s.Pair.I, J: s.Pair.J}
+			}
+			m.Deviations = append(m.Deviations, Deviation{i, j, choice, best, loss})
+		}
+		if choice == nil {
+			iv = &pair{I: i, J: j - 1}
+		} else {
+			p.recursiveMembership(&pair{I: i, J: choice.I - 1}, f, m)
+			iv = in
+		}
+	}
+}
+
+func (m *Membership) String() string {
+	if m.Optimal {
+		return fmt.Sprintf("Folding is one of the optimal foldings with %d pairs", m.OptimalPairs)
+	}
+	out := []string{fmt.Sprintf("Folding has %d pairs, optimal foldings have %d pairs", m.Pairs, m.OptimalPairs)}
+	if len(m.Invalid) > 0 {
+		var pairs []string
+		for _, p := range m.Invalid {
+			pairs = append(pairs, fmt.Sprintf("(%d,%d)", p.I, p.J))
+		}
+		out = append(out, fmt.Sprintf("%d pairs are not allowed by folding rules: %s", len(m.Invalid), strings.Join(pairs, ", ")))
+	}
+	for _, d := range m.Deviations {
+		choice := fmt.Sprintf("leaves %d unpaired", d.J)
+		if d.Pair != nil {
+			choice = fmt.Sprintf("pairs (%d,%d)", d.Pair.I, d.Pair.J)
+		}
+		best := fmt.Sprintf("leaving %d unpaired", d.J)
+		if d.Best != nil {
+			best = fmt.Sprintf("pairing (%d,%d)", d.Best.I, d.Best.J)
+		}
+		out = append(out, fmt.Sprintf("Interval [%d,%d] %s, losing %d pairs compared to e.g. %s",
+			d.I, d.J, choice, d.Loss, best))
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,73 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/types"
+
+func TestMembership(t *testing.T) {
+	tests := []struct {
+		seq        string
+		f          folding.FoldingPairs
+		optimal    bool
+		invalid    []types.Pair
+		deviations []Deviation
+	}{
+		{
+			"GGGAAAUCC",
+			folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1, 0},
+			true, nil, nil,
+		},
+		{
+			"GGGAAAUCC",
+			folding.FoldingPairs{-1, 7, 6, -1, -1, -1, 2, 1, -1},
+			false, nil,
+			[]Deviation{{0, 8, nil, &types.Pair{I: 0, J: 8}, 1}},
+		},
+		{
+			"GGGAAAUCC",
+			folding.FoldingPairs{-1, -1, -1, -1, -1, -1, -1, -1, -1},
+			false, nil,
+			[]Deviation{
+				{0, 8, nil, &types.Pair{I: 0, J: 8}, 1},
+				{0, 7, nil, &types.Pair{I: 0, J: 7}, 1},
+				{0, 6, nil, &types.Pair{I: 0, J: 6}, 1},
+			},
+		},
+		// Non-complementary pair and a pseudoknot
+		{
+			"GGGAAAUCC",
+			folding.FoldingPairs{8, 7, 6, 5, -1, 3, 2, 1, 0},
+			false, []types.Pair{{I: 3, J: 5}}, nil,
+		},
+		{
+			"GGGAAAUCCGAAAC",
+			folding.FoldingPairs{8, 7, 6, 10, -1, -1, 2, 1, 0, -1, 3, -1, -1, -1},
+			false, []types.Pair{{I: 3, J: 10}},
+			[]Deviation{{0, 13, nil, &types.Pair{I: 9, J: 13}, 1}},
+		},
+	}
+	for _, tt := range tests {
+		p := &Predictor{Seq: base.SequenceFromString(tt.seq), MinHairpin: 3}
+		p.FillArray()
+		m, err := p.Membership(tt.f)
+		if err != nil {
+			t.Errorf("Membership(%s, %v): unexpected error %v", tt.seq, tt.f, err)
+			continue
+		}
+		if m.Optimal != tt.optimal || !reflect.DeepEqual(m.Invalid, tt.invalid) || !reflect.DeepEqual(m.Deviations, tt.deviations) {
+			t.Errorf("Membership(%s, %v): expected optimal=%v invalid=%v deviations=%v, got %+v",
+				tt.seq, tt.f, tt.optimal, tt.invalid, tt.deviations, m)
+		}
+		loss := 0
+		for _, d := range m.Deviations {
+			loss += d.Loss
+		}
+		if loss != m.OptimalPairs-(m.Pairs-len(m.Invalid)) {
+			t.Errorf("Membership(%s, %v): losses %d don't add up to %d - (%d - %d)",
+				tt.seq, tt.f, loss, m.OptimalPairs, m.Pairs, len(m.Invalid))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "context"
+import "math/big"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/predictor"
+
+func init() {
+	predictor.Register(predictor.Algorithm{
+		Name:     "safecomplete",
+		Complete: true,
+		New: func(seq *base.Sequence, rules predictor.Rules) predictor.Predictor {
+			return &Predictor{Seq: seq, MinHairpin: rules.MinHairpin, MaxSpan: rules.MaxSpan, NoLonelyPairs: rules.NoLonelyPairs}
+		},
+	})
+}
+
+func (p *Predictor) Fill(ctx context.Context) error {
+	return p.FillArrayContext(ctx)
+}
+
+func (p *Predictor) OptimalScore() int {
+	return p.V[0][len(p.V)-1]
+}
+
+func (p *Predictor) Optimal() folding.FoldingPairs {
+	if p.Sol == nil {
+		p.CountSolutions()
+	}
+	return p.Unrank(big.NewInt(0))
+}
+
+// OptimalFoldings lists all foldings in the folding tree. The number of
+// them grows exponentially with sequence length.
+func (p *Predictor) OptimalFoldings(ctx context.Context) (folding.FoldingSet, error) {
+	tree, err := p.BacktrackFoldingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ff folding.FoldingSet
+	it := tree.Iterate(ctx, len(p.Seq.Bases))
+	for it.Next() {
+		ff = append(ff, it.Folding())
+	}
+	return ff, it.Err()
+}
+
+func (p *Predictor) CountOptimal() *big.Int {
+	if p.Sol == nil {
+		p.CountSolutions()
+	}
+	return new(big.Int).Set(p.Sol[0][len(p.Sol)-1])
+}
+
+func (p *Predictor) Safety() ([]bool, error) {
+	if p.Sol == nil {
+		p.CountSolutions()
+	}
+	if p.PairSafety == nil {
+		if err := p.CountPairings(); err != nil {
+			return nil, err
+		}
+	}
+	return p.SafetyFromBacktrack()
+}
@@ -0,0 +1,76 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "context"
+import "math/big"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// PrefixSafety is the safety of the bases of a prefix of the sequence, as
+// if transcription had stopped after the last base of the prefix.
+type PrefixSafety struct {
+	// Number of bases in the prefix
+	Length       int
+	OptimalPairs int
+	Foldings     *big.Int
+	// Whether each base of the prefix is paired or free the same way in
+	// all optimal foldings of the prefix
+	Safe []bool
+	// The base each safe base is paired with, or -1 for free safe bases
+	// and bases that are not safe
+	SafePairs folding.FoldingPairs
+}
+
+// PrefixSafety returns the safety of each prefix of the sequence, from the
+// first base alone to the whole sequence. The optimal foldings of prefix
+// [0, k] are counted by FillArray and CountSolutions for the whole
+// sequence, so only the pairings need to be counted again for each prefix.
+// Returns ErrNotCounted if CountSolutions has not been run.
+func (p *Predictor) PrefixSafety() ([]PrefixSafety, error) {
+	return p.PrefixSafetyContext(context.Background())
+}
+
+// PrefixSafetyContext is like PrefixSafety, but stops and returns ctx.Err()
+// if ctx is cancelled before all prefixes are done. Counting the pairings
+// of each prefix takes time cubic in its length, so this takes time of the
+// fourth power of the sequence length.
+func (p *Predictor) PrefixSafetyContext(ctx context.Context) ([]PrefixSafety, error) {
+	if p.Sol == nil {
+		return nil, ErrNotCounted
+	}
+	var out []PrefixSafety
+	for numBases := 1; numBases <= len(p.Seq.Bases); numBases++ {
+		pairSafety, usedBy, err := p.countPairings(ctx, numBases)
+		if err != nil {
+			return nil, err
+		}
+		singleSafety := make([]*big.Int, numBases)
+		for i := range singleSafety {
+			singleSafety[i] = usedBy[i][i]
+		}
+		foldings := p.Sol[0][numBases-1]
+		safe, err := safetyFromCounts(pairSafety, singleSafety, foldings)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs := make(folding.FoldingPairs, numBases)
+		for i := 0; i < numBases; i++ {
+			pairs[i] = -1
+		}
+		for i := 0; i < numBases; i++ {
+			for j := i + 1; j < numBases; j++ {
+				if safe[i] && pairSafety[i][j].Sign() > 0 {
+					pairs[i], pairs[j] = j, i
+				}
+			}
+		}
+		out = append(out, PrefixSafety{
+			Length:       numBases,
+			OptimalPairs: p.V[0][numBases-1],
+			Foldings:     new(big.Int).Set(foldings),
+			Safe:         safe,
+			SafePairs:    pairs,
+		})
+	}
+	return out, nil
+}
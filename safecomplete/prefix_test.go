@@ -0,0 +1,52 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "context"
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+
+func TestPrefixSafety(t *testing.T) {
+	for _, noLP := range []bool{false, true} {
+		str := "GGGAAAUCCAAACCCUUUGGG"
+		p := &Predictor{Seq: base.SequenceFromString(str), MinHairpin: 3, NoLonelyPairs: noLP}
+		if _, err := p.PrefixSafety(); err != ErrNotCounted {
+			t.Errorf("PrefixSafety before CountSolutions: expected ErrNotCounted, got %v", err)
+		}
+		p.FillArray()
+		p.CountSolutions()
+		prefixes, err := p.PrefixSafety()
+		if err != nil {
+			t.Fatalf("PrefixSafety(%s), no lonely pairs %v: %v", str, noLP, err)
+		}
+		if len(prefixes) != len(str) {
+			t.Fatalf("PrefixSafety(%s), no lonely pairs %v: %d prefixes, expected %d", str, noLP, len(prefixes), len(str))
+		}
+
+		// Fold each prefix on its own
+		for k, ps := range prefixes {
+			q := &Predictor{Seq: base.SequenceFromString(str[:k+1]), MinHairpin: 3, NoLonelyPairs: noLP}
+			q.FillArray()
+			safe, err := q.Safety()
+			if err != nil {
+				t.Fatalf("Safety(%s): %v", str[:k+1], err)
+			}
+			if ps.Length != k+1 || ps.OptimalPairs != q.OptimalScore() || ps.Foldings.Cmp(q.CountOptimal()) != 0 || !reflect.DeepEqual(ps.Safe, safe) {
+				t.Errorf("PrefixSafety(%s), no lonely pairs %v: prefix %d bases, %d pairs, %v foldings, safety %v, expected %d bases, %d pairs, %v foldings, safety %v",
+					str, noLP, ps.Length, ps.OptimalPairs, ps.Foldings, ps.Safe, k+1, q.OptimalScore(), q.CountOptimal(), safe)
+			}
+			opt := q.Optimal()
+			for i, j := range ps.SafePairs {
+				if safe[i] && j != opt[i] || !safe[i] && j != -1 {
+					t.Errorf("PrefixSafety(%s), no lonely pairs %v: prefix %d, base %d safely paired with %d in %v, optimal folding %v", str, noLP, k+1, i, j, ps.SafePairs, opt)
+				}
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := p.PrefixSafetyContext(ctx); err != context.Canceled {
+			t.Errorf("PrefixSafetyContext with cancelled context: expected context.Canceled, got %v", err)
+		}
+	}
+}
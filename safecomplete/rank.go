@@ -0,0 +1,127 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "fmt"
+import "math/big"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// sol returns the number of optimal foldings of iv.
+func (p *Predictor) sol(iv *pair) *big.Int {
+	switch {
+	case iv.Kind == paired && iv.I >= iv.J:
+		return big.NewInt(0)
+	case iv.I > iv.J:
+		return big.NewInt(1)
+	}
+	return p.solTable(iv.Kind)[iv.I][iv.J]
+}
+
+func (p *Predictor) splitCount(s split) *big.Int {
+	c := new(big.Int).Set(p.sol(s.Pre))
+	if s.Suf != nil {
+		c.Mul(c, p.sol(s.Suf))
+	}
+	return c
+}
+
+// Unrank returns the optimal folding with index idx, where
+// 0 <= idx < Sol[0][n-1]. Returns nil if idx is out of range.
+// Requires CountSolutions to have been run, and returns nil otherwise.
+func (p *Predictor) Unrank(idx *big.Int) folding.FoldingPairs {
+	numBases := len(p.Seq.Bases)
+	if p.Sol == nil || idx.Sign() < 0 || idx.Cmp(p.Sol[0][numBases-1]) >= 0 {
+		return nil
+	}
+	f := make(folding.FoldingPairs, numBases)
+	for i := range f {
+		f[i] = -1
+	}
+	p.recursiveUnrank(&pair{I: 0, J: numBases - 1}, new(big.Int).Set(idx), f)
+	return f
+}
+
+func (p *Predictor) recursiveUnrank(iv *pair, k *big.Int, f folding.FoldingPairs) {
+	if iv.I >= iv.J {
+		return
+	}
+	for _, s := range p.findSplits(iv) {
+		c := p.splitCount(s)
+		if k.Cmp(c) >= 0 {
+			k.Sub(k, c)
+			continue
+		}
+		if s.Pair != nil {
+			f[s.Pair.I] = s.Pair.J
+			f[s.Pair.J] = s.Pair.I
+		}
+		if s.Suf != nil {
+			kp, ks := new(big.Int).DivMod(k, p.sol(s.Suf), new(big.Int))
+			p.recursiveUnrank(s.Pre, kp, f)
+			p.recursiveUnrank(s.Suf, ks, f)
+		} else {
+			p.recursiveUnrank(s.Pre, k, f)
+		}
+		return
+	}
+}
+
+// Rank returns the index of folding f among optimal foldings, so that
+// Unrank(Rank(f)) equals f. Returns an error if f is not an optimal folding.
+// Requires CountSolutions to have been run, and returns ErrNotCounted
+// otherwise.
+func (p *Predictor) Rank(f folding.FoldingPairs) (*big.Int, error) {
+	if p.Sol == nil {
+		return nil, ErrNotCounted
+	}
+	if len(f) != len(p.Seq.Bases) {
+		return nil, &LengthError{Folding: len(f), Bases: len(p.Seq.Bases)}
+	}
+	return p.recursiveRank(&pair{I: 0, J: len(f) - 1}, f)
+}
+
+func (p *Predictor) recursiveRank(iv *pair, f folding.FoldingPairs) (*big.Int, error) {
+	i, j := iv.I, iv.J
+	if i > j {
+		return new(big.Int), nil
+	}
+	if i == j {
+		if f[i] >= 0 {
+			return nil, &NotOptimalError{fmt.Sprintf("base %d is paired with %d, but is unpaired in all optimal foldings", i, f[i])}
+		}
+		return new(big.Int), nil
+	}
+	if f[j] >= 0 && (f[j] < i || f[j] > j) {
+		return nil, &NotOptimalError{fmt.Sprintf("base %d is paired with %d outside interval [%d, %d]", j, f[j], i, j)}
+	}
+
+	offset := new(big.Int)
+	for _, s := range p.findSplits(iv) {
+		followed := false
+		if s.Pair != nil {
+			followed = f[s.Pair.I] == s.Pair.J
+		} else {
+			followed = f[j] < 0
+		}
+		if !followed {
+			offset.Add(offset, p.splitCount(s))
+			continue
+		}
+		pre, err := p.recursiveRank(s.Pre, f)
+		if err != nil {
+			return nil, err
+		}
+		if s.Suf != nil {
+			suf, err := p.recursiveRank(s.Suf, f)
+			if err != nil {
+				return nil, err
+			}
+			pre.Mul(pre, p.sol(s.Suf))
+			pre.Add(pre, suf)
+		}
+		return offset.Add(offset, pre), nil
+	}
+	if f[j] < 0 {
+		return nil, &NotOptimalError{fmt.Sprintf("base %d is unpaired, but no optimal folding of [%d, %d] leaves it unpaired", j, i, j)}
+	}
+	return nil, &NotOptimalError{fmt.Sprintf("pair (%d, %d) is not in any optimal folding of [%d, %d]", f[j], j, i, j)}
+}
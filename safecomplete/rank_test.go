@@ -0,0 +1,81 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "math/big"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func foldingSetsEqual(t *testing.T, a, b folding.FoldingSet) bool {
+	equal, err := folding.FoldingSetsEqual(a, b)
+	if err != nil {
+		t.Errorf("FoldingSetsEqual: %v", err)
+	}
+	return equal
+}
+
+func TestRankUnrank(t *testing.T) {
+	tests := []string{
+		"GGGAAAUCC",
+		"GGGAAACCCAAAGGGAAACCC",
+		"GCGGAUUUAGCUCAGUUGGGAGAGCGCCAGACUGAA",
+	}
+	for _, tt := range tests {
+		seq := base.SequenceFromString(tt)
+		p := &Predictor{Seq: seq, MinHairpin: 3}
+		p.FillArray()
+		p.CountSolutions()
+		total := p.Sol[0][len(seq.Bases)-1]
+
+		var all folding.FoldingSet
+		for k := int64(0); k < total.Int64(); k++ {
+			f := p.Unrank(big.NewInt(k))
+			if f == nil {
+				t.Fatalf("Unrank(%s, %d): got nil", tt, k)
+			}
+			r, err := p.Rank(f)
+			if err != nil {
+				t.Errorf("Rank(%s, %v): unexpected error %v", tt, f, err)
+			} else if r.Cmp(big.NewInt(k)) != 0 {
+				t.Errorf("Rank(%s, Unrank(%d)): got %v", tt, k, r)
+			}
+			all = append(all, f)
+		}
+		if expected := p.BacktrackFolding().GeneratePairArrays(seq); !foldingSetsEqual(t, all, expected) {
+			t.Errorf("Unrank(%s): foldings differ from BacktrackFolding", tt)
+		}
+		if f := p.Unrank(total); f != nil {
+			t.Errorf("Unrank(%s, %v): expected nil, got %v", tt, total, f)
+		}
+	}
+}
+
+func TestRankNotOptimal(t *testing.T) {
+	seq := base.SequenceFromString("GGGAAAUCC")
+	p := &Predictor{Seq: seq, MinHairpin: 3}
+	p.FillArray()
+	p.CountSolutions()
+	tests := []struct {
+		f      folding.FoldingPairs
+		length bool
+	}{
+		{folding.FoldingPairs{-1, -1, -1, -1, -1, -1, -1, -1, -1}, false},
+		{folding.FoldingPairs{-1, 7, 6, -1, -1, -1, 2, 1, -1}, false},
+		{folding.FoldingPairs{8, 7, 6, -1, -1, -1, 2, 1}, true},
+	}
+	for _, tt := range tests {
+		r, err := p.Rank(tt.f)
+		switch err.(type) {
+		case *NotOptimalError:
+			if tt.length {
+				t.Errorf("Rank(%v): expected LengthError, got %v", tt.f, err)
+			}
+		case *LengthError:
+			if !tt.length {
+				t.Errorf("Rank(%v): expected NotOptimalError, got %v", tt.f, err)
+			}
+		default:
+			t.Errorf("Rank(%v): expected error, got %v, %v", tt.f, r, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
+
+import "context"
+import "math/big"
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// bruteForce returns the foldings of p.Seq with the most pairs allowed by
+// the rules of p, listing all foldings.
+func bruteForce(p *Predictor) (folding.FoldingSet, int) {
+	n := len(p.Seq.Bases)
+	f := make(folding.FoldingPairs, n)
+	for i := range f {
+		f[i] = -1
+	}
+	var out folding.FoldingSet
+	best := 0
+	var rec func(i, pairs int)
+	rec = func(i, pairs int) {
+		if i == n {
+			for k := range f {
+				if p.NoLonelyPairs && folding.Lonely(f, k) {
+					return
+				}
+			}
+			if pairs > best {
+				best, out = pairs, nil
+			}
+			if pairs == best {
+				out = append(out, append(folding.FoldingPairs(nil), f...))
+			}
+			return
+		}
+		if f[i] >= 0 {
+			rec(i+1, pairs)
+			return
+		}
+		rec(i+1, pairs)
+		for j := i + 1; j < n; j++ {
+			if f[j] >= 0 {
+				// Pairs beyond j would cross the pair of j
+				break
+			}
+			if p.canPair(i, j) {
+				f[i], f[j] = j, i
+				rec(i+1, pairs+1)
+				f[i], f[j] = -1, -1
+			}
+		}
+	}
+	rec(0, 0)
+	return out, best
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		seq     string
+		maxSpan int
+		noLP    bool
+	}{
+		{"GGGAAAUCCAAACCCUUUGGG", 0, true},
+		{"GGGAAAUCCAAACCCUUUGGG", 8, false},
+		{"GGGAAAUCCAAACCCUUUGGG", 10, true},
+		{"GCGCAAAGCAAAGCGCAAAGCGC", 0, true},
+		{"ACGUACGUACGUACGUACGU", 0, true},
+		{"ACGUACGUACGUACGUACGU", 7, true},
+		{"GAAAAC", 0, true},
+	}
+	for _, tt := range tests {
+		p := &Predictor{Seq: base.SequenceFromString(tt.seq), MinHairpin: 3, MaxSpan: tt.maxSpan, NoLonelyPairs: tt.noLP}
+		all, optimal := bruteForce(p)
+		p.FillArray()
+		p.CountSolutions()
+		n := len(tt.seq)
+		if p.OptimalScore() != optimal {
+			t.Errorf("%s, span %d, no lonely pairs %v: optimal score %d, expected %d", tt.seq, tt.maxSpan, tt.noLP, p.OptimalScore(), optimal)
+			continue
+		}
+		if p.Sol[0][n-1].Cmp(big.NewInt(int64(len(all)))) != 0 {
+			t.Errorf("%s, span %d, no lonely pairs %v: %v foldings, expected %d", tt.seq, tt.maxSpan, tt.noLP, p.Sol[0][n-1], len(all))
+		}
+
+		ff, err := p.OptimalFoldings(context.Background())
+		if err != nil {
+			t.Fatalf("OptimalFoldings: %v", err)
+		}
+		if equal, err := folding.FoldingSetsEqual(ff, all); err != nil || !equal || len(ff) != len(all) {
+			t.Errorf("%s, span %d, no lonely pairs %v: folding tree has %d foldings, different from %d expected", tt.seq, tt.maxSpan, tt.noLP, len(ff), len(all))
+		}
+
+		if err := p.CountPairings(); err != nil {
+			t.Fatalf("CountPairings: %v", err)
+		}
+		pairCounts := p.PairSafety
+		singleCounts := p.SingleSafety
+		if err := p.BacktrackSafety(); err != nil {
+			t.Fatalf("BacktrackSafety: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			free := 0
+			for _, f := range all {
+				if f[i] < 0 {
+					free++
+				}
+			}
+			if singleCounts[i].Cmp(big.NewInt(int64(free))) != 0 || p.SingleSafety[i].Cmp(big.NewInt(int64(free))) != 0 {
+				t.Errorf("%s, span %d, no lonely pairs %v: base %d free in %v and %v foldings, expected %d",
+					tt.seq, tt.maxSpan, tt.noLP, i, singleCounts[i], p.SingleSafety[i], free)
+			}
+			for j := i + 1; j < n; j++ {
+				paired := 0
+				for _, f := range all {
+					if f[i] == j {
+						paired++
+					}
+				}
+				if pairCounts[i][j].Cmp(big.NewInt(int64(paired))) != 0 || p.PairSafety[i][j].Cmp(big.NewInt(int64(paired))) != 0 {
+					t.Errorf("%s, span %d, no lonely pairs %v: pair (%d, %d) in %v and %v foldings, expected %d",
+						tt.seq, tt.maxSpan, tt.noLP, i, j, pairCounts[i][j], p.PairSafety[i][j], paired)
+				}
+			}
+		}
+
+		for _, f := range all {
+			idx, err := p.Rank(f)
+			if err != nil {
+				t.Errorf("%s, span %d, no lonely pairs %v: Rank(%v): %v", tt.seq, tt.maxSpan, tt.noLP, f, err)
+				continue
+			}
+			if g := p.Unrank(idx); !reflect.DeepEqual(f, g) {
+				t.Errorf("%s, span %d, no lonely pairs %v: Unrank(Rank(%v)) = %v", tt.seq, tt.maxSpan, tt.noLP, f, g)
+			}
+			if m, err := p.Membership(f); err != nil || !m.Optimal {
+				t.Errorf("%s, span %d, no lonely pairs %v: Membership(%v) = %v, %v", tt.seq, tt.maxSpan, tt.noLP, f, m, err)
+			}
+		}
+		total := new(big.Int)
+		for _, c := range p.DistanceHistogram(all[0]) {
+			total.Add(total, c)
+		}
+		if total.Cmp(p.Sol[0][n-1]) != 0 {
+			t.Errorf("%s, span %d, no lonely pairs %v: distance histogram of %v foldings, expected %v", tt.seq, tt.maxSpan, tt.noLP, total, p.Sol[0][n-1])
+		}
+	}
+}
+
+func TestMembershipRules(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCCAAACCCUUUGGG"), MinHairpin: 3, MaxSpan: 12, NoLonelyPairs: true}
+	p.FillArray()
+	// (0, 20) spans too far, which leaves (1, 19) lonely
+	f := folding.FoldingPairs{20, 19, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 1, 0}
+	m, err := p.Membership(f)
+	if err != nil {
+		t.Fatalf("Membership: %v", err)
+	}
+	if len(m.Invalid) != 2 || m.Optimal {
+		t.Errorf("Membership(%v): expected 2 invalid pairs, got %v", f, m)
+	}
+	loss := 0
+	for _, d := range m.Deviations {
+		loss += d.Loss
+	}
+	if loss != m.OptimalPairs {
+		t.Errorf("Membership(%v): losses add up to %d, expected %d", f, loss, m.OptimalPairs)
+	}
+}
@@ -14,11 +14,36 @@ type Predictor struct {
 	SingleSafety []*big.Int
 
 	MinHairpin int
+	// Largest allowed j - i of a pair (i, j), or 0 for no limit
+	MaxSpan int
+	// Whether every pair must stack on another pair
+	NoLonelyPairs bool
+
+	// Optimal pairs and counts of paired and inside intervals, only used
+	// with NoLonelyPairs. Paired intervals that cannot pair have -1 pairs.
+	s, x       [][]int
+	solS, solX [][]*big.Int
 }
 
+// kind tells which foldings of an interval are meant. Without lonely
+// pairs, a pair may form only if it stacks on another pair, so the
+// foldings of an interval depend on the pair enclosing it.
+type kind int
+
+const (
+	// Any folding, the interval is not directly enclosed by a pair
+	plain kind = iota
+	// I and J pair with each other, stacking on the enclosing pair
+	paired
+	// The interval is directly enclosed by the pair (I-1, J+1), so
+	// (I, J) may pair without a pair stacking inside it
+	inside
+)
+
 type pair struct {
-	I int
-	J int
+	I    int
+	J    int
+	Kind kind
 }
 
 type split struct {
@@ -27,19 +52,75 @@ type split struct {
 	Pair *pair
 }
 
-func (p *Predictor) findSplits(i, j int) []split {
+func (p *Predictor) canPair(i, j int) bool {
+	return (p.MaxSpan == 0 || j-i <= p.MaxSpan) && p.Seq.CanPair(i, j, p.MinHairpin)
+}
+
+// kinds returns the kinds of intervals used by the folding rules.
+func (p *Predictor) kinds() []kind {
+	if p.NoLonelyPairs {
+		return []kind{plain, paired, inside}
+	}
+	return []kind{plain}
+}
+
+// newPair returns the interval [i, j] of kind k. Empty and single base
+// intervals are the same for plain and inside kinds, so they are plain.
+func newPair(i, j int, k kind) *pair {
+	if i >= j && k == inside {
+		k = plain
+	}
+	return &pair{i, j, k}
+}
+
+// pairInside returns the inside of pair (i, j) formed in interval iv.
+func (p *Predictor) pairInside(iv *pair, i, j int) *pair {
+	switch {
+	case !p.NoLonelyPairs:
+		return newPair(i+1, j-1, plain)
+	case iv.Kind != plain && i == iv.I:
+		return newPair(i+1, j-1, inside)
+	}
+	return newPair(i+1, j-1, paired)
+}
+
+// value returns the number of pairs in optimal foldings of iv, or -1 if
+// iv has no foldings.
+func (p *Predictor) value(iv *pair) int {
+	switch {
+	case iv.Kind == paired && iv.I >= iv.J:
+		return -1
+	case iv.I > iv.J:
+		return 0
+	case iv.Kind == paired:
+		return p.s[iv.I][iv.J]
+	case iv.Kind == inside:
+		return p.x[iv.I][iv.J]
+	}
+	return p.V[iv.I][iv.J]
+}
+
+func (p *Predictor) findSplits(iv *pair) []split {
 	var ret []split
+	i, j := iv.I, iv.J
+	best := p.value(iv)
 
-	if p.Seq.CanPair(i, j, p.MinHairpin) && p.V[i][j] == p.V[i+1][j-1]+1 {
-		ret = append(ret, split{&pair{i + 1, j - 1}, nil, &pair{i, j}})
+	if p.canPair(i, j) {
+		in := p.pairInside(iv, i, j)
+		if v := p.value(in); v >= 0 && best == v+1 {
+			ret = append(ret, split{in, nil, &pair{I: i, J: j}})
+		}
+	}
+	if iv.Kind == paired {
+		return ret
 	}
 	for k := i; k < j; k++ {
-		if p.V[i][j] == p.V[i][k]+p.W[k+1][j] && p.W[k+1][j] > 0 {
-			ret = append(ret, split{&pair{i, k}, &pair{k + 2, j - 1}, &pair{k + 1, j}})
+		if best == p.V[i][k]+p.W[k+1][j] && p.W[k+1][j] > 0 {
+			ret = append(ret, split{&pair{I: i, J: k}, p.pairInside(iv, k+1, j), &pair{I: k + 1, J: j}})
 		}
 	}
-	if p.V[i][j] == p.V[i][j-1] {
-		ret = append(ret, split{&pair{i, j - 1}, &pair{j, j}, nil})
+	if best == p.V[i][j-1] {
+		ret = append(ret, split{&pair{I: i, J: j - 1}, &pair{I: j, J: j}, nil})
 	}
 
 	return ret
@@ -1,6 +1,6 @@
 package safecomplete /* import "keltainen.duckdns.org/rnafolding/safecomplete" */
 
-import "log"
+import "context"
 import "math/big"
 
 import "keltainen.duckdns.org/rnafolding/folding"
@@ -22,12 +22,22 @@ func TrivialSafety(foldings folding.FoldingSet) []bool {
 }
 
 func (p *Predictor) IteratedTrivialSafety(folds *types.FoldTree) []bool {
+	out, _ := p.IteratedTrivialSafetyContext(context.Background(), folds)
+	return out
+}
+
+// IteratedTrivialSafetyContext is like IteratedTrivialSafety, but stops
+// and returns ctx.Err() if ctx is cancelled before all foldings have been
+// compared.
+func (p *Predictor) IteratedTrivialSafetyContext(ctx context.Context, folds *types.FoldTree) ([]bool, error) {
 	out := make([]bool, len(p.Seq.Bases))
 	for i := 0; i < len(out); i++ {
 		out[i] = true
 	}
 	var ref folding.FoldingPairs
-	for f := range folds.PairArrayIterator(p.Seq) {
+	it := folds.Iterate(ctx, len(p.Seq.Bases))
+	for it.Next() {
+		f := it.Folding()
 		if ref == nil {
 			ref = f
 		} else {
@@ -38,36 +48,50 @@ func (p *Predictor) IteratedTrivialSafety(folds *types.FoldTree) []bool {
 			}
 		}
 	}
-	return out
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (p *Predictor) SafetyFromBacktrack() []bool {
-	out := make([]bool, len(p.Seq.Bases))
-	max := p.Sol[0][len(p.Seq.Bases)-1]
+// SafetyFromBacktrack tells which bases are paired or free the same way in
+// all optimal foldings. Requires CountPairings or BacktrackSafety to have
+// been run, and returns ErrNotCounted otherwise.
+func (p *Predictor) SafetyFromBacktrack() ([]bool, error) {
+	if p.Sol == nil || p.PairSafety == nil || p.SingleSafety == nil {
+		return nil, ErrNotCounted
+	}
+	return safetyFromCounts(p.PairSafety, p.SingleSafety, p.Sol[0][len(p.Seq.Bases)-1])
+}
+
+// safetyFromCounts tells which bases are safe, given in how many of the
+// max optimal foldings each pair is formed and each base is free.
+func safetyFromCounts(pairSafety [][]*big.Int, singleSafety []*big.Int, max *big.Int) ([]bool, error) {
+	out := make([]bool, len(singleSafety))
 	for i := 0; i < len(out); i++ {
-		sum := new(big.Int).Set(p.SingleSafety[i])
+		sum := new(big.Int).Set(singleSafety[i])
 		numPairings := 0
 		for j := 0; j < i; j++ {
-			if p.PairSafety[j][i].Cmp(new(big.Int)) > 0 {
+			if pairSafety[j][i].Cmp(new(big.Int)) > 0 {
 				numPairings++
-				sum.Add(sum, p.PairSafety[j][i])
+				sum.Add(sum, pairSafety[j][i])
 			}
 		}
 		for j := i + 1; j < len(out); j++ {
-			if p.PairSafety[i][j].Cmp(new(big.Int)) > 0 {
+			if pairSafety[i][j].Cmp(new(big.Int)) > 0 {
 				numPairings++
-				sum.Add(sum, p.PairSafety[i][j])
+				sum.Add(sum, pairSafety[i][j])
 			}
 		}
 		if sum.Cmp(max) != 0 {
-			log.Printf("SafetyFromBacktrack: base %d is in %d solutions, expected %d", i, sum, max)
+			return nil, &SafetyError{Base: i, Count: sum, Total: max}
 		}
-		if (p.SingleSafety[i].Cmp(new(big.Int)) == 0 && numPairings == 1) ||
-			(p.SingleSafety[i].Cmp(new(big.Int)) > 0 && numPairings == 0) {
+		if (singleSafety[i].Cmp(new(big.Int)) == 0 && numPairings == 1) ||
+			(singleSafety[i].Cmp(new(big.Int)) > 0 && numPairings == 0) {
 			out[i] = true
 		} else {
 			out[i] = false
 		}
 	}
-	return out
+	return out, nil
 }
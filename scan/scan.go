@@ -0,0 +1,135 @@
+package main /* import "keltainen.duckdns.org/rnafolding/scan" */
+
+import "bufio"
+import "context"
+import "flag"
+import "fmt"
+import "io"
+import "log"
+import "os"
+import "strconv"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/fasta"
+import "keltainen.duckdns.org/rnafolding/pipeline"
+
+var (
+	infile     = flag.String("in", "", "Name of input file in multi-FASTA format")
+	window     = flag.Int("window", 150, "Number of bases in each folded window")
+	step       = flag.Int("step", 10, "Distance between the starts of consecutive windows")
+	minhairpin = flag.Int("minhairpin", 3, "Minimum number of free bases in hairpin loop")
+	maxspan    = flag.Int("maxspan", 0, "Maximum distance j-i of paired bases i and j within a window. Zero does not limit")
+	nolp       = flag.Bool("nolp", false, "Allow only pairs that stack on another pair")
+	out        = flag.String("out", "", "Write tracks to files with given prefix instead of standard output")
+	timeout    = flag.Duration("timeout", 0, "Abort scan of a sequence after given time, for example 10m. Zero does not limit")
+)
+
+// track is one bedGraph track, with a value for each base of a profile.
+type track struct {
+	name        string
+	description string
+	value       func(p *pipeline.ScanProfile, i int) float64
+}
+
+var tracks = []track{
+	{"safe", "Fraction of windows in which base is safe", (*pipeline.ScanProfile).SafeFraction},
+	{"safe-paired", "Fraction of windows in which base is safe and paired", (*pipeline.ScanProfile).SafePairedFraction},
+	{"safe-unpaired", "Fraction of windows in which base is safe and unpaired", (*pipeline.ScanProfile).SafeUnpairedFraction},
+}
+
+func main() {
+	flag.Parse()
+
+	if *infile == "" {
+		fmt.Print("Please set the input file with --in flag")
+		return
+	}
+
+	opts := pipeline.DefaultScanOptions()
+	opts.Rules.MinHairpin = *minhairpin
+	opts.Rules.MaxSpan = *maxspan
+	opts.Rules.NoLonelyPairs = *nolp
+	opts.Window = *window
+	opts.Step = *step
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+
+	var profiles []*pipeline.ScanProfile
+	seqs, err := fasta.ReadMultiSequenceFile(*infile)
+	// Reference foldings are not used, so invalid ones do not matter
+	if _, ok := err.(fasta.FoldingErrors); err != nil && !ok {
+		log.Fatalf("Error reading FASTA format file \"%s\": %v", *infile, err)
+	}
+	for _, seq := range seqs {
+		prof, err := scan(seq, opts)
+		if err != nil {
+			log.Printf("Scan of %s failed: %v", seq.Name, err)
+			continue
+		}
+		profiles = append(profiles, prof)
+	}
+
+	if *out == "" {
+		w := bufio.NewWriter(os.Stdout)
+		for _, t := range tracks {
+			writeTrack(w, t, profiles)
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatalf("Failed to write tracks: %v", err)
+		}
+		return
+	}
+	for _, t := range tracks {
+		fname := *out + "-" + t.name + ".bedgraph"
+		if err := writeTrackFile(fname, t, profiles); err != nil {
+			log.Fatalf("Failed to write track %s: %v", fname, err)
+		}
+	}
+}
+
+// scanContext returns the context for scanning one sequence, limited by
+// the -timeout flag.
+func scanContext() (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(context.Background(), *timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func scan(seq *base.Sequence, opts pipeline.ScanOptions) (*pipeline.ScanProfile, error) {
+	ctx, cancel := scanContext()
+	defer cancel()
+	return pipeline.Scan(ctx, seq, opts)
+}
+
+func writeTrackFile(fname string, t track, profiles []*pipeline.ScanProfile) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	writeTrack(w, t, profiles)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeTrack writes the track in bedGraph format, with zero-based
+// half-open intervals. Consecutive bases with the same value are joined
+// into one interval.
+func writeTrack(w io.Writer, t track, profiles []*pipeline.ScanProfile) {
+	fmt.Fprintf(w, "track type=bedGraph name=%q description=%q\n", t.name, t.description)
+	for _, p := range profiles {
+		start := 0
+		for i := 1; i <= len(p.Windows); i++ {
+			if i < len(p.Windows) && t.value(p, i) == t.value(p, start) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", p.Name, start, i, strconv.FormatFloat(t.value(p, start), 'g', 4, 64))
+			start = i
+		}
+	}
+}
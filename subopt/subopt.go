@@ -0,0 +1,292 @@
+// Package subopt reads the output of ViennaRNA RNAsubopt and RNAfold
+// programs.
+package subopt /* import "keltainen.duckdns.org/rnafolding/subopt" */
+
+import "bufio"
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/fasta"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+type Kind int
+
+const (
+	// Structure listed by RNAsubopt
+	Suboptimal Kind = iota
+	// Minimum free energy structure from RNAfold
+	MFE
+	// Ensemble pseudo-structure from RNAfold -p, has no Folding
+	Ensemble
+	// Centroid structure from RNAfold -p
+	Centroid
+	// Maximum expected accuracy structure from RNAfold --MEA
+	MEA
+)
+
+type Structure struct {
+	Kind       Kind
+	DotBracket string
+	Folding    folding.FoldingPairs
+	Energy     float64
+	// Distance of centroid structure to ensemble, or MEA value of MEA structure
+	Extra float64
+}
+
+type Record struct {
+	Seq *base.Sequence
+	// Minimum free energy and energy range from RNAsubopt header line
+	MFE         float64
+	Delta       float64
+	HasEnergies bool
+
+	Structures []*Structure
+
+	// From RNAfold -p
+	MFEFrequency       float64
+	EnsembleDiversity  float64
+	HasEnsembleSummary bool
+}
+
+// Foldings returns the foldings of all structures except the ensemble
+// pseudo-structure.
+func (r *Record) Foldings() folding.FoldingSet {
+	var ff folding.FoldingSet
+	for _, s := range r.Structures {
+		if s.Folding != nil {
+			ff = append(ff, s.Folding)
+		}
+	}
+	return ff
+}
+
+// Energies returns energies of structures in the same order as Foldings.
+func (r *Record) Energies() []float64 {
+	var ee []float64
+	for _, s := range r.Structures {
+		if s.Folding != nil {
+			ee = append(ee, s.Energy)
+		}
+	}
+	return ee
+}
+
+// Reader reads records one structure at a time, so that outputs with
+// large numbers of structures need not be kept in memory.
+type Reader struct {
+	br     *bufio.Reader
+	line   string
+	peeked bool
+	err    error
+	rec    *Record
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(r)}
+}
+
+func (r *Reader) peek() (string, error) {
+	if !r.peeked {
+		line, err := r.br.ReadString('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		r.line = strings.TrimRight(line, "\r\n")
+		r.err = err
+		r.peeked = true
+	}
+	return r.line, r.err
+}
+
+func (r *Reader) consume() {
+	r.peeked = false
+}
+
+func isStructureLine(l string) bool {
+	return len(l) > 0 && strings.ContainsRune(".,|{}()[]", rune(l[0]))
+}
+
+const frequencyPrefix = "frequency of mfe structure in ensemble"
+
+// NextRecord skips any remaining structures of the current record and
+// reads the header of next record. Returns io.EOF when there are no more
+// records.
+func (r *Reader) NextRecord() (*Record, error) {
+	for {
+		if _, err := r.NextStructure(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var line string
+	var err error
+	for {
+		line, err = r.peek()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+		r.consume()
+	}
+
+	rec := &Record{Seq: &base.Sequence{}}
+	if line[0] == '>' {
+		rec.Seq.Comment = strings.TrimSpace(line[1:])
+		rec.Seq.Name = strings.SplitN(rec.Seq.Comment, " ", 2)[0]
+		r.consume()
+		line, err = r.peek()
+		if err == io.EOF {
+			return nil, fmt.Errorf("record %q has no sequence", rec.Seq.Name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if isStructureLine(line) {
+		return nil, fmt.Errorf("expected sequence line, got %q", line)
+	}
+	r.consume()
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("record %q has no sequence", rec.Seq.Name)
+	}
+	rec.Seq.Bases = base.SequenceFromString(fields[0]).Bases
+	if len(fields) >= 3 {
+		if rec.MFE, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return nil, fmt.Errorf("invalid minimum free energy in %q: %v", line, err)
+		}
+		if rec.Delta, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return nil, fmt.Errorf("invalid energy range in %q: %v", line, err)
+		}
+		rec.HasEnergies = true
+	}
+	r.rec = rec
+	return rec, nil
+}
+
+// NextStructure reads the next structure of current record, and also adds
+// it to the ensemble summary of the record if it comes from RNAfold -p.
+// Returns io.EOF at the end of the record.
+func (r *Reader) NextStructure() (*Structure, error) {
+	for {
+		line, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, frequencyPrefix) {
+			r.consume()
+			if r.rec != nil {
+				if err := parseFrequency(r.rec, trimmed); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if !isStructureLine(line) || r.rec == nil {
+			return nil, io.EOF
+		}
+		r.consume()
+		s, err := parseStructure(line)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.DotBracket) != len(r.rec.Seq.Bases) {
+			return nil, fmt.Errorf("structure of %d bases for sequence of %d bases: %q",
+				len(s.DotBracket), len(r.rec.Seq.Bases), line)
+		}
+		return s, nil
+	}
+}
+
+func parseStructure(line string) (*Structure, error) {
+	fields := strings.SplitN(line, " ", 2)
+	s := &Structure{DotBracket: fields[0]}
+	rest := ""
+	if len(fields) > 1 {
+		rest = strings.TrimSpace(fields[1])
+	}
+	if len(rest) > 0 {
+		switch rest[0] {
+		case '(':
+			s.Kind = MFE
+		case '[':
+			s.Kind = Ensemble
+		case '{':
+			s.Kind = Centroid
+			if strings.Contains(rest, "MEA=") {
+				s.Kind = MEA
+			}
+		}
+		vals := strings.Fields(strings.Trim(rest, "()[]{}"))
+		if len(vals) == 0 {
+			return nil, fmt.Errorf("invalid energy in %q", line)
+		}
+		var err error
+		if s.Energy, err = strconv.ParseFloat(vals[0], 64); err != nil {
+			return nil, fmt.Errorf("invalid energy in %q: %v", line, err)
+		}
+		if len(vals) > 1 && (strings.HasPrefix(vals[1], "d=") || strings.HasPrefix(vals[1], "MEA=")) {
+			extra := vals[1][strings.Index(vals[1], "=")+1:]
+			if s.Extra, err = strconv.ParseFloat(extra, 64); err != nil {
+				return nil, fmt.Errorf("invalid value in %q: %v", line, err)
+			}
+		}
+	}
+	if s.Kind != Ensemble {
+		var err error
+		if s.Folding, err = fasta.DbToFold(s.DotBracket); err != nil {
+			return nil, fmt.Errorf("invalid structure %q: %v", line, err)
+		}
+	}
+	return s, nil
+}
+
+func parseFrequency(rec *Record, line string) error {
+	// frequency of mfe structure in ensemble 0.123; ensemble diversity 4.56
+	parts := strings.Split(strings.TrimPrefix(line, frequencyPrefix), ";")
+	f, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid frequency in %q: %v", line, err)
+	}
+	rec.MFEFrequency = f
+	if len(parts) > 1 {
+		div := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(parts[1]), "ensemble diversity"))
+		if rec.EnsembleDiversity, err = strconv.ParseFloat(div, 64); err != nil {
+			return fmt.Errorf("invalid ensemble diversity in %q: %v", line, err)
+		}
+	}
+	rec.HasEnsembleSummary = true
+	return nil
+}
+
+// ReadAll reads all records with their structures.
+func ReadAll(rd io.Reader) ([]*Record, error) {
+	r := NewReader(rd)
+	var ret []*Record
+	for {
+		rec, err := r.NextRecord()
+		if err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return ret, err
+		}
+		for {
+			s, err := r.NextStructure()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return ret, err
+			}
+			rec.Structures = append(rec.Structures, s)
+		}
+		ret = append(ret, rec)
+	}
+}
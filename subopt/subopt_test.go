@@ -0,0 +1,119 @@
+package subopt /* import "keltainen.duckdns.org/rnafolding/subopt" */
+
+import "reflect"
+import "strings"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func TestReadAllRNAsubopt(t *testing.T) {
+	input := `> first sequence
+GGGAAAUCC  -1.20   1.00
+(((...))) -1.20
+.((...)). -0.50
+> second
+GGGAAACCC  -2.10   0.00
+(((...))) -2.10
+`
+	recs, err := ReadAll(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadAll: unexpected error %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("ReadAll: expected 2 records, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.Seq.Name != "first" || r.Seq.BasesString() != "GGGAAAUCC" || r.MFE != -1.2 || r.Delta != 1 || !r.HasEnergies {
+		t.Errorf("ReadAll: unexpected first record header %+v %+v", r, r.Seq)
+	}
+	expected := folding.FoldingSet{
+		{8, 7, 6, -1, -1, -1, 2, 1, 0},
+		{-1, 7, 6, -1, -1, -1, 2, 1, -1},
+	}
+	if !reflect.DeepEqual(r.Foldings(), expected) {
+		t.Errorf("ReadAll: expected foldings %v, got %v", expected, r.Foldings())
+	}
+	if !reflect.DeepEqual(r.Energies(), []float64{-1.2, -0.5}) {
+		t.Errorf("ReadAll: expected energies [-1.2 -0.5], got %v", r.Energies())
+	}
+	if recs[1].Seq.Name != "second" || len(recs[1].Structures) != 1 {
+		t.Errorf("ReadAll: unexpected second record %+v", recs[1])
+	}
+}
+
+func TestReadAllRNAfold(t *testing.T) {
+	input := `>seq
+GGGAAAUCC
+(((...))) ( -1.20)
+(((,..}}, [ -1.55]
+(((...))) { -1.20 d=0.87}
+.((...)). { -0.50 MEA=6.50}
+ frequency of mfe structure in ensemble 0.453; ensemble diversity 1.20  
+GGGAAACCC
+(((...))) (-2.10)
+`
+	recs, err := ReadAll(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadAll: unexpected error %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("ReadAll: expected 2 records, got %d", len(recs))
+	}
+	r := recs[0]
+	kinds := []Kind{MFE, Ensemble, Centroid, MEA}
+	extras := []float64{0, 0, 0.87, 6.5}
+	energies := []float64{-1.2, -1.55, -1.2, -0.5}
+	if len(r.Structures) != len(kinds) {
+		t.Fatalf("ReadAll: expected %d structures, got %d", len(kinds), len(r.Structures))
+	}
+	for i, s := range r.Structures {
+		if s.Kind != kinds[i] || s.Extra != extras[i] || s.Energy != energies[i] {
+			t.Errorf("ReadAll: structure %d: expected kind %v energy %v extra %v, got %+v",
+				i, kinds[i], energies[i], extras[i], s)
+		}
+	}
+	if r.Structures[1].Folding != nil {
+		t.Errorf("ReadAll: ensemble pseudo-structure should not have folding, got %v", r.Structures[1].Folding)
+	}
+	if len(r.Foldings()) != 3 {
+		t.Errorf("ReadAll: expected 3 foldings, got %d", len(r.Foldings()))
+	}
+	if r.HasEnergies || !r.HasEnsembleSummary || r.MFEFrequency != 0.453 || r.EnsembleDiversity != 1.2 {
+		t.Errorf("ReadAll: unexpected ensemble summary %+v", r)
+	}
+	if recs[1].Seq.Name != "" || recs[1].Structures[0].Energy != -2.1 || recs[1].Structures[0].Kind != MFE {
+		t.Errorf("ReadAll: unexpected second record %+v", recs[1])
+	}
+}
+
+func TestReadAllErrors(t *testing.T) {
+	tests := []string{
+		"(((...)))\n",
+		">name\nGGGAAAUCC\n((...)) -1.0\n",
+		"GGGAAAUCC x 1.0\n",
+		"GGGAAAUCC\n(((...))) foo\n",
+		">x\nGGGAAACCC\n(((...))) ()\n",
+		">x\nGGGAAACCC\n(((...))) (\n",
+		">x\n\nGGGAAACCC\n",
+	}
+	for _, tt := range tests {
+		if _, err := ReadAll(strings.NewReader(tt)); err == nil {
+			t.Errorf("ReadAll(%q): expected error, got nil", tt)
+		}
+	}
+}
+
+func TestNextRecordSkipsStructures(t *testing.T) {
+	r := NewReader(strings.NewReader(">a\nGGGAAAUCC -1.2 1.0\n(((...))) -1.20\n.((...)). -0.50\n>b\nAU 0.0 0.0\n.. 0.00\n"))
+	if _, err := r.NextRecord(); err != nil {
+		t.Fatalf("NextRecord: unexpected error %v", err)
+	}
+	rec, err := r.NextRecord()
+	if err != nil {
+		t.Fatalf("NextRecord: unexpected error %v", err)
+	}
+	if rec.Seq.Name != "b" || !reflect.DeepEqual(rec.Seq.Bases, []base.Base{base.A, base.U}) {
+		t.Errorf("NextRecord: expected record b, got %+v", rec.Seq)
+	}
+}
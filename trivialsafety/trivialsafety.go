@@ -1,115 +1,260 @@
 package main /* import "keltainen.duckdns.org/rnafolding/trivialsafety" */
 
-import "bufio"
-import "io"
 import "encoding/json"
 import "flag"
+import "io"
 import "log"
+import "math"
 import "os"
+import "path"
+import "sort"
+import "strconv"
 import "strings"
 
+import "keltainen.duckdns.org/rnafolding/base"
 import "keltainen.duckdns.org/rnafolding/fasta"
 import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/plot"
+import "keltainen.duckdns.org/rnafolding/subopt"
 
 var (
-	maxnum = flag.Int("num", 0, "Stop reading more input if this many foldings have been read. Zero disables.")
+	maxnum = flag.Int("num", 0, "Read at most this many foldings of each sequence, ignoring the rest. Zero disables.")
+	bands  = flag.String("bands", "", "Comma-separated energy thresholds in kcal/mol above MFE, e.g. 1,2,3,4,5. Safety is computed separately for structures within each threshold.")
+	kt     = flag.Float64("kt", 0.61632, "Thermal energy kT in kcal/mol for Boltzmann weighting, default is for 37 degrees Celsius")
+
+	heatmap    = flag.String("heatmap", "", "Draw heatmap of pair frequencies in given format: svg or png")
+	heatmapdir = flag.String("heatmapdir", ".", "Directory for heatmap files")
+	reffile    = flag.String("ref", "", "FASTA file with reference foldings to mark in heatmaps")
 )
 
-func main() {
-	flag.Parse()
+// Energies are printed with two decimals, allow for rounding
+const energyEpsilon = 1e-6
+
+type counts struct {
+	NumFolds      int
+	Pairs         [][]int
+	Free          []int
+	Weight        float64
+	WeightedPairs [][]float64
+	WeightedFree  []float64
+	SafeBases     int
+	Safe          []bool
+}
 
-	r := bufio.NewReader(os.Stdin)
+type band struct {
+	MaxEnergy float64
+	counts
+}
 
-	name, seq := readHeader(r)
+type result struct {
+	Name  string
+	Bases int
+	MFE   float64
+	Delta float64
+	counts
+	Bands []*band
+}
 
-	folds := make(chan folding.FoldingPairs, 1)
-	go getFoldings(r, folds)
+func main() {
+	flag.Parse()
 
-	numFolds := 0
-	pairs := make([][]int, len(seq))
-	free := make([]int, len(seq))
-	for i := 0; i < len(seq); i++ {
-		pairs[i] = make([]int, len(seq))
+	thresholds, err := parseBands(*bands)
+	if err != nil {
+		log.Fatalf("Invalid -bands flag: %v", err)
 	}
 
-	for fold := range folds {
-		if len(fold) != len(seq) {
-			log.Printf("Sequence length is %d, but folding length %d", len(seq), len(fold))
+	if *heatmap != "" && *heatmap != "svg" && *heatmap != "png" {
+		log.Fatalf("Unknown heatmap format \"%s\", must be svg or png", *heatmap)
+	}
+	var refs map[string]*base.Sequence
+	if *reffile != "" {
+		f, err := os.Open(*reffile)
+		if err != nil {
+			log.Fatalf("Unable to open file \"%s\": %v", *reffile, err)
 		}
-		numFolds++
-		for i, j := range fold {
-			if j < 0 {
-				free[i]++
-			} else if i < j {
-				pairs[i][j]++
+		refs, err = fasta.ReadMultiSequence(f)
+		f.Close()
+		if errs, ok := err.(fasta.FoldingErrors); ok {
+			for _, e := range errs {
+				log.Printf("Ignoring reference folding in \"%s\": %v", *reffile, e)
 			}
+		} else if err != nil {
+			log.Fatalf("Error reading FASTA format file \"%s\": %v", *reffile, err)
 		}
 	}
 
+	analyze(os.Stdin, os.Stdout, thresholds, refs)
 	os.Stdin.Close()
+}
 
-	j, err := json.Marshal(
-		struct {
-			Name     string
-			Bases    int
-			NumFolds int
-			Pairs    [][]int
-			Free     []int
-		}{
-			name, len(seq), numFolds, pairs, free,
-		})
-	if err != nil {
-		log.Printf("Failed to write results as JSON: %v", err)
+// analyze writes the counts of each record of RNAsubopt output read from in
+// to out as JSON, one line per record.
+func analyze(in io.Reader, out io.Writer, thresholds []float64, refs map[string]*base.Sequence) {
+	r := subopt.NewReader(in)
+	for {
+		rec, err := r.NextRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("Failed to read RNAsubopt output: %v", err)
+			break
+		}
+		res, err := countFoldings(r, rec, thresholds)
+		if err != nil {
+			log.Printf("Failed to read foldings of %s: %v", rec.Seq.Name, err)
+		}
+
+		j, err := json.Marshal(res)
+		if err != nil {
+			log.Printf("Failed to write results as JSON: %v", err)
+		}
+		out.Write(j)
+		out.Write([]byte{'\n'})
+		if *heatmap != "" {
+			writeHeatmap(rec.Seq, res, refs[rec.Seq.Name])
+		}
 	}
-	os.Stdout.Write(j)
-	os.Stdout.Write([]byte{'\n'})
 }
 
-func readHeader(r *bufio.Reader) (string, string) {
-	cmt, err := r.ReadString('\n')
+func writeHeatmap(seq *base.Sequence, res *result, ref *base.Sequence) {
+	var reference folding.FoldingPairs
+	if ref != nil {
+		reference = ref.ReferenceFolding
+	}
+	pairs, free := plot.IntFractions(res.Pairs, res.Free, res.NumFolds)
+	p := plot.Heatmap(seq, pairs, free, reference)
+
+	fname := path.Join(*heatmapdir, res.Name+"-heatmap."+*heatmap)
+	f, err := os.Create(fname)
 	if err != nil {
-		log.Printf("Failed to read comment: %v", err)
-		return "", ""
+		log.Printf("Could not open %s for writing: %v", fname, err)
+		return
 	}
-	if len(cmt) < 4 || cmt[0] != '>' {
-		log.Printf("Input doesn't begin with comment, got %q instead", cmt)
+	defer f.Close()
+	if *heatmap == "png" {
+		err = p.WritePNG(f)
+	} else {
+		err = p.WriteSVG(f)
 	}
-	name := strings.SplitN(cmt, " ", 3)[0][1:]
-
-	bb, err := r.ReadString('\n')
 	if err != nil {
-		log.Printf("Failed to read sequence: %v", err)
-		return cmt, ""
+		log.Printf("Failed to write to %s: %v", fname, err)
 	}
-	if bb[0] != 'A' && bb[0] != 'C' && bb[0] != 'G' && bb[0] != 'U' && bb[0] != 'N' {
-		log.Printf("Line 2 of input doesn't look like sequence, got %q instead", bb)
+}
+
+func parseBands(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
 	}
-	seq := strings.SplitN(bb, " ", 2)[0]
+	var ret []float64
+	for _, b := range strings.Split(s, ",") {
+		e, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+	sort.Float64s(ret)
+	return ret, nil
+}
 
-	return name, seq
+func newCounts(numBases int) counts {
+	c := counts{
+		Pairs:         make([][]int, numBases),
+		Free:          make([]int, numBases),
+		WeightedPairs: make([][]float64, numBases),
+		WeightedFree:  make([]float64, numBases),
+	}
+	for i := 0; i < numBases; i++ {
+		c.Pairs[i] = make([]int, numBases)
+		c.WeightedPairs[i] = make([]float64, numBases)
+	}
+	return c
 }
 
-func getFoldings(r *bufio.Reader, ret chan folding.FoldingPairs) {
-	defer close(ret)
+func (c *counts) add(f folding.FoldingPairs, weight float64) {
+	c.NumFolds++
+	c.Weight += weight
+	for i, j := range f {
+		if j < 0 {
+			c.Free[i]++
+			c.WeightedFree[i] += weight
+		} else if i < j {
+			c.Pairs[i][j]++
+			c.WeightedPairs[i][j] += weight
+		}
+	}
+}
 
-	num := 0
-	for {
-		fs, err := r.ReadString('\n')
-		if err != nil && err != io.EOF {
-			log.Printf("Failed to read folding: %v", err)
+func (c *counts) computeSafety() {
+	c.Safe = make([]bool, len(c.Free))
+	c.SafeBases = 0
+	if c.NumFolds == 0 {
+		return
+	}
+	for i := range c.Free {
+		if c.Free[i] == c.NumFolds {
+			c.Safe[i] = true
 		}
-		if len(fs) > 0 {
-			db := strings.SplitN(fs, " ", 2)[0]
-			fold := fasta.DbToFold(db)
-			ret <- fold
+		for j := i + 1; j < len(c.Free); j++ {
+			if c.Pairs[i][j] == c.NumFolds {
+				c.Safe[i] = true
+				c.Safe[j] = true
+			}
 		}
-
-		num++
-		if *maxnum > 0 && num >= *maxnum {
-			return
+	}
+	for _, s := range c.Safe {
+		if s {
+			c.SafeBases++
 		}
+	}
+}
+
+func countFoldings(r *subopt.Reader, rec *subopt.Record, thresholds []float64) (*result, error) {
+	numBases := len(rec.Seq.Bases)
+	res := &result{
+		Name:   rec.Seq.Name,
+		Bases:  numBases,
+		MFE:    rec.MFE,
+		Delta:  rec.Delta,
+		counts: newCounts(numBases),
+	}
+	for _, t := range thresholds {
+		res.Bands = append(res.Bands, &band{MaxEnergy: t, counts: newCounts(numBases)})
+	}
+
+	mfe := rec.MFE
+	first := true
+	var err error
+	for *maxnum == 0 || res.NumFolds < *maxnum {
+		var s *subopt.Structure
+		s, err = r.NextStructure()
 		if err == io.EOF {
-			return
+			err = nil
+			break
+		} else if err != nil {
+			break
+		}
+		if s.Folding == nil {
+			continue
 		}
+		if first && !rec.HasEnergies {
+			// Without RNAsubopt header, the first structure has minimum energy
+			mfe = s.Energy
+		}
+		first = false
+
+		weight := math.Exp(-(s.Energy - mfe) / *kt)
+		res.add(s.Folding, weight)
+		for _, b := range res.Bands {
+			if s.Energy-mfe <= b.MaxEnergy+energyEpsilon {
+				b.add(s.Folding, weight)
+			}
+		}
+	}
+
+	res.computeSafety()
+	for _, b := range res.Bands {
+		b.computeSafety()
 	}
+	return res, err
 }
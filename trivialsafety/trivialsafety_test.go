@@ -0,0 +1,38 @@
+package main /* import "keltainen.duckdns.org/rnafolding/trivialsafety" */
+
+import "bytes"
+import "encoding/json"
+import "strings"
+import "testing"
+
+func TestMaxNumPerRecord(t *testing.T) {
+	input := `> first
+GGGAAAUCC  -1.20   1.00
+(((...))) -1.20
+.((...)). -0.50
+> second
+GGGAAACCC  -2.10   1.00
+(((...))) -2.10
+.((...)). -1.30
+`
+	defer func(n int) { *maxnum = n }(*maxnum)
+	*maxnum = 1
+	var out bytes.Buffer
+	analyze(strings.NewReader(input), &out, nil, nil)
+
+	dec := json.NewDecoder(&out)
+	var names []string
+	for dec.More() {
+		var res result
+		if err := dec.Decode(&res); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if res.NumFolds != 1 {
+			t.Errorf("%s: read %d foldings with -num 1", res.Name, res.NumFolds)
+		}
+		names = append(names, res.Name)
+	}
+	if strings.Join(names, ",") != "first,second" {
+		t.Errorf("Expected results for first and second, got %v", names)
+	}
+}
@@ -0,0 +1,61 @@
+package trnadb /* import "keltainen.duckdns.org/rnafolding/trnadb" */
+
+import "fmt"
+import "strings"
+
+// PositionError tells that the folding line marks a pair at a position
+// that has no base in the sequence.
+type PositionError struct {
+	Position int
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("no base at paired position %d", e.Position)
+}
+
+// PairingError tells that the folding line marks two positions as paired
+// with different kinds of pairs.
+type PairingError struct {
+	A     int
+	B     int
+	CharA byte
+	CharB byte
+}
+
+func (e *PairingError) Error() string {
+	return fmt.Sprintf("pairing mismatch: '%c' at position %d and '%c' at position %d", e.CharA, e.A, e.CharB, e.B)
+}
+
+// FoldingError tells that the reference folding of a sequence could not be
+// read. The sequence itself is still returned, without reference folding
+// unless Partial is set.
+type FoldingError struct {
+	Name string
+	Err  error
+	// The reference folding is returned, with the positions of Err left
+	// unpaired
+	Partial bool
+}
+
+func (e *FoldingError) Error() string {
+	if e.Partial {
+		return fmt.Sprintf("reference folding of %s, partially read: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("reference folding of %s: %v", e.Name, e.Err)
+}
+
+func (e *FoldingError) Unwrap() error {
+	return e.Err
+}
+
+// FoldingErrors lists the sequences whose reference foldings could not be
+// read.
+type FoldingErrors []*FoldingError
+
+func (e FoldingErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
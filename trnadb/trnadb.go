@@ -7,7 +7,6 @@ package trnadb /* import "keltainen.duckdns.org/rnafolding/trnadb" */
 
 import "bufio"
 import "io"
-import "log"
 import "strings"
 import "unicode"
 
@@ -175,24 +174,33 @@ func parseLine(s string) (string, []base.Base, []int) {
 	return comment, bases, pos
 }
 
-func lookup(pos []int, n baseName) int {
+func lookup(pos []int, n baseName) (int, error) {
 	for i, v := range pos {
 		if v == int(n) {
-			return i
+			return i, nil
 		}
 	}
-	log.Printf("lookup: position %d not found in %v", n, pos)
-	return 0
+	return 0, &PositionError{Position: int(n)}
 }
 
-func joinranges(seq []base.Base, f folding.FoldingPairs, s string, pos []int, a5, a3, b5, b3 baseName) {
+// joinranges pairs the marked positions of ranges [a5, a3] and [b5, b3].
+// Positions marked with different kinds of pairs are left unpaired and
+// returned as mismatches.
+func joinranges(seq []base.Base, f folding.FoldingPairs, s string, pos []int, a5, a3, b5, b3 baseName) ([]*PairingError, error) {
+	var mismatches []*PairingError
 	a := a5
 	b := b3
 	for a <= a3 && b >= b5 {
 		if s[a] == '=' || s[a] == '*' {
 			if s[b] == s[a] {
-				apos := lookup(pos, a)
-				bpos := lookup(pos, b)
+				apos, err := lookup(pos, a)
+				if err != nil {
+					return nil, err
+				}
+				bpos, err := lookup(pos, b)
+				if err != nil {
+					return nil, err
+				}
 				if s[a] == '=' {
 					if !((seq[apos] == base.A && seq[bpos] == base.U) ||
 						(seq[apos] == base.U && seq[bpos] == base.A) ||
@@ -205,8 +213,7 @@ func joinranges(seq []base.Base, f folding.FoldingPairs, s string, pos []int, a5
 				} else {
 					if !((seq[apos] == base.U && seq[bpos] == base.G) ||
 						(seq[apos] == base.G && seq[bpos] == base.U)) {
-						log.Printf("joinrange: expected wobble pair, received %d (%v) to %d (%v) (%d-%d, %d-%d)",
-							a, seq[apos], b, seq[bpos], a5, a3, b5, b3)
+						// Likewise, not all pairs marked as wobble pairs are G-U pairs.
 					}
 				}
 				f[apos] = bpos
@@ -216,7 +223,7 @@ func joinranges(seq []base.Base, f folding.FoldingPairs, s string, pos []int, a5
 			} else if !(s[b] == '=' || s[b] == '*') {
 				b--
 			} else {
-				log.Printf("joinrange: pairing mismatch: s[%d]='%c', s[%d]='%c'", a, s[a], b, s[b])
+				mismatches = append(mismatches, &PairingError{A: int(a), B: int(b), CharA: s[a], CharB: s[b]})
 				a++
 				b--
 			}
@@ -224,25 +231,44 @@ func joinranges(seq []base.Base, f folding.FoldingPairs, s string, pos []int, a5
 			a++
 		}
 	}
+	return mismatches, nil
 }
 
-func parseFold(seq []base.Base, raws string, positions []int) folding.FoldingPairs {
+// parseFold returns the reference folding marked in raws, and the pairing
+// mismatches left out of it.
+func parseFold(seq []base.Base, raws string, positions []int) (folding.FoldingPairs, []*PairingError, error) {
 	s := raws[basesStartColumn:]
 	f := folding.NewFoldingPairs(len(positions))
 	//log.Print(seq)
 	//log.Printf("%q", s)
-	joinranges(seq, f, s, positions, b1, b7, b66, b72)
-	joinranges(seq, f, s, positions, b10, b13, b22, b25)
-	joinranges(seq, f, s, positions, b26, b31, b39, b44)
-	joinranges(seq, f, s, positions, e11, e17, e27, e21)
-	joinranges(seq, f, s, positions, b45, b45, b46, b48)
-	joinranges(seq, f, s, positions, b49, b53, b61, b65)
-	return f
+	ranges := [][4]baseName{
+		{b1, b7, b66, b72},
+		{b10, b13, b22, b25},
+		{b26, b31, b39, b44},
+		{e11, e17, e27, e21},
+		{b45, b45, b46, b48},
+		{b49, b53, b61, b65},
+	}
+	var mismatches []*PairingError
+	for _, r := range ranges {
+		m, err := joinranges(seq, f, s, positions, r[0], r[1], r[2], r[3])
+		if err != nil {
+			return nil, nil, err
+		}
+		mismatches = append(mismatches, m...)
+	}
+	return f, mismatches, nil
 }
 
+// ReadSequences reads all RNA sequences of the database. Sequences whose
+// reference foldings are invalid are returned without them, and listed in
+// a FoldingErrors error after all sequences have been read. Pairing
+// mismatches are listed there as well, but only leave the mismatched
+// positions unpaired in the reference folding.
 func ReadSequences(r io.Reader) (map[string]*base.Sequence, error) {
 	br := bufio.NewReader(r)
 	seqs := map[string]*base.Sequence{}
+	var foldingErrs FoldingErrors
 	for {
 		c, err := br.ReadString('\n')
 		if err != nil && err != io.EOF {
@@ -258,7 +284,13 @@ func ReadSequences(r io.Reader) (map[string]*base.Sequence, error) {
 			if err != nil {
 				return nil, err
 			}
-			fold := parseFold(bases, foldLine, positions)
+			fold, mismatches, err := parseFold(bases, foldLine, positions)
+			if err != nil {
+				foldingErrs = append(foldingErrs, &FoldingError{Name: name, Err: err})
+			}
+			for _, m := range mismatches {
+				foldingErrs = append(foldingErrs, &FoldingError{Name: name, Err: m, Partial: true})
+			}
 			seqs[name] = &base.Sequence{
 				Name:              name,
 				Comment:           comment,
@@ -271,5 +303,8 @@ func ReadSequences(r io.Reader) (map[string]*base.Sequence, error) {
 			break
 		}
 	}
+	if len(foldingErrs) > 0 {
+		return seqs, foldingErrs
+	}
 	return seqs, nil
 }
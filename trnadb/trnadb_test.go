@@ -1,5 +1,7 @@
 package trnadb /* import "keltainen.duckdns.org/rnafolding/trnadb" */
 
+import "reflect"
+import "strings"
 import "testing"
 
 func TestBaseNames(t *testing.T) {
@@ -24,3 +26,62 @@ func TestBaseNames(t *testing.T) {
 		}
 	}
 }
+
+// dbRecord returns a sequence line and a folding line in the format of the
+// database, with the given marks in the folding line.
+func dbRecord(name string, seq []byte, marks map[baseName]byte) string {
+	fold := []byte(strings.Repeat(" ", basesStartColumn+len(seq)))
+	for n, c := range marks {
+		fold[basesStartColumn+int(n)] = c
+	}
+	return "R" + name + " test\t" + string(seq) + "\n" + string(fold) + "\n"
+}
+
+func TestReadSequencesFoldingErrors(t *testing.T) {
+	bases := func(gap baseName) []byte {
+		seq := []byte(strings.Repeat("A", int(b76)+1))
+		seq[b1] = 'G'
+		seq[b72] = 'C'
+		if gap != b0 {
+			seq[gap] = '-'
+		}
+		return seq
+	}
+	db := dbRecord("valid", bases(b0), map[baseName]byte{b1: '=', b72: '='}) +
+		dbRecord("gap", bases(b72), map[baseName]byte{b1: '=', b72: '='}) +
+		dbRecord("mismatch", bases(b0), map[baseName]byte{b1: '=', b72: '*'})
+
+	seqs, err := ReadSequences(strings.NewReader(db))
+	errs, ok := err.(FoldingErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("ReadSequences: expected FoldingErrors for two sequences, received %v", err)
+	}
+	expected := map[string]error{
+		"Rgap":      &PositionError{Position: int(b72)},
+		"Rmismatch": &PairingError{A: int(b1), B: int(b72), CharA: '=', CharB: '*'},
+	}
+	for _, e := range errs {
+		if !reflect.DeepEqual(e.Err, expected[e.Name]) {
+			t.Errorf("ReadSequences: expected error %v for %s, received %v", expected[e.Name], e.Name, e.Err)
+		}
+		if e.Partial != (e.Name == "Rmismatch") {
+			t.Errorf("ReadSequences: error for %s partial %v", e.Name, e.Partial)
+		}
+	}
+	if seq := seqs["Rgap"]; seq == nil || seq.ReferenceFolding != nil {
+		t.Errorf("ReadSequences: expected Rgap without reference folding, received %#v", seq)
+	}
+	// The mismatched positions are left unpaired, the rest of the folding
+	// is kept
+	if seq := seqs["Rmismatch"]; seq == nil || len(seq.ReferenceFolding) != len(seq.Bases) || seq.ReferenceFolding[b1] >= 0 || seq.ReferenceFolding[b72] >= 0 {
+		t.Errorf("ReadSequences: expected Rmismatch with b1 and b72 unpaired, received %#v", seq)
+	}
+
+	valid := seqs["Rvalid"]
+	if valid == nil {
+		t.Fatalf("ReadSequences: valid sequence missing")
+	}
+	if f := valid.ReferenceFolding; f == nil || f[b1] != int(b72) || f[b72] != int(b1) {
+		t.Errorf("ReadSequences: expected pair (%d, %d), received folding %v", b1, b72, f)
+	}
+}
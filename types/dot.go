@@ -0,0 +1,59 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "fmt"
+import "math/big"
+import "strings"
+
+// Dot returns the tree in Graphviz DOT format. Each node lists its pairs,
+// free bases and the number of foldings below it. Shared subtrees are
+// drawn only once, with an edge from each of their parents.
+func (f *FoldTree) Dot() string {
+	var out strings.Builder
+	counts := map[*FoldTree]*big.Int{}
+	ids := map[*FoldTree]int{}
+	var visit func(n *FoldTree) int
+	visit = func(n *FoldTree) int {
+		if id, ok := ids[n]; ok {
+			return id
+		}
+		id := len(ids)
+		ids[n] = id
+
+		var label []string
+		if len(n.Pairs) > 0 {
+			var pairs []string
+			for _, p := range n.Pairs {
+				pairs = append(pairs, fmt.Sprintf("(%d,%d)", p.I, p.J))
+			}
+			label = append(label, "Pairs: "+strings.Join(pairs, ", "))
+		}
+		if len(n.Free) > 0 {
+			var free []string
+			for _, i := range n.Free {
+				free = append(free, fmt.Sprintf("%d", i))
+			}
+			label = append(label, "Free: "+strings.Join(free, ", "))
+		}
+		count := countSolutions(n, counts)
+		if count.Cmp(big.NewInt(1)) == 0 {
+			label = append(label, "1 folding")
+		} else {
+			label = append(label, fmt.Sprintf("%v foldings", count))
+		}
+		fmt.Fprintf(&out, "  n%d [label=\"%s\"];\n", id, strings.Join(label, "\\n"))
+
+		if n.JoinPrefix != nil {
+			fmt.Fprintf(&out, "  n%d -> n%d [label=\"join prefix\"];\n", id, visit(n.JoinPrefix))
+			fmt.Fprintf(&out, "  n%d -> n%d [label=\"join suffix\"];\n", id, visit(n.JoinSuffix))
+		}
+		for i, b := range n.Branches {
+			fmt.Fprintf(&out, "  n%d -> n%d [label=\"alternative %d\" style=dashed];\n", id, visit(b), i+1)
+		}
+		return id
+	}
+
+	out.WriteString("digraph FoldTree {\n  node [shape=box];\n")
+	visit(f)
+	out.WriteString("}\n")
+	return out.String()
+}
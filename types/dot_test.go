@@ -0,0 +1,47 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "testing"
+
+func TestDot(t *testing.T) {
+	tests := []struct {
+		tree     *FoldTree
+		expected string
+	}{
+		{
+			&FoldTree{Pairs: []Pair{{I: 0, J: 4}}, Free: []int{1, 2, 3}},
+			`digraph FoldTree {
+  node [shape=box];
+  n0 [label="Pairs: (0,4)\nFree: 1, 2, 3\n1 folding"];
+}
+`,
+		},
+		{
+			sharedTestTree(),
+			`digraph FoldTree {
+  node [shape=box];
+  n0 [label="4 foldings"];
+  n1 [label="Pairs: (0,8)\n2 foldings"];
+  n2 [label="Free: 1, 2\n1 folding"];
+  n1 -> n2 [label="join prefix"];
+  n3 [label="2 foldings"];
+  n4 [label="Pairs: (10,11)\nFree: 9\n1 folding"];
+  n3 -> n4 [label="alternative 1" style=dashed];
+  n5 [label="Pairs: (9,10)\nFree: 11\n1 folding"];
+  n3 -> n5 [label="alternative 2" style=dashed];
+  n1 -> n3 [label="join suffix"];
+  n0 -> n1 [label="alternative 1" style=dashed];
+  n6 [label="Pairs: (1,8)\n2 foldings"];
+  n7 [label="Free: 0, 2\n1 folding"];
+  n6 -> n7 [label="join prefix"];
+  n6 -> n3 [label="join suffix"];
+  n0 -> n6 [label="alternative 2" style=dashed];
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		if actual := tt.tree.Dot(); actual != tt.expected {
+			t.Errorf("Dot(%v): expected\n%s\ngot\n%s", tt.tree, tt.expected, actual)
+		}
+	}
+}
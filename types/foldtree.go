@@ -1,6 +1,7 @@
 package types /* import "keltainen.duckdns.org/rnafolding/types" */
 
 import "fmt"
+import "math/big"
 import "strings"
 
 import "keltainen.duckdns.org/rnafolding/base"
@@ -29,48 +30,79 @@ func liftBranches(p *FoldTree, c *FoldTree) {
 	p.JoinSuffix = c.JoinSuffix
 }
 
-func (f *FoldTree) CollapseTree() {
-	for _, b := range f.Branches {
-		b.CollapseTree()
+// stripped returns a node with the same alternatives as f, but without
+// pairs and free bases of its own.
+func stripped(f *FoldTree) *FoldTree {
+	if len(f.Pairs) == 0 && len(f.Free) == 0 {
+		return f
 	}
-	if f.JoinPrefix != nil {
-		f.JoinPrefix.CollapseTree()
-		f.JoinSuffix.CollapseTree()
-		f.Pairs = append(f.Pairs, f.JoinPrefix.Pairs...)
-		f.JoinPrefix.Pairs = nil
-		f.Free = append(f.Free, f.JoinPrefix.Free...)
-		f.JoinPrefix.Free = nil
-		f.Pairs = append(f.Pairs, f.JoinSuffix.Pairs...)
-		f.JoinSuffix.Pairs = nil
-		f.Free = append(f.Free, f.JoinSuffix.Free...)
-		f.JoinSuffix.Free = nil
+	s := &FoldTree{}
+	liftBranches(s, f)
+	return s
+}
 
-		if branchless(f.JoinPrefix) || branchless(f.JoinSuffix) {
-			pref := f.JoinPrefix
-			suff := f.JoinSuffix
-			f.JoinPrefix = nil
-			f.JoinSuffix = nil
-			if !branchless(pref) {
-				liftBranches(f, pref)
+// CollapseTree moves pairs and free bases of joined subtrees to their
+// parent. Subtrees may be shared, so they are never modified: changed
+// nodes are replaced with new ones.
+func (f *FoldTree) CollapseTree() {
+	memo := map[*FoldTree]*FoldTree{}
+	var collapse func(n *FoldTree) *FoldTree
+	collapse = func(n *FoldTree) *FoldTree {
+		if c, ok := memo[n]; ok {
+			return c
+		}
+		c := &FoldTree{
+			Pairs: append([]Pair(nil), n.Pairs...),
+			Free:  append([]int(nil), n.Free...),
+		}
+		for _, b := range n.Branches {
+			c.Branches = append(c.Branches, collapse(b))
+		}
+		if n.JoinPrefix != nil {
+			pref := collapse(n.JoinPrefix)
+			suff := collapse(n.JoinSuffix)
+			c.Pairs = append(c.Pairs, pref.Pairs...)
+			c.Free = append(c.Free, pref.Free...)
+			c.Pairs = append(c.Pairs, suff.Pairs...)
+			c.Free = append(c.Free, suff.Free...)
+
+			if !branchless(pref) && !branchless(suff) {
+				c.JoinPrefix = stripped(pref)
+				c.JoinSuffix = stripped(suff)
+			} else if !branchless(pref) {
+				liftBranches(c, pref)
 			} else if !branchless(suff) {
-				liftBranches(f, suff)
+				liftBranches(c, suff)
 			}
 		}
+		memo[n] = c
+		return c
 	}
+	*f = *collapse(f)
 }
 
-func (f *FoldTree) CountSolutions() int {
-	if len(f.Branches) > 0 {
-		sum := 0
-		for _, b := range f.Branches {
-			sum += b.CountSolutions()
-		}
-		return sum
+func countSolutions(f *FoldTree, memo map[*FoldTree]*big.Int) *big.Int {
+	if c, ok := memo[f]; ok {
+		return c
+	}
+	c := new(big.Int)
+	for _, b := range f.Branches {
+		c.Add(c, countSolutions(b, memo))
 	}
 	if f.JoinPrefix != nil {
-		return f.JoinPrefix.CountSolutions() * f.JoinSuffix.CountSolutions()
+		c.Add(c, new(big.Int).Mul(countSolutions(f.JoinPrefix, memo), countSolutions(f.JoinSuffix, memo)))
+	}
+	if branchless(f) {
+		c.SetInt64(1)
 	}
-	return 1
+	memo[f] = c
+	return c
+}
+
+// CountSolutions returns the number of foldings represented by the tree.
+// Shared subtrees are counted only once.
+func (f *FoldTree) CountSolutions() *big.Int {
+	return countSolutions(f, map[*FoldTree]*big.Int{})
 }
 
 type PairSet struct {
@@ -153,69 +185,63 @@ func (set *FreeSet) removedFrom(pp []int) []int {
 	return ret
 }
 
-func (f *FoldTree) LiftCommon() {
-	for _, b := range f.Branches {
-		b.LiftCommon()
-	}
-	if f.JoinPrefix != nil {
-		f.JoinPrefix.LiftCommon()
-		f.JoinSuffix.LiftCommon()
-	}
-
-	if len(f.Branches) > 0 {
-		pairs := newPairSet(f.Branches[0].Pairs)
-		free := newFreeSet(f.Branches[0].Free)
-		for _, b := range f.Branches {
-			pairs = pairs.intersect(b.Pairs)
-			free = free.intersect(b.Free)
-		}
-		f.Pairs = pairs.addTo(f.Pairs)
-		f.Free = free.addTo(f.Free)
-		for _, b := range f.Branches {
-			b.Pairs = pairs.removedFrom(b.Pairs)
-			b.Free = free.removedFrom(b.Free)
-		}
-	}
+// SplitCommon finds the pairs and free bases that are common to all
+// branches. It returns them, and the branches with the common parts
+// removed. The given branches are not modified.
+func SplitCommon(branches []*FoldTree) ([]Pair, []int, []*FoldTree) {
+	if len(branches) == 0 {
+		return nil, nil, branches
+	}
+	pairs := newPairSet(branches[0].Pairs)
+	free := newFreeSet(branches[0].Free)
+	for _, b := range branches {
+		pairs = pairs.intersect(b.Pairs)
+		free = free.intersect(b.Free)
+	}
+	if len(pairs.s) == 0 && len(free.s) == 0 {
+		return nil, nil, branches
+	}
+	rest := make([]*FoldTree, len(branches))
+	for i, b := range branches {
+		r := *b
+		r.Pairs = pairs.removedFrom(b.Pairs)
+		r.Free = free.removedFrom(b.Free)
+		rest[i] = &r
+	}
+	return pairs.addTo(nil), free.addTo(nil), rest
 }
 
-func (f *FoldTree) SimplifyImmediate() {
-	if f.JoinPrefix != nil {
-		f.Pairs = append(f.Pairs, f.JoinPrefix.Pairs...)
-		f.JoinPrefix.Pairs = nil
-		f.Free = append(f.Free, f.JoinPrefix.Free...)
-		f.JoinPrefix.Free = nil
-		f.Pairs = append(f.Pairs, f.JoinSuffix.Pairs...)
-		f.JoinSuffix.Pairs = nil
-		f.Free = append(f.Free, f.JoinSuffix.Free...)
-		f.JoinSuffix.Free = nil
-
-		if branchless(f.JoinPrefix) || branchless(f.JoinSuffix) {
-			pref := f.JoinPrefix
-			suff := f.JoinSuffix
-			f.JoinPrefix = nil
-			f.JoinSuffix = nil
-			if !branchless(pref) {
-				liftBranches(f, pref)
-			} else if !branchless(suff) {
-				liftBranches(f, suff)
-			}
+// LiftCommon moves pairs and free bases common to all alternatives to
+// their parent. Like CollapseTree, it never modifies shared subtrees.
+func (f *FoldTree) LiftCommon() {
+	memo := map[*FoldTree]*FoldTree{}
+	var lift func(n *FoldTree) *FoldTree
+	lift = func(n *FoldTree) *FoldTree {
+		if l, ok := memo[n]; ok {
+			return l
 		}
-	}
-
-	if len(f.Branches) > 0 {
-		pairs := newPairSet(f.Branches[0].Pairs)
-		free := newFreeSet(f.Branches[0].Free)
-		for _, b := range f.Branches {
-			pairs = pairs.intersect(b.Pairs)
-			free = free.intersect(b.Free)
+		l := &FoldTree{
+			Pairs: append([]Pair(nil), n.Pairs...),
+			Free:  append([]int(nil), n.Free...),
 		}
-		f.Pairs = pairs.addTo(f.Pairs)
-		f.Free = free.addTo(f.Free)
-		for _, b := range f.Branches {
-			b.Pairs = pairs.removedFrom(b.Pairs)
-			b.Free = free.removedFrom(b.Free)
+		if n.JoinPrefix != nil {
+			l.JoinPrefix = lift(n.JoinPrefix)
+			l.JoinSuffix = lift(n.JoinSuffix)
 		}
+		if len(n.Branches) > 0 {
+			branches := make([]*FoldTree, len(n.Branches))
+			for i, b := range n.Branches {
+				branches[i] = lift(b)
+			}
+			pairs, free, rest := SplitCommon(branches)
+			l.Pairs = append(l.Pairs, pairs...)
+			l.Free = append(l.Free, free...)
+			l.Branches = rest
+		}
+		memo[n] = l
+		return l
 	}
+	*f = *lift(f)
 }
 
 func joinArrays(a, b folding.FoldingPairs) []int {
@@ -259,86 +285,72 @@ func (f *FoldTree) GeneratePairArrays(seq *base.Sequence) folding.FoldingSet {
 	return pp
 }
 
-func (f *FoldTree) PairArrayIterator(seq *base.Sequence) <-chan folding.FoldingPairs {
-	fold := folding.NewFoldingPairs(len(seq.Bases))
-	return f.pairArrayIteratorInternal(seq, fold)
-}
-
-func (f *FoldTree) pairArrayIteratorInternal(seq *base.Sequence, fold folding.FoldingPairs) <-chan folding.FoldingPairs {
-	ch := make(chan folding.FoldingPairs, 10)
-	go f.recursivePAIEntry(seq, fold, ch)
-	return ch
+// String lists the contents of the tree. Subtrees shared by several
+// parents are listed only the first time, and later referred to by number.
+func (f *FoldTree) String() string {
+	refs := map[*FoldTree]int{}
+	var countRefs func(n *FoldTree)
+	countRefs = func(n *FoldTree) {
+		refs[n]++
+		if refs[n] > 1 {
+			return
+		}
+		if n.JoinPrefix != nil {
+			countRefs(n.JoinPrefix)
+			countRefs(n.JoinSuffix)
+		}
+		for _, b := range n.Branches {
+			countRefs(b)
+		}
+	}
+	countRefs(f)
+	pr := &treePrinter{refs: refs, ids: map[*FoldTree]int{}}
+	pr.print(f, 0)
+	return pr.out.String()
 }
 
-func (f *FoldTree) recursivePAIEntry(seq *base.Sequence, fold folding.FoldingPairs, ch chan folding.FoldingPairs) {
-	f.recursivePairArrayIterator(seq, fold, ch)
-	close(ch)
+type treePrinter struct {
+	out  strings.Builder
+	refs map[*FoldTree]int
+	ids  map[*FoldTree]int
 }
 
-func (f *FoldTree) recursivePairArrayIterator(seq *base.Sequence, fold folding.FoldingPairs, ch chan folding.FoldingPairs) {
-	for _, pair := range f.Pairs {
-		fold[pair.I] = pair.J
-		fold[pair.J] = pair.I
+func (pr *treePrinter) child(title string, f *FoldTree, depth int) {
+	indent := strings.Repeat("    ", depth)
+	if id, ok := pr.ids[f]; ok {
+		fmt.Fprintf(&pr.out, "%s%s same as shared subtree %d\n", indent, title, id)
+		return
 	}
-	for _, free := range f.Free {
-		fold[free] = -1
+	if pr.refs[f] > 1 {
+		pr.ids[f] = len(pr.ids) + 1
+		fmt.Fprintf(&pr.out, "%s%s (shared subtree %d)\n", indent, title, pr.ids[f])
+	} else {
+		fmt.Fprintf(&pr.out, "%s%s\n", indent, title)
 	}
-
-	if len(f.Branches) == 0 && f.JoinPrefix == nil {
-		ch <- fold
-	}
-	for _, b := range f.Branches {
-		fcopy := folding.NewFoldingPairs(len(seq.Bases))
-		copy(fcopy, fold)
-		b.recursivePairArrayIterator(seq, fcopy, ch)
-	}
-	if f.JoinPrefix != nil {
-		fcopy := folding.NewFoldingPairs(len(seq.Bases))
-		copy(fcopy, fold)
-		for pa := range f.JoinPrefix.pairArrayIteratorInternal(seq, fcopy) {
-			fnew := folding.NewFoldingPairs(len(seq.Bases))
-			for sa := range f.JoinSuffix.pairArrayIteratorInternal(seq, fnew) {
-				ch <- joinArrays(pa, sa)
-			}
-		}
-	}
-}
-
-func (f *FoldTree) String() string {
-	return recursiveSCFolding(f, 0)
+	pr.print(f, depth+1)
 }
 
-func recursiveSCFolding(f *FoldTree, depth int) string {
-	out := ""
-	indent := ""
-	for i := 0; i < depth; i++ {
-		indent += "    "
-	}
+func (pr *treePrinter) print(f *FoldTree, depth int) {
+	indent := strings.Repeat("    ", depth)
 	if len(f.Pairs) > 0 {
-		out += indent + "Pairs: "
 		var pairs []string
 		for _, p := range f.Pairs {
 			pairs = append(pairs, fmt.Sprintf("(%d,%d)", p.I, p.J))
 		}
-		out += strings.Join(pairs, ", ") + "\n"
+		fmt.Fprintf(&pr.out, "%sPairs: %s\n", indent, strings.Join(pairs, ", "))
 	}
 	if len(f.Free) > 0 {
-		out += indent + "Free: "
 		var free []string
 		for _, i := range f.Free {
 			free = append(free, fmt.Sprintf("%d", i))
 		}
-		out += strings.Join(free, ", ") + "\n"
+		fmt.Fprintf(&pr.out, "%sFree: %s\n", indent, strings.Join(free, ", "))
 	}
 	if f.JoinPrefix != nil {
-		out += indent + "Join prefix:\n"
-		out += recursiveSCFolding(f.JoinPrefix, depth+1)
-		out += indent + "Join suffix:\n"
-		out += recursiveSCFolding(f.JoinSuffix, depth+1)
+		pr.child("Join prefix:", f.JoinPrefix, depth)
+		pr.child("Join suffix:", f.JoinSuffix, depth)
 	}
 	for i, b := range f.Branches {
-		out += fmt.Sprintf("%sAlternative %d of %d:\n", indent, i+1, len(f.Branches))
-		out += recursiveSCFolding(b, depth+1)
+		pr.child(fmt.Sprintf("Alternative %d of %d:", i+1, len(f.Branches)), b, depth)
 	}
-	return out
 }
@@ -1,8 +1,11 @@
 package types /* import "keltainen.duckdns.org/rnafolding/types" */
 
+import "math/big"
 import "testing"
 import "reflect"
 
+import "keltainen.duckdns.org/rnafolding/base"
+
 func TestCollapseTreeAlternatives(t *testing.T) {
 	f := &FoldTree{
 		Pairs: []Pair{Pair{I: 0, J: 13}},
@@ -72,3 +75,32 @@ func TestCollapseTreeAlternatives(t *testing.T) {
 		t.Errorf("CollapseTree(): got:\n%v\nexpected\n%v\n", f, expected)
 	}
 }
+
+func TestTransformShared(t *testing.T) {
+	seq := &base.Sequence{Bases: make([]base.Base, 12)}
+	tree := sharedTestTree()
+	shared := tree.Branches[0].JoinSuffix
+	sharedCopy := *shared
+	expected := tree.GeneratePairArrays(seq)
+
+	if n := tree.CountSolutions(); n.Cmp(big.NewInt(4)) != 0 {
+		t.Errorf("CountSolutions(): expected 4, got %v", n)
+	}
+	tree.CollapseTree()
+	if n := tree.CountSolutions(); n.Cmp(big.NewInt(4)) != 0 {
+		t.Errorf("CountSolutions() after CollapseTree: expected 4, got %v", n)
+	}
+	tree.LiftCommon()
+	if n := tree.CountSolutions(); n.Cmp(big.NewInt(4)) != 0 {
+		t.Errorf("CountSolutions() after LiftCommon: expected 4, got %v", n)
+	}
+	if actual := tree.GeneratePairArrays(seq); !foldingSetsEqual(t, actual, expected) {
+		t.Errorf("CollapseTree and LiftCommon changed foldings: expected %v, got %v", expected, actual)
+	}
+	if !reflect.DeepEqual(*shared, sharedCopy) {
+		t.Errorf("shared subtree was modified: expected %v, got %v", &sharedCopy, shared)
+	}
+	if len(tree.Branches) != 2 || len(tree.Branches[0].Branches) != 2 || tree.Branches[0].Branches[0] != tree.Branches[1].Branches[0] {
+		t.Errorf("subtree is no longer shared:\n%v", tree)
+	}
+}
@@ -0,0 +1,118 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "context"
+import "math/big"
+
+import "keltainen.duckdns.org/rnafolding/folding"
+
+// FoldingIterator enumerates the foldings represented by a FoldTree one
+// at a time. Each folding is constructed directly from its index, so
+// memory use does not depend on the number of foldings. The iterator keeps
+// the number of foldings below each node of the tree, so it takes memory
+// linear in the number of nodes.
+type FoldingIterator struct {
+	tree     *FoldTree
+	numBases int
+	ctx      context.Context
+	counts   map[*FoldTree]*big.Int
+	next     *big.Int
+	end      *big.Int
+	cur      folding.FoldingPairs
+	err      error
+}
+
+// Iterate returns an iterator over the foldings of numBases bases
+// represented by the tree, which stops if ctx is cancelled.
+func (f *FoldTree) Iterate(ctx context.Context, numBases int) *FoldingIterator {
+	it := &FoldingIterator{
+		tree:     f,
+		numBases: numBases,
+		ctx:      ctx,
+		counts:   map[*FoldTree]*big.Int{},
+		next:     new(big.Int),
+	}
+	it.end = new(big.Int).Set(it.count(f))
+	return it
+}
+
+func (it *FoldingIterator) count(f *FoldTree) *big.Int {
+	return countSolutions(f, it.counts)
+}
+
+// Total returns the number of foldings in the tree, regardless of Skip
+// and Limit.
+func (it *FoldingIterator) Total() *big.Int {
+	return new(big.Int).Set(it.count(it.tree))
+}
+
+// Skip skips over the next k foldings.
+func (it *FoldingIterator) Skip(k int64) *FoldingIterator {
+	it.next.Add(it.next, big.NewInt(k))
+	if it.next.Cmp(it.end) > 0 {
+		it.next.Set(it.end)
+	}
+	return it
+}
+
+// Limit stops the iteration after n more foldings.
+func (it *FoldingIterator) Limit(n int64) *FoldingIterator {
+	end := new(big.Int).Add(it.next, big.NewInt(n))
+	if end.Cmp(it.end) < 0 {
+		it.end = end
+	}
+	return it
+}
+
+// Next advances to the next folding. Returns false when there are no more
+// foldings or the context is cancelled.
+func (it *FoldingIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	if it.next.Cmp(it.end) >= 0 {
+		it.cur = nil
+		return false
+	}
+	it.cur = folding.NewFoldingPairs(it.numBases)
+	it.unrank(it.tree, new(big.Int).Set(it.next), it.cur)
+	it.next.Add(it.next, big.NewInt(1))
+	return true
+}
+
+// Folding returns the current folding. The returned array is not reused
+// by the iterator.
+func (it *FoldingIterator) Folding() folding.FoldingPairs {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *FoldingIterator) Err() error {
+	return it.err
+}
+
+func (it *FoldingIterator) unrank(f *FoldTree, k *big.Int, fold folding.FoldingPairs) {
+	for _, pair := range f.Pairs {
+		fold[pair.I] = pair.J
+		fold[pair.J] = pair.I
+	}
+	for _, free := range f.Free {
+		fold[free] = -1
+	}
+	for _, b := range f.Branches {
+		c := it.count(b)
+		if k.Cmp(c) < 0 {
+			it.unrank(b, k, fold)
+			return
+		}
+		k.Sub(k, c)
+	}
+	if f.JoinPrefix != nil {
+		kp, ks := new(big.Int).DivMod(k, it.count(f.JoinSuffix), new(big.Int))
+		it.unrank(f.JoinPrefix, kp, fold)
+		it.unrank(f.JoinSuffix, ks, fold)
+	}
+}
@@ -0,0 +1,87 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "context"
+import "reflect"
+import "testing"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+
+func iteratorTestTree() *FoldTree {
+	return &FoldTree{
+		Pairs: []Pair{{I: 0, J: 13}, {I: 1, J: 2}, {I: 3, J: 7}, {I: 8, J: 12}},
+		JoinPrefix: &FoldTree{
+			Branches: []*FoldTree{
+				{Free: []int{4}, Pairs: []Pair{{I: 5, J: 6}}},
+				{Free: []int{6}, Pairs: []Pair{{I: 4, J: 5}}},
+			},
+		},
+		JoinSuffix: &FoldTree{
+			Branches: []*FoldTree{
+				{Free: []int{9}, Pairs: []Pair{{I: 10, J: 11}}},
+				{Free: []int{11}, Pairs: []Pair{{I: 9, J: 10}}},
+				{Free: []int{10}, Pairs: []Pair{{I: 9, J: 11}}},
+			},
+		},
+	}
+}
+
+func collect(it *FoldingIterator) folding.FoldingSet {
+	var ff folding.FoldingSet
+	for it.Next() {
+		ff = append(ff, it.Folding())
+	}
+	return ff
+}
+
+func foldingSetsEqual(t *testing.T, a, b folding.FoldingSet) bool {
+	equal, err := folding.FoldingSetsEqual(a, b)
+	if err != nil {
+		t.Errorf("FoldingSetsEqual: %v", err)
+	}
+	return equal
+}
+
+func TestIterate(t *testing.T) {
+	tree := iteratorTestTree()
+	seq := &base.Sequence{Bases: make([]base.Base, 14)}
+	expected := tree.GeneratePairArrays(seq)
+
+	it := tree.Iterate(context.Background(), 14)
+	if it.Total().Int64() != 6 {
+		t.Errorf("Total(): expected 6, got %v", it.Total())
+	}
+	all := collect(it)
+	if it.Err() != nil {
+		t.Errorf("Iterate: unexpected error %v", it.Err())
+	}
+	if !foldingSetsEqual(t, all, expected) {
+		t.Errorf("Iterate: expected %v, got %v", expected, all)
+	}
+
+	part := collect(tree.Iterate(context.Background(), 14).Skip(2).Limit(3))
+	if !reflect.DeepEqual(part, all[2:5]) {
+		t.Errorf("Skip(2).Limit(3): expected %v, got %v", all[2:5], part)
+	}
+	if rest := collect(tree.Iterate(context.Background(), 14).Skip(5).Limit(10)); !reflect.DeepEqual(rest, all[5:]) {
+		t.Errorf("Skip(5).Limit(10): expected %v, got %v", all[5:], rest)
+	}
+	if none := collect(tree.Iterate(context.Background(), 14).Skip(100)); len(none) != 0 {
+		t.Errorf("Skip(100): expected no foldings, got %v", none)
+	}
+}
+
+func TestIterateCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	it := iteratorTestTree().Iterate(ctx, 14)
+	if !it.Next() {
+		t.Fatalf("Next(): expected a folding before cancel")
+	}
+	cancel()
+	if it.Next() {
+		t.Errorf("Next(): expected false after cancel")
+	}
+	if it.Err() != context.Canceled {
+		t.Errorf("Err(): expected %v, got %v", context.Canceled, it.Err())
+	}
+}
@@ -0,0 +1,211 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "bytes"
+import "encoding/binary"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io"
+import "math"
+
+// FoldTree is serialised as a flat list of nodes, where children are
+// referred to by their index in the list. Children always come before
+// their parents and the root is the last node. A node reachable through
+// several paths is stored only once.
+
+type jsonNode struct {
+	Pairs    [][2]int `json:",omitempty"`
+	Free     []int    `json:",omitempty"`
+	Join     []int    `json:",omitempty"`
+	Branches []int    `json:",omitempty"`
+}
+
+type jsonTree struct {
+	Nodes []jsonNode
+}
+
+// flatten lists the nodes of f in post-order, each node once.
+func (f *FoldTree) flatten() ([]*FoldTree, map[*FoldTree]int) {
+	var nodes []*FoldTree
+	index := map[*FoldTree]int{}
+	var visit func(n *FoldTree)
+	visit = func(n *FoldTree) {
+		if _, ok := index[n]; ok {
+			return
+		}
+		if n.JoinPrefix != nil {
+			visit(n.JoinPrefix)
+			visit(n.JoinSuffix)
+		}
+		for _, b := range n.Branches {
+			visit(b)
+		}
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+	}
+	visit(f)
+	return nodes, index
+}
+
+func (f *FoldTree) MarshalJSON() ([]byte, error) {
+	nodes, index := f.flatten()
+	out := jsonTree{Nodes: make([]jsonNode, len(nodes))}
+	for i, n := range nodes {
+		jn := &out.Nodes[i]
+		for _, p := range n.Pairs {
+			jn.Pairs = append(jn.Pairs, [2]int{p.I, p.J})
+		}
+		jn.Free = n.Free
+		if n.JoinPrefix != nil {
+			jn.Join = []int{index[n.JoinPrefix], index[n.JoinSuffix]}
+		}
+		for _, b := range n.Branches {
+			jn.Branches = append(jn.Branches, index[b])
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (f *FoldTree) UnmarshalJSON(data []byte) error {
+	var in jsonTree
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if len(in.Nodes) == 0 {
+		return errors.New("fold tree has no nodes")
+	}
+	nodes := make([]*FoldTree, len(in.Nodes))
+	for i, jn := range in.Nodes {
+		n := &FoldTree{}
+		if i == len(in.Nodes)-1 {
+			n = f
+			*f = FoldTree{}
+		}
+		for _, p := range jn.Pairs {
+			n.Pairs = append(n.Pairs, Pair{I: p[0], J: p[1]})
+		}
+		n.Free = jn.Free
+		if len(jn.Join) != 0 && len(jn.Join) != 2 {
+			return fmt.Errorf("node %d: join must have two nodes, got %d", i, len(jn.Join))
+		}
+		children := append(append([]int{}, jn.Join...), jn.Branches...)
+		for _, c := range children {
+			if c < 0 || c >= i {
+				return fmt.Errorf("node %d: invalid child node %d", i, c)
+			}
+		}
+		if len(jn.Join) == 2 {
+			n.JoinPrefix = nodes[jn.Join[0]]
+			n.JoinSuffix = nodes[jn.Join[1]]
+		}
+		for _, b := range jn.Branches {
+			n.Branches = append(n.Branches, nodes[b])
+		}
+		nodes[i] = n
+	}
+	return nil
+}
+
+var binaryMagic = []byte("FTR\x01")
+
+// MarshalBinary encodes the tree in a compact form, where all numbers are
+// stored as variable length integers.
+func (f *FoldTree) MarshalBinary() ([]byte, error) {
+	nodes, index := f.flatten()
+	var buf bytes.Buffer
+	tmp := make([]byte, binary.MaxVarintLen64)
+	put := func(x int) {
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(x))])
+	}
+	buf.Write(binaryMagic)
+	put(len(nodes))
+	for _, n := range nodes {
+		put(len(n.Pairs))
+		for _, p := range n.Pairs {
+			put(p.I)
+			put(p.J)
+		}
+		put(len(n.Free))
+		for _, x := range n.Free {
+			put(x)
+		}
+		if n.JoinPrefix != nil {
+			put(1)
+			put(index[n.JoinPrefix])
+			put(index[n.JoinSuffix])
+		} else {
+			put(0)
+		}
+		put(len(n.Branches))
+		for _, b := range n.Branches {
+			put(index[b])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *FoldTree) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, binaryMagic) {
+		return errors.New("not a binary fold tree")
+	}
+	r := bytes.NewReader(data[len(binaryMagic):])
+	var err error
+	get := func() int {
+		if err != nil {
+			return 0
+		}
+		var x uint64
+		x, err = binary.ReadUvarint(r)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil && x > math.MaxInt32 {
+			err = fmt.Errorf("value %d out of range", x)
+		}
+		return int(x)
+	}
+	// Every node takes at least four bytes
+	numNodes := get()
+	if err == nil && (numNodes == 0 || numNodes > r.Len()/4) {
+		err = fmt.Errorf("invalid number of nodes %d", numNodes)
+	}
+	if err != nil {
+		return err
+	}
+	nodes := make([]*FoldTree, numNodes)
+	child := func(i int) *FoldTree {
+		c := get()
+		if err == nil && c >= i {
+			err = fmt.Errorf("invalid child node %d", c)
+		}
+		if err != nil {
+			return nil
+		}
+		return nodes[c]
+	}
+	for i := range nodes {
+		n := &FoldTree{}
+		for k := get(); err == nil && k > 0; k-- {
+			n.Pairs = append(n.Pairs, Pair{I: get(), J: get()})
+		}
+		for k := get(); err == nil && k > 0; k-- {
+			n.Free = append(n.Free, get())
+		}
+		if get() == 1 {
+			n.JoinPrefix = child(i)
+			n.JoinSuffix = child(i)
+		}
+		for k := get(); err == nil && k > 0; k-- {
+			n.Branches = append(n.Branches, child(i))
+		}
+		if err != nil {
+			return fmt.Errorf("node %d: %v", i, err)
+		}
+		nodes[i] = n
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%d extra bytes after fold tree", r.Len())
+	}
+	*f = *nodes[numNodes-1]
+	return nil
+}
@@ -0,0 +1,108 @@
+package types /* import "keltainen.duckdns.org/rnafolding/types" */
+
+import "context"
+import "encoding/json"
+import "reflect"
+import "testing"
+
+func sharedTestTree() *FoldTree {
+	shared := &FoldTree{
+		Branches: []*FoldTree{
+			{Free: []int{9}, Pairs: []Pair{{I: 10, J: 11}}},
+			{Free: []int{11}, Pairs: []Pair{{I: 9, J: 10}}},
+		},
+	}
+	return &FoldTree{
+		Branches: []*FoldTree{
+			{Pairs: []Pair{{I: 0, J: 8}}, JoinPrefix: &FoldTree{Free: []int{1, 2}}, JoinSuffix: shared},
+			{Pairs: []Pair{{I: 1, J: 8}}, JoinPrefix: &FoldTree{Free: []int{0, 2}}, JoinSuffix: shared},
+		},
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	tests := []*FoldTree{
+		{},
+		{Pairs: []Pair{{I: 0, J: 4}}, Free: []int{1, 2, 3}},
+		iteratorTestTree(),
+		sharedTestTree(),
+	}
+	for _, tree := range tests {
+		b, err := json.Marshal(tree)
+		if err != nil {
+			t.Errorf("json.Marshal(%v): unexpected error %v", tree, err)
+			continue
+		}
+		var fromJSON FoldTree
+		if err := json.Unmarshal(b, &fromJSON); err != nil {
+			t.Errorf("json.Unmarshal(%s): unexpected error %v", b, err)
+		} else if !reflect.DeepEqual(&fromJSON, tree) {
+			t.Errorf("json.Unmarshal(%s): expected\n%v\ngot\n%v", b, tree, &fromJSON)
+		}
+
+		b, err = tree.MarshalBinary()
+		if err != nil {
+			t.Errorf("MarshalBinary(%v): unexpected error %v", tree, err)
+			continue
+		}
+		var fromBinary FoldTree
+		if err := fromBinary.UnmarshalBinary(b); err != nil {
+			t.Errorf("UnmarshalBinary(%v): unexpected error %v", b, err)
+		} else if !reflect.DeepEqual(&fromBinary, tree) {
+			t.Errorf("UnmarshalBinary(%v): expected\n%v\ngot\n%v", b, tree, &fromBinary)
+		}
+		for i := range b[:len(b)-1] {
+			if err := new(FoldTree).UnmarshalBinary(b[:i]); err == nil {
+				t.Errorf("UnmarshalBinary(%v): expected error for truncated input", b[:i])
+			}
+		}
+	}
+}
+
+func TestSerializeShared(t *testing.T) {
+	tree := sharedTestTree()
+	b, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: unexpected error %v", err)
+	}
+	var out jsonTree
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("json.Unmarshal: unexpected error %v", err)
+	}
+	// Shared subtree with its two branches is stored only once
+	if len(out.Nodes) != 8 {
+		t.Errorf("expected 8 nodes, got %d: %s", len(out.Nodes), b)
+	}
+
+	var loaded FoldTree
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatalf("json.Unmarshal: unexpected error %v", err)
+	}
+	if loaded.Branches[0].JoinSuffix != loaded.Branches[1].JoinSuffix {
+		t.Errorf("shared subtree was not shared after loading")
+	}
+	if n := loaded.Iterate(context.Background(), 12).Total().Int64(); n != 4 {
+		t.Errorf("expected 4 foldings, got %d", n)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []string{
+		`{"Nodes":[]}`,
+		`{"Nodes":[{"Branches":[0]}]}`,
+		`{"Nodes":[{},{"Join":[0]}]}`,
+		`{"Nodes":[{},{"Branches":[2]}]}`,
+	}
+	for _, tt := range tests {
+		var f FoldTree
+		if err := json.Unmarshal([]byte(tt), &f); err == nil {
+			t.Errorf("json.Unmarshal(%s): expected error, got %v", tt, &f)
+		}
+	}
+	if err := new(FoldTree).UnmarshalBinary([]byte("FTR\x01\x01\x00\x00\x00\x00\x00")); err == nil {
+		t.Errorf("UnmarshalBinary: expected error for extra bytes")
+	}
+	if err := new(FoldTree).UnmarshalBinary([]byte("xyz")); err == nil {
+		t.Errorf("UnmarshalBinary: expected error for wrong header")
+	}
+}
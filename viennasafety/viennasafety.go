@@ -0,0 +1,262 @@
+package main /* import "keltainen.duckdns.org/rnafolding/viennasafety" */
+
+import "encoding/json"
+import "flag"
+import "fmt"
+import "io/ioutil"
+import "log"
+import "os"
+import "path"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/fasta"
+import "keltainen.duckdns.org/rnafolding/subopt"
+
+var (
+	seqdir  = flag.String("seq", "", "Directory containing sequence files")
+	folddir = flag.String("fold", "", "Directory containing directories of RNAsubopt output files, named as the sequence files")
+	outdir  = flag.String("out", "", "Write results to files in named directory")
+)
+
+var energyRanges = []int{1, 2, 3, 4, 5}
+
+type prediction struct {
+	P        float64
+	Correct  bool
+	NumBases int
+}
+
+type analysis struct {
+	Name      string
+	Preds     []prediction
+	E         float64
+	Bases     int
+	Decisions int
+}
+
+func main() {
+	flag.Parse()
+
+	if *seqdir == "" || *folddir == "" || *outdir == "" {
+		fmt.Print("Please set the directories with --seq, --fold and --out flags")
+		return
+	}
+
+	fdirs, err := ioutil.ReadDir(*folddir)
+	if err != nil {
+		log.Fatalf("Unable to list directory %v: %v", *folddir, err)
+	}
+	seqfiles, err := ioutil.ReadDir(*seqdir)
+	if err != nil {
+		log.Fatalf("Unable to list directory %v: %v", *seqdir, err)
+	}
+	fmt.Printf("Analyzing %d sequences\n", len(seqfiles))
+
+	var res []analysis
+	for _, sf := range seqfiles {
+		seq, err := readSequence(path.Join(*seqdir, sf.Name()))
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		for _, fd := range fdirs {
+			rec, err := readSubopt(path.Join(*folddir, fd.Name(), sf.Name()))
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			res = append(res, analyze(seq, rec))
+		}
+	}
+
+	writeDump(res)
+	writeTable(res, "viennafold-found-correct.dat", fracCorrectBetween)
+	writeTable(res, "viennafold-frac-correct.dat", fracCorrectPredictionsOfAll)
+	writeFracSafe(res)
+}
+
+func readSequence(fname string) (*base.Sequence, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file \"%s\": %v", fname, err)
+	}
+	defer f.Close()
+	seq, err := fasta.ReadSequence(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading FASTA format file \"%s\": %v", fname, err)
+	}
+	if len(seq.ReferenceFolding) != len(seq.Bases) {
+		return nil, fmt.Errorf("Sequence and its folding are of different length in \"%s\"", fname)
+	}
+	return seq, nil
+}
+
+func readSubopt(fname string) (*subopt.Record, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file \"%s\": %v", fname, err)
+	}
+	defer f.Close()
+	recs, err := subopt.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading RNAsubopt output \"%s\": %v", fname, err)
+	}
+	if len(recs) != 1 {
+		return nil, fmt.Errorf("Expected one sequence in \"%s\", found %d", fname, len(recs))
+	}
+	return recs[0], nil
+}
+
+func analyze(seq *base.Sequence, rec *subopt.Record) analysis {
+	ref := seq.ReferenceFolding
+	numBases := len(ref)
+	decisions := 0
+	for i, j := range ref {
+		if j < 0 || i < j {
+			decisions++
+		}
+	}
+
+	folds := rec.Foldings()
+	free := make([]int, numBases)
+	pair := make([][]int, numBases)
+	for i := range pair {
+		pair[i] = make([]int, numBases)
+	}
+	for _, f := range folds {
+		if len(f) != numBases {
+			log.Printf("%s: sequence and folding have different lengths", seq.Name)
+			continue
+		}
+		for i, j := range f {
+			if j < 0 {
+				free[i]++
+			} else if i < j {
+				pair[i][j]++
+			}
+		}
+	}
+
+	var preds []prediction
+	for i := 0; i < numBases; i++ {
+		if free[i] > 0 {
+			preds = append(preds, prediction{float64(free[i]) / float64(len(folds)), ref[i] < 0, 1})
+		}
+		for j := i + 1; j < numBases; j++ {
+			if pair[i][j] > 0 {
+				preds = append(preds, prediction{float64(pair[i][j]) / float64(len(folds)), ref[i] == j, 2})
+			}
+		}
+	}
+	return analysis{seq.Name, preds, rec.Delta, numBases, decisions}
+}
+
+func divOrZero(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// Number of correct predictions with probability in [pmin, pmax), out of
+// all decisions in reference foldings
+func fracCorrectBetween(res []analysis, e int, pmin, pmax float64) float64 {
+	corr := 0
+	decisions := 0
+	for _, r := range res {
+		if r.E != float64(e) {
+			continue
+		}
+		decisions += r.Decisions
+		for _, p := range r.Preds {
+			if p.Correct && p.P >= pmin && p.P < pmax {
+				corr++
+			}
+		}
+	}
+	return divOrZero(corr, decisions)
+}
+
+// Number of correct predictions with probability in [pmin, pmax), out of
+// all such predictions
+func fracCorrectPredictionsOfAll(res []analysis, e int, pmin, pmax float64) float64 {
+	corr := 0
+	all := 0
+	for _, r := range res {
+		if r.E != float64(e) {
+			continue
+		}
+		for _, p := range r.Preds {
+			if p.P >= pmin && p.P < pmax {
+				all++
+				if p.Correct {
+					corr++
+				}
+			}
+		}
+	}
+	return divOrZero(corr, all)
+}
+
+func fracSafe(res []analysis, e int) (float64, float64) {
+	safeBases, safeDecisions, totalBases, totalDecisions := 0, 0, 0, 0
+	for _, r := range res {
+		if r.E != float64(e) {
+			continue
+		}
+		for _, p := range r.Preds {
+			if p.P == 1.0 {
+				safeBases += p.NumBases
+				safeDecisions++
+			}
+		}
+		totalBases += r.Bases
+		totalDecisions += r.Decisions
+	}
+	return divOrZero(safeBases, totalBases), divOrZero(safeDecisions, totalDecisions)
+}
+
+func create(fname string) *os.File {
+	f, err := os.Create(path.Join(*outdir, fname))
+	if err != nil {
+		log.Fatalf("Could not open %s for writing: %v", fname, err)
+	}
+	return f
+}
+
+func writeDump(res []analysis) {
+	f := create("viennafold-safety-dump.json")
+	defer f.Close()
+	d, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		log.Fatalf("Could not encode JSON: %v", err)
+	}
+	if _, err := f.Write(d); err != nil {
+		log.Fatalf("Failed to write to viennafold-safety-dump.json: %v", err)
+	}
+}
+
+func writeTable(res []analysis, fname string, frac func([]analysis, int, float64, float64) float64) {
+	f := create(fname)
+	defer f.Close()
+	fmt.Fprint(f, "# P CorrAtE1 CorrBlv1 CorrAtE2 CorrBlv2 CorrAtE3 CorrBlv3 CorrAtE4 CorrBlv4 CorrAtE5 CorrBlv5\n")
+	for p := 0; p <= 100; p++ {
+		fmt.Fprintf(f, "%-3d", p)
+		for _, e := range energyRanges {
+			at := frac(res, e, float64(p)/100.0, float64(p+1)/100.0)
+			blv := frac(res, e, 0, float64(p+1)/100.0)
+			fmt.Fprintf(f, " %8.6f %8.6f", at, blv)
+		}
+		fmt.Fprint(f, "\n")
+	}
+}
+
+func writeFracSafe(res []analysis) {
+	f := create("frac-safe.dat")
+	defer f.Close()
+	fmt.Fprint(f, "# E SafeBases SafePredictions\n")
+	for _, e := range energyRanges {
+		bases, preds := fracSafe(res, e)
+		fmt.Fprintf(f, "%-3d %9.6f %15.6f\n", e, bases, preds)
+	}
+}
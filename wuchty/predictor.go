@@ -0,0 +1,54 @@
+package wuchty /* import "keltainen.duckdns.org/rnafolding/wuchty" */
+
+import "context"
+
+import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
+import "keltainen.duckdns.org/rnafolding/predictor"
+
+func init() {
+	predictor.Register(predictor.Algorithm{
+		Name:     "wuchty",
+		Complete: true,
+		New: func(seq *base.Sequence, rules predictor.Rules) predictor.Predictor {
+			return &Predictor{Seq: seq, MinHairpin: rules.MinHairpin, MaxSpan: rules.MaxSpan, NoLonelyPairs: rules.NoLonelyPairs}
+		},
+	})
+}
+
+func (p *Predictor) Fill(ctx context.Context) error {
+	return p.FillArrayContext(ctx)
+}
+
+func (p *Predictor) OptimalScore() int {
+	return p.V[0][len(p.V)-1]
+}
+
+// Optimal follows the first choice at each step of the backtracking done
+// by Enumerate.
+func (p *Predictor) Optimal() folding.FoldingPairs {
+	var pairs []pair
+	intervals := []pair{{0, len(p.Seq.Bases) - 1, plain}}
+	for len(intervals) > 0 {
+		var iv pair
+		intervals, iv = intervals[:len(intervals)-1], intervals[len(intervals)-1]
+		if iv.i >= iv.j {
+			continue
+		}
+		p.choices(iv, func(l int, pre, in pair, val int) bool {
+			if val != p.value(iv) {
+				return true
+			}
+			if l >= 0 {
+				pairs = append(pairs, pair{l, iv.j, plain})
+			}
+			intervals = append(intervals, pre, in)
+			return false
+		})
+	}
+	return pairsToArray(pairs, len(p.Seq.Bases))
+}
+
+func (p *Predictor) OptimalFoldings(ctx context.Context) (folding.FoldingSet, error) {
+	return p.BacktrackAllContext(ctx)
+}
@@ -4,8 +4,8 @@
 // Biopolymers, 1999, vol. 49, no. 2, pages 145–165.
 package wuchty /* import "keltainen.duckdns.org/rnafolding/wuchty" */
 
-import "log"
-import "fmt"
+import "context"
+import "sort"
 
 import "keltainen.duckdns.org/rnafolding/base"
 import "keltainen.duckdns.org/rnafolding/folding"
@@ -15,46 +15,144 @@ type Predictor struct {
 	V   [][]int
 
 	MinHairpin int
-	MaxStack   int
+	// Largest allowed j - i of a pair (i, j), or 0 for no limit
+	MaxSpan int
+	// Whether every pair must stack on another pair
+	NoLonelyPairs bool
+
+	// Optimal pairs of paired and inside intervals, only used with
+	// NoLonelyPairs. Paired intervals that cannot pair have -1 pairs.
+	s [][]int
+	x [][]int
+}
+
+// kind tells which foldings of an interval are meant. Without lonely
+// pairs, a pair may form only if it stacks on another pair, so the
+// foldings of an interval depend on the pair enclosing it.
+type kind int
+
+const (
+	// Any folding, the interval is not directly enclosed by a pair
+	plain kind = iota
+	// i and j pair with each other, stacking on the enclosing pair
+	paired
+	// The interval is directly enclosed by the pair (i-1, j+1), so (i, j)
+	// may pair without a pair stacking inside it
+	inside
+)
+
+type pair struct {
+	i    int
+	j    int
+	kind kind
+}
+
+func (p *Predictor) canPair(i, j int) bool {
+	return (p.MaxSpan == 0 || j-i <= p.MaxSpan) && p.Seq.CanPair(i, j, p.MinHairpin)
 }
 
 func (p *Predictor) FillArray() {
+	p.FillArrayContext(context.Background())
+}
+
+// FillArrayContext is like FillArray, but stops and returns ctx.Err() if
+// ctx is cancelled before the array is filled.
+func (p *Predictor) FillArrayContext(ctx context.Context) error {
 	numBases := len(p.Seq.Bases)
-	v := make([][]int, numBases)
-	for i := 0; i < numBases; i++ {
-		v[i] = make([]int, numBases)
+	kinds := []kind{plain}
+	p.V, p.s, p.x = newTable(numBases), nil, nil
+	if p.NoLonelyPairs {
+		kinds = []kind{plain, paired, inside}
+		p.s, p.x = newTable(numBases), newTable(numBases)
+		for i := range p.s {
+			for j := range p.s[i] {
+				p.s[i][j] = -1
+			}
+		}
 	}
 
 	for i := numBases - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			p.V, p.s, p.x = nil, nil, nil
+			return err
+		}
 		for j := i + 1; j < numBases; j++ {
-			best := v[i][j-1]
-			for l := i; l < j; l++ {
-				if p.Seq.CanPair(l, j, p.MinHairpin) {
-					val := 1 + v[l+1][j-1]
-					if i < l-1 {
-						val += v[i][l-1]
-					}
+			for _, k := range kinds {
+				best := -1
+				p.choices(pair{i, j, k}, func(l int, pre, in pair, val int) bool {
 					if val > best {
 						best = val
 					}
-				}
+					return true
+				})
+				p.table(k)[i][j] = best
 			}
-			v[i][j] = best
 		}
 	}
+	return nil
+}
 
-	p.V = v
+func newTable(n int) [][]int {
+	t := make([][]int, n)
+	for i := range t {
+		t[i] = make([]int, n)
+	}
+	return t
 }
 
-type pair struct {
-	i int
-	j int
+func (p *Predictor) table(k kind) [][]int {
+	switch k {
+	case paired:
+		return p.s
+	case inside:
+		return p.x
+	}
+	return p.V
 }
 
-type state struct {
-	intervals []pair
-	pairs     []pair
-	structure string
+// value returns the number of pairs in optimal foldings of iv, or -1 if
+// iv has no foldings.
+func (p *Predictor) value(iv pair) int {
+	switch {
+	case iv.kind == paired && iv.i >= iv.j:
+		return -1
+	case iv.i >= iv.j:
+		return 0
+	}
+	return p.table(iv.kind)[iv.i][iv.j]
+}
+
+// choices calls fn with each way to fold iv, until fn returns false: j is
+// left free if l is -1, or paired with l. The rest of the interval is
+// folded as pre, before l, and in, inside the pair. val is the number of
+// pairs in the best foldings following the choice.
+func (p *Predictor) choices(iv pair, fn func(l int, pre, in pair, val int) bool) {
+	i, j := iv.i, iv.j
+	if iv.kind != paired {
+		if !fn(-1, pair{i, j - 1, plain}, pair{j, j, plain}, p.value(pair{i, j - 1, plain})) {
+			return
+		}
+	}
+	for l := i; l < j; l++ {
+		if !p.canPair(l, j) || (iv.kind == paired && l > i) {
+			continue
+		}
+		in := pair{l + 1, j - 1, plain}
+		if p.NoLonelyPairs {
+			in.kind = paired
+			if iv.kind != plain && l == i {
+				in.kind = inside
+			}
+		}
+		inVal := p.value(in)
+		if inVal < 0 {
+			continue
+		}
+		pre := pair{i, l - 1, plain}
+		if !fn(l, pre, in, p.value(pre)+1+inVal) {
+			return
+		}
+	}
 }
 
 func pairsToArray(pp []pair, l int) []int {
@@ -69,71 +167,170 @@ func pairsToArray(pp []pair, l int) []int {
 	return a
 }
 
-func refinedStructure(s state, i, p []pair, str string) state {
-	ints := make([]pair, len(s.intervals), len(s.intervals)+len(i))
-	copy(ints, s.intervals)
-	ints = append(ints, i...)
-	pairs := make([]pair, len(s.pairs), len(s.pairs)+len(p))
-	copy(pairs, s.pairs)
-	pairs = append(pairs, p...)
-	return state{ints, pairs, s.structure + str}
+// BacktrackAll returns all optimal foldings.
+func (p *Predictor) BacktrackAll() folding.FoldingSet {
+	out, _ := p.BacktrackAllContext(context.Background())
+	return out
 }
 
-func (p *Predictor) BacktrackAll() folding.FoldingSet {
+// BacktrackAllContext is like BacktrackAll, but stops and returns
+// ctx.Err() if ctx is cancelled before all foldings have been found.
+func (p *Predictor) BacktrackAllContext(ctx context.Context) (folding.FoldingSet, error) {
 	var out folding.FoldingSet
-	stack := []state{
-		state{
-			[]pair{pair{0, len(p.Seq.Bases) - 1}},
-			nil,
-			"",
-		},
-	}
-
-	for len(stack) > 0 {
-		var s state
-		stack, s = stack[:len(stack)-1], stack[len(stack)-1]
-		if len(s.intervals) == 0 {
-			out = append(out, pairsToArray(s.pairs, len(p.Seq.Bases)))
-			//log.Println(s.structure)
-			continue
-		}
-		numfound := 0
-		var interval pair
-		s.intervals, interval = s.intervals[:len(s.intervals)-1], s.intervals[len(s.intervals)-1]
-		if interval.i < interval.j && p.V[interval.i][interval.j] == p.V[interval.i][interval.j-1] {
-			stack = append(stack, refinedStructure(s, []pair{pair{interval.i, interval.j - 1}}, nil, fmt.Sprintf("d(%d,%d) ", interval.i, interval.j-1)))
-			numfound++
-		}
+	_, err := p.Enumerate(ctx, 0, func(f folding.FoldingPairs) bool {
+		out = append(out, f)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
 
-		//if numfound > 0 {
-		//	continue
-		//}
+// BacktrackWithin returns all foldings that have at most delta pairs less
+// than the optimal foldings, sorted by decreasing number of pairs.
+func (p *Predictor) BacktrackWithin(delta int) folding.FoldingSet {
+	out, _ := p.BacktrackWithinContext(context.Background(), delta)
+	return out
+}
 
-		for l := interval.i; l < interval.j; l++ {
-			if !p.Seq.CanPair(l, interval.j, p.MinHairpin) {
-				continue
-			}
-			val := 1 + p.V[l+1][interval.j-1]
-			if interval.i < l-1 {
-				val += p.V[interval.i][l-1]
-			}
-			if p.V[interval.i][interval.j] == val {
-				stack = append(stack, refinedStructure(
-					s,
-					[]pair{pair{interval.i, l - 1}, pair{l + 1, interval.j - 1}},
-					[]pair{pair{l, interval.j}},
-					fmt.Sprintf("p(%d,%d) j(%d,%d)(%d,%d) ", l, interval.j, interval.i, l-1, l+1, interval.j-1)))
-				numfound++
-			}
+// BacktrackWithinContext is like BacktrackWithin, but stops and returns
+// ctx.Err() if ctx is cancelled before all foldings have been found.
+func (p *Predictor) BacktrackWithinContext(ctx context.Context, delta int) (folding.FoldingSet, error) {
+	var out folding.FoldingSet
+	var pairs []int
+	_, err := p.EnumerateWithin(ctx, delta, 0, func(f folding.FoldingPairs) bool {
+		out = append(out, f)
+		pairs = append(pairs, countPairs(f))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(byPairs{out, pairs})
+	return out, nil
+}
+
+// Enumerate calls fn with each optimal folding in depth first order, until
+// fn returns false. Each folding is passed exactly once, because at each
+// step the last base of an interval is either left free or paired with a
+// different base, so no two branches can produce the same folding. fn may
+// keep the folding it is given.
+//
+// Memory use grows with the length of the sequence, but not with the number
+// of foldings. If limit is positive, at most limit foldings are passed, and
+// truncated tells whether there were more. Enumerate returns ctx.Err() if
+// ctx is cancelled before the enumeration is done.
+func (p *Predictor) Enumerate(ctx context.Context, limit int64, fn func(folding.FoldingPairs) bool) (truncated bool, err error) {
+	return p.EnumerateWithin(ctx, 0, limit, fn)
+}
+
+// EnumerateWithin is like Enumerate, but passes all foldings that have at
+// most delta pairs less than the optimal foldings. A branch is followed
+// only if the pairs chosen so far and the maximal pairs of the intervals
+// still to be folded add up to enough pairs, so no time is spent on
+// foldings outside the range.
+func (p *Predictor) EnumerateWithin(ctx context.Context, delta int, limit int64, fn func(folding.FoldingPairs) bool) (truncated bool, err error) {
+	e := &enumeration{
+		p:         p,
+		ctx:       ctx,
+		limit:     limit,
+		fn:        fn,
+		slack:     delta,
+		fold:      pairsToArray(nil, len(p.Seq.Bases)),
+		intervals: []pair{{0, len(p.Seq.Bases) - 1, plain}},
+	}
+	e.next()
+	return e.truncated, e.err
+}
+
+type enumeration struct {
+	p     *Predictor
+	ctx   context.Context
+	limit int64
+	fn    func(folding.FoldingPairs) bool
+	// How many pairs less than optimal the choices made so far may lose
+	slack int
+
+	// Pairs chosen so far, and intervals that are still to be folded
+	fold      folding.FoldingPairs
+	intervals []pair
+
+	count     int64
+	truncated bool
+	err       error
+}
+
+// next folds the remaining intervals in every way that loses at most slack
+// pairs. It returns false when the enumeration should stop.
+func (e *enumeration) next() bool {
+	if len(e.intervals) == 0 {
+		if e.limit > 0 && e.count >= e.limit {
+			e.truncated = true
+			return false
 		}
+		e.count++
+		return e.fn(append(folding.FoldingPairs(nil), e.fold...))
+	}
+	if err := e.ctx.Err(); err != nil {
+		e.err = err
+		return false
+	}
 
-		if numfound == 0 {
-			stack = append(stack, state{s.intervals, s.pairs, s.structure + fmt.Sprintf("pop(%d,%d) ", interval.i, interval.j)})
+	p := e.p
+	last := len(e.intervals) - 1
+	iv := e.intervals[last]
+	e.intervals = e.intervals[:last]
+	defer func() {
+		e.intervals = append(e.intervals[:last], iv)
+	}()
+
+	if iv.i >= iv.j {
+		return e.next()
+	}
+	ok := true
+	p.choices(iv, func(l int, pre, in pair, val int) bool {
+		loss := p.value(iv) - val
+		if loss > e.slack {
+			return true
 		}
-		if len(stack) >= p.MaxStack {
-			log.Printf("Stack overflow in wuchty.BacktrackAll: %d items, max %d", len(stack), p.MaxStack)
-			break
+		e.slack -= loss
+		if l >= 0 {
+			e.fold[l] = iv.j
+			e.fold[iv.j] = l
+		}
+		e.intervals = append(e.intervals, pre, in)
+		ok = e.next()
+		e.intervals = e.intervals[:last]
+		if l >= 0 {
+			e.fold[l] = -1
+			e.fold[iv.j] = -1
+		}
+		e.slack += loss
+		return ok
+	})
+	return ok
+}
+
+func countPairs(f folding.FoldingPairs) int {
+	c := 0
+	for _, j := range f {
+		if j >= 0 {
+			c++
 		}
 	}
-	return out
+	return c / 2
+}
+
+// byPairs sorts foldings by decreasing number of pairs.
+type byPairs struct {
+	ff    folding.FoldingSet
+	pairs []int
+}
+
+func (b byPairs) Len() int           { return len(b.ff) }
+func (b byPairs) Less(i, j int) bool { return b.pairs[i] > b.pairs[j] }
+func (b byPairs) Swap(i, j int) {
+	b.ff[i], b.ff[j] = b.ff[j], b.ff[i]
+	b.pairs[i], b.pairs[j] = b.pairs[j], b.pairs[i]
 }
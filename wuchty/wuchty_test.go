@@ -1,10 +1,14 @@
 package wuchty /* import "keltainen.duckdns.org/rnafolding/wuchty" */
 
+import "context"
+import "sort"
 import "testing"
 import "reflect"
 
 import "keltainen.duckdns.org/rnafolding/base"
+import "keltainen.duckdns.org/rnafolding/folding"
 import "keltainen.duckdns.org/rnafolding/format"
+import "keltainen.duckdns.org/rnafolding/safecomplete"
 
 func TestFillArray(t *testing.T) {
 	tests := []struct {
@@ -49,3 +53,198 @@ func TestFillArray(t *testing.T) {
 		}
 	}
 }
+
+func TestEnumerate(t *testing.T) {
+	seqs := []string{
+		"GGGAAAUCC",
+		"GGGAAAUCCAAACCCUUUGGG",
+		"GGGAAAUCCGAAAC",
+		"ACGUACGUACGUACGUACGU",
+	}
+	for _, str := range seqs {
+		seq := base.SequenceFromString(str)
+		p := &Predictor{Seq: seq, MinHairpin: 3}
+		p.FillArray()
+		var ff folding.FoldingSet
+		truncated, err := p.Enumerate(context.Background(), 0, func(f folding.FoldingPairs) bool {
+			ff = append(ff, f)
+			return true
+		})
+		if truncated || err != nil {
+			t.Errorf("Enumerate(%s): truncated %v, error %v", str, truncated, err)
+		}
+
+		for _, f := range ff {
+			for i, j := range f {
+				if j < -1 || j >= len(f) || (j >= 0 && f[j] != i) {
+					t.Errorf("Enumerate(%s): invalid folding %v", str, f)
+					break
+				}
+			}
+		}
+
+		sorted := append(folding.FoldingSet(nil), ff...)
+		sort.Sort(folding.FoldingOrdering{FoldingSet: sorted})
+		for i := 1; i < len(sorted); i++ {
+			if reflect.DeepEqual(sorted[i-1], sorted[i]) {
+				t.Errorf("Enumerate(%s): folding %v passed twice", str, sorted[i])
+			}
+		}
+
+		sc := &safecomplete.Predictor{Seq: seq, MinHairpin: 3}
+		sc.FillArray()
+		expected := sc.BacktrackFolding().GeneratePairArrays(seq)
+		if equal, err := folding.FoldingSetsEqual(ff, expected); err != nil || !equal {
+			t.Errorf("Enumerate(%s): got %d foldings %v, expected %d foldings %v", str, len(ff), ff, len(expected), expected)
+		}
+	}
+}
+
+func TestEnumerateLimits(t *testing.T) {
+	p := &Predictor{Seq: base.SequenceFromString("GGGAAAUCCAAACCCUUUGGG"), MinHairpin: 3}
+	p.FillArray()
+	tests := []struct {
+		limit     int64
+		stopAfter int
+		count     int
+		truncated bool
+	}{
+		{0, 0, 21, false},
+		{5, 0, 5, true},
+		{20, 0, 20, true},
+		{21, 0, 21, false},
+		{100, 0, 21, false},
+		{0, 3, 3, false},
+		{2, 3, 2, true},
+	}
+	for _, tt := range tests {
+		count := 0
+		truncated, err := p.Enumerate(context.Background(), tt.limit, func(f folding.FoldingPairs) bool {
+			count++
+			return tt.stopAfter == 0 || count < tt.stopAfter
+		})
+		if err != nil || count != tt.count || truncated != tt.truncated {
+			t.Errorf("Enumerate with limit %d, stopping after %d: got %d foldings, truncated %v, error %v, expected %d foldings, truncated %v",
+				tt.limit, tt.stopAfter, count, truncated, err, tt.count, tt.truncated)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Enumerate(ctx, 0, func(f folding.FoldingPairs) bool { return true }); err != context.Canceled {
+		t.Errorf("Enumerate with cancelled context: expected context.Canceled, got %v", err)
+	}
+}
+
+// allFoldings lists every folding of bases i..j of seq, by leaving base i
+// free or pairing it with each possible base in turn.
+func allFoldings(seq *base.Sequence, minHairpin, i, j int) [][]pair {
+	if i >= j {
+		return [][]pair{nil}
+	}
+	out := allFoldings(seq, minHairpin, i+1, j)
+	for k := i + 1; k <= j; k++ {
+		if !seq.CanPair(i, k, minHairpin) {
+			continue
+		}
+		for _, inside := range allFoldings(seq, minHairpin, i+1, k-1) {
+			for _, outside := range allFoldings(seq, minHairpin, k+1, j) {
+				f := append([]pair{{i, k, plain}}, inside...)
+				out = append(out, append(f, outside...))
+			}
+		}
+	}
+	return out
+}
+
+func TestBacktrackWithin(t *testing.T) {
+	seqs := []string{
+		"GGGAAAUCC",
+		"GGGAAAUCCAAACCCUUUGGG",
+		"ACGUACGUACGUACGUACGU",
+	}
+	for _, str := range seqs {
+		seq := base.SequenceFromString(str)
+		p := &Predictor{Seq: seq, MinHairpin: 3}
+		p.FillArray()
+		optimal := p.V[0][len(seq.Bases)-1]
+		all := allFoldings(seq, 3, 0, len(seq.Bases)-1)
+		for delta := 0; delta <= 3; delta++ {
+			var expected folding.FoldingSet
+			for _, pp := range all {
+				if len(pp) >= optimal-delta {
+					expected = append(expected, pairsToArray(pp, len(seq.Bases)))
+				}
+			}
+			ff := p.BacktrackWithin(delta)
+			if equal, err := folding.FoldingSetsEqual(ff, expected); err != nil || !equal || len(ff) != len(expected) {
+				t.Errorf("BacktrackWithin(%d) of %s: got %d foldings, expected %d", delta, str, len(ff), len(expected))
+			}
+			for i := 1; i < len(ff); i++ {
+				if countPairs(ff[i-1]) < countPairs(ff[i]) {
+					t.Errorf("BacktrackWithin(%d) of %s: foldings not sorted by number of pairs", delta, str)
+					break
+				}
+			}
+			if delta == 0 {
+				if equal, _ := folding.FoldingSetsEqual(ff, p.BacktrackAll()); !equal {
+					t.Errorf("BacktrackWithin(0) of %s differs from BacktrackAll", str)
+				}
+			}
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		seq     string
+		maxSpan int
+		noLP    bool
+	}{
+		{"GGGAAAUCCAAACCCUUUGGG", 0, true},
+		{"GGGAAAUCCAAACCCUUUGGG", 8, false},
+		{"GGGAAAUCCAAACCCUUUGGG", 10, true},
+		{"GCGCAAAGCAAAGCGCAAAGCGC", 0, true},
+		{"ACGUACGUACGUACGUACGU", 7, true},
+	}
+	for _, tt := range tests {
+		seq := base.SequenceFromString(tt.seq)
+		p := &Predictor{Seq: seq, MinHairpin: 3, MaxSpan: tt.maxSpan, NoLonelyPairs: tt.noLP}
+		p.FillArray()
+		optimal := p.V[0][len(seq.Bases)-1]
+
+		var allowed folding.FoldingSet
+		best := 0
+	foldings:
+		for _, pp := range allFoldings(seq, 3, 0, len(seq.Bases)-1) {
+			f := pairsToArray(pp, len(seq.Bases))
+			for _, pr := range pp {
+				if tt.maxSpan > 0 && pr.j-pr.i > tt.maxSpan || tt.noLP && folding.Lonely(f, pr.i) {
+					continue foldings
+				}
+			}
+			allowed = append(allowed, f)
+			if len(pp) > best {
+				best = len(pp)
+			}
+		}
+		if optimal != best {
+			t.Errorf("%s, span %d, no lonely pairs %v: optimal %d pairs, expected %d", tt.seq, tt.maxSpan, tt.noLP, optimal, best)
+		}
+		if f := p.Optimal(); countPairs(f) != optimal {
+			t.Errorf("%s, span %d, no lonely pairs %v: Optimal has %d pairs, expected %d", tt.seq, tt.maxSpan, tt.noLP, countPairs(f), optimal)
+		}
+		for delta := 0; delta <= 2; delta++ {
+			var expected folding.FoldingSet
+			for _, f := range allowed {
+				if countPairs(f) >= optimal-delta {
+					expected = append(expected, f)
+				}
+			}
+			ff := p.BacktrackWithin(delta)
+			if equal, err := folding.FoldingSetsEqual(ff, expected); err != nil || !equal || len(ff) != len(expected) {
+				t.Errorf("%s, span %d, no lonely pairs %v: BacktrackWithin(%d) got %d foldings, expected %d", tt.seq, tt.maxSpan, tt.noLP, delta, len(ff), len(expected))
+			}
+		}
+	}
+}